@@ -2,8 +2,13 @@ package main
 
 import (
 	"HAB/internal/server"
+	"os"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "package" {
+		os.Exit(runPackageCommand(os.Args[2:]))
+	}
+
 	server.StartGinServer()
 }
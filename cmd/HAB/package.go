@@ -0,0 +1,190 @@
+package main
+
+import (
+	"HAB/configs"
+	"HAB/internal/dbs"
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"HAB/internal/services"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const packageUsage = `Usage:
+  HAB package export -id <problem id> [-o <file>]   write a problem to a zip package
+  HAB package import [-format <format>] <file>      create a problem from a package
+  HAB package check [-format <format>] <file>       validate a package without importing it
+
+Formats: hab (default), polygon, kattis
+`
+
+// runPackageCommand runs the package subcommands and returns the exit code
+func runPackageCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, packageUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "export":
+		err = exportPackage(args[1:])
+	case "import":
+		err = importPackage(args[1:])
+	case "check":
+		err = checkPackage(args[1:])
+	default:
+		fmt.Fprint(os.Stderr, packageUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	return 0
+}
+
+func exportPackage(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	problemID := flags.Int("id", 0, "ID of the problem to export")
+	output := flags.String("o", "", "output file, problem-<id>.zip by default")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *problemID <= 0 {
+		return fmt.Errorf("a problem ID is required")
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("problem-%d.zip", *problemID)
+	}
+
+	problemRepo, closeRepo, err := openProblemRepository()
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+
+	pkg, err := problemRepo.ExportProblem(context.Background(), *problemID)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", *output, err)
+	}
+	if err := services.WriteProblemPackage(file, pkg); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+
+	fmt.Printf("Exported problem %d with %d test cases to %s\n", *problemID, len(pkg.TestCases), *output)
+	return nil
+}
+
+func importPackage(args []string) error {
+	pkg, err := readPackageArgs("import", args)
+	if err != nil {
+		return err
+	}
+
+	problemRepo, closeRepo, err := openProblemRepository()
+	if err != nil {
+		return err
+	}
+	defer closeRepo()
+
+	problemID, err := problemRepo.ImportProblem(context.Background(), pkg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %q as problem %d with %d test cases\n", pkg.Problem.Title, problemID, len(pkg.TestCases))
+	return nil
+}
+
+func checkPackage(args []string) error {
+	pkg, err := readPackageArgs("check", args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%q: %d test cases, code for %d languages, %d attachments, %d ms, %d MB, %s checker\n",
+		pkg.Problem.Title, len(pkg.TestCases), len(pkg.Code), len(pkg.Attachments),
+		pkg.Problem.TimeLimitMs, pkg.Problem.MemoryLimitMB, pkg.Problem.Checker)
+	return nil
+}
+
+// readPackageArgs reads the package named by the arguments, printing the
+// warnings of the conversion from other formats
+func readPackageArgs(command string, args []string) (*models.ProblemPackage, error) {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	format := flags.String("format", services.PackageFormatHAB, "package format: hab, polygon or kattis")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+	if flags.NArg() != 1 {
+		return nil, fmt.Errorf("expected one package file")
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open package: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read package: %w", err)
+	}
+
+	pkg, warnings, err := services.ImportProblemPackage(*format, file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	return pkg, nil
+}
+
+// openProblemRepository connects to the database, Redis and blob store
+// configured for the server, so imports invalidate the same cache the
+// server reads
+func openProblemRepository() (repositories.ProblemRepository, func(), error) {
+	logger.InitLogger()
+
+	db, err := dbs.Init()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	if err := dbs.InitRedis(context.Background()); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to initialize Redis: %w", err)
+	}
+
+	blobStore, err := dbs.InitBlobStore(context.Background())
+	if err != nil {
+		dbs.CloseRedis()
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to initialize blob store: %w", err)
+	}
+
+	closeRepo := func() {
+		dbs.CloseRedis()
+		db.Close()
+		logger.SyncLogger()
+	}
+
+	problemRepo := repositories.NewProblemRepository(db, services.NewRedisCache(dbs.RedisClient),
+		blobStore, configs.LoadConfig().BlobInlineLimit)
+	return problemRepo, closeRepo, nil
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -17,6 +18,53 @@ type Config struct {
 	ServerPort      string
 	NumberOfWorkers int
 	JWTSecret       string
+
+	// Users given the admin role at startup
+	AdminUserIDs []int
+
+	// Fair scheduling of the judge queue
+	MaxInFlightPerUser  int
+	SchedulerBufferSize int
+
+	// Rate limits, in requests per minute with the allowed burst
+	SubmissionRatePerMinute int
+	SubmissionBurst         int
+	AuthRatePerMinute       int
+	AuthBurst               int
+	// Proxies whose X-Forwarded-For is believed when finding the client IP,
+	// as IPs or CIDRs. None are trusted when empty.
+	TrustedProxies []string
+
+	// New submissions are rejected while more jobs than this are waiting (0 disables)
+	MaxQueueBacklog int
+
+	// Submissions PROCESSING for longer than this are requeued up to
+	// MaxSubmissionRequeues times, then marked INTERNAL_ERROR
+	StuckSubmissionTimeout int // seconds
+	MaxSubmissionRequeues  int
+
+	// Request and source code limits, in bytes
+	MaxRequestBodySize      int
+	MaxPackageSize          int // uploaded problem packages
+	MaxAttachmentSize       int // uploaded statement images
+	MaxTestCaseSize         int // test cases added or edited one at a time
+	MaxSourceSize           int
+	MaxSourceSizeByLanguage map[string]int
+	// Languages accepting submissions, all of them when empty
+	EnabledLanguages []string
+
+	// Test files larger than BlobInlineLimit bytes go to the blob store:
+	// "local" keeps them under BlobDir, "s3" in an S3-compatible bucket.
+	// Workers cache the blobs they read under BlobCacheDir.
+	BlobStore       string
+	BlobDir         string
+	BlobCacheDir    string
+	BlobInlineLimit int
+	S3Endpoint      string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3Bucket        string
+	S3UseSSL        bool
 }
 
 func LoadConfig() *Config {
@@ -27,6 +75,8 @@ func LoadConfig() *Config {
 	}
 
 	numWorkerInt, _ := strconv.Atoi(os.Getenv("NUM_OF_WORKERS"))
+	maxInFlightPerUser := getEnvInt("MAX_INFLIGHT_PER_USER", 2)
+	schedulerBufferSize := getEnvInt("SCHEDULER_BUFFER_SIZE", 100)
 
 	return &Config{
 		DBHost:          os.Getenv("DB_HOST"),
@@ -37,5 +87,97 @@ func LoadConfig() *Config {
 		ServerPort:      os.Getenv("SEVER_PORT"),
 		NumberOfWorkers: numWorkerInt,
 		JWTSecret:       os.Getenv("JWT_SECRET"),
+
+		AdminUserIDs: getEnvIntList("ADMIN_USER_IDS"),
+
+		MaxInFlightPerUser:  maxInFlightPerUser,
+		SchedulerBufferSize: schedulerBufferSize,
+
+		SubmissionRatePerMinute: getEnvInt("SUBMISSION_RATE_PER_MINUTE", 6),
+		SubmissionBurst:         getEnvInt("SUBMISSION_BURST", 10),
+		AuthRatePerMinute:       getEnvInt("AUTH_RATE_PER_MINUTE", 20),
+		AuthBurst:               getEnvInt("AUTH_BURST", 10),
+		TrustedProxies:          getEnvList("TRUSTED_PROXIES"),
+
+		MaxQueueBacklog: getEnvInt("MAX_QUEUE_BACKLOG", 1000),
+
+		StuckSubmissionTimeout: getEnvInt("STUCK_SUBMISSION_TIMEOUT", 600),
+		MaxSubmissionRequeues:  getEnvInt("MAX_SUBMISSION_REQUEUES", 2),
+
+		MaxRequestBodySize:      getEnvInt("MAX_REQUEST_BODY_SIZE", 1<<20),
+		MaxPackageSize:          getEnvInt("MAX_PACKAGE_SIZE", 32<<20),
+		MaxAttachmentSize:       getEnvInt("MAX_ATTACHMENT_SIZE", 4<<20),
+		MaxTestCaseSize:         getEnvInt("MAX_TEST_CASE_SIZE", 32<<20),
+		MaxSourceSize:           getEnvInt("MAX_SOURCE_SIZE", 64*1024),
+		MaxSourceSizeByLanguage: getEnvIntMap("MAX_SOURCE_SIZE_BY_LANGUAGE"),
+		EnabledLanguages:        getEnvList("ENABLED_LANGUAGES"),
+
+		BlobStore:       getEnvString("BLOB_STORE", "local"),
+		BlobDir:         getEnvString("BLOB_DIR", "./data/blobs"),
+		BlobCacheDir:    getEnvString("BLOB_CACHE_DIR", "/tmp/hab-blobs"),
+		BlobInlineLimit: getEnvInt("BLOB_INLINE_LIMIT", 64*1024),
+		S3Endpoint:      os.Getenv("S3_ENDPOINT"),
+		S3AccessKey:     os.Getenv("S3_ACCESS_KEY"),
+		S3SecretKey:     os.Getenv("S3_SECRET_KEY"),
+		S3Bucket:        getEnvString("S3_BUCKET", "hab-blobs"),
+		S3UseSSL:        os.Getenv("S3_USE_SSL") == "true",
+	}
+}
+
+// getEnvInt reads an integer environment variable, falling back to def when it is unset or invalid
+func getEnvInt(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+	return value
+}
+
+// getEnvString reads an environment variable, falling back to def when it is unset
+func getEnvString(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// getEnvIntList reads a comma-separated list of integers, skipping invalid entries
+func getEnvIntList(key string) []int {
+	var values []int
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// getEnvList reads a comma-separated list, skipping empty entries
+func getEnvList(key string) []string {
+	var values []string
+	for _, part := range strings.Split(os.Getenv(key), ",") {
+		if value := strings.TrimSpace(part); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// getEnvIntMap reads comma-separated name:integer pairs, skipping invalid entries
+func getEnvIntMap(key string) map[string]int {
+	values := make(map[string]int)
+	for _, part := range getEnvList(key) {
+		name, rawValue, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(rawValue))
+		if err != nil {
+			continue
+		}
+		values[strings.TrimSpace(name)] = value
 	}
+	return values
 }
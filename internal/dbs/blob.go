@@ -0,0 +1,25 @@
+package dbs
+
+import (
+	config "HAB/configs"
+	"HAB/internal/services"
+	"context"
+	"fmt"
+)
+
+// InitBlobStore opens the blob store test files are kept in
+func InitBlobStore(ctx context.Context) (services.BlobStore, error) {
+	cfg := config.LoadConfig()
+
+	switch cfg.BlobStore {
+	case "local":
+		return services.NewLocalBlobStore(cfg.BlobDir)
+	case "s3":
+		if cfg.S3Endpoint == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT is required for the s3 blob store")
+		}
+		return services.NewS3BlobStore(ctx, cfg.S3Endpoint, cfg.S3AccessKey, cfg.S3SecretKey, cfg.S3Bucket, cfg.S3UseSSL)
+	default:
+		return nil, fmt.Errorf("unknown blob store %q, use local or s3", cfg.BlobStore)
+	}
+}
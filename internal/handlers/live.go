@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/services"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	livePingInterval = 30 * time.Second
+	liveWriteTimeout = 10 * time.Second
+	// liveCatchUpBatch is how many missed events are read from the stream at once
+	liveCatchUpBatch = 100
+)
+
+// LiveHandler pushes judge updates for all of a user's submissions over a
+// single WebSocket connection.
+type LiveHandler struct {
+	events   *services.SubmissionEvents
+	hub      *services.UserEventHub
+	upgrader websocket.Upgrader
+}
+
+func NewLiveHandler(events *services.SubmissionEvents, hub *services.UserEventHub, allowedOrigins []string) *LiveHandler {
+	origins := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins[origin] = true
+	}
+
+	return &LiveHandler{
+		events: events,
+		hub:    hub,
+		upgrader: websocket.Upgrader{
+			// The connection is authenticated by cookie, so only accept the
+			// origins the CORS policy allows.
+			CheckOrigin: func(r *http.Request) bool {
+				origin := r.Header.Get("Origin")
+				return origin == "" || origins[origin]
+			},
+		},
+	}
+}
+
+// ServeSubmissions upgrades the request to a WebSocket and streams every
+// submission event of the authenticated user. A client reconnecting with
+// ?last_event_id=<id> first receives the events it missed.
+func (h *LiveHandler) ServeSubmissions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	lastID := c.Query("last_event_id")
+	if lastID != "" && !services.ValidStreamID(lastID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid last_event_id"})
+		return
+	}
+	if lastID == "" {
+		var err error
+		lastID, err = h.events.LastUserEventID(c.Request.Context(), userID.(int))
+		if err != nil {
+			logger.Log.Error("Failed to get last user event",
+				zap.Any("user_id", userID),
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to open live updates"})
+			return
+		}
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already written an error response
+		logger.Log.Info("WebSocket upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Read from the client only to notice when it goes away
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	send := func(event services.UserEvent) bool {
+		conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+		if err := conn.WriteJSON(event); err != nil {
+			return false
+		}
+		lastID = event.ID
+		return true
+	}
+
+	// Subscribe before catching up, so no event falls in between; events
+	// seen in both are skipped by their ID. A subscription dropped for
+	// falling behind starts over the same way.
+	for ctx.Err() == nil {
+		sub := h.hub.Subscribe(userID.(int))
+		if !h.catchUp(ctx, userID.(int), &lastID, send) {
+			sub.Close()
+			return
+		}
+
+	live:
+		for {
+			select {
+			case <-ctx.Done():
+				break live
+			case event, ok := <-sub.Events:
+				if !ok {
+					break live
+				}
+				if services.StreamIDAfter(event.ID, lastID) && !send(event) {
+					sub.Close()
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteTimeout)); err != nil {
+					sub.Close()
+					return
+				}
+			}
+		}
+		sub.Close()
+	}
+}
+
+// catchUp sends the events of the user's stream after lastID. It reports
+// whether the connection is still usable.
+func (h *LiveHandler) catchUp(ctx context.Context, userID int, lastID *string, send func(services.UserEvent) bool) bool {
+	for {
+		events, err := h.events.UserEventsAfter(ctx, userID, *lastID, liveCatchUpBatch)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Error("Failed to read user events",
+					zap.Int("user_id", userID),
+					zap.Error(err))
+			}
+			return false
+		}
+
+		for _, event := range events {
+			if !send(event) {
+				return false
+			}
+		}
+		if len(events) < liveCatchUpBatch {
+			return true
+		}
+	}
+}
+
+func (h *LiveHandler) RegisterRoutes(router *gin.Engine, authMiddleware gin.HandlerFunc) {
+	liveGroup := router.Group("/live")
+	liveGroup.Use(authMiddleware)
+	{
+		liveGroup.GET("/submissions", h.ServeSubmissions)
+	}
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"HAB/internal/logger"
+	"HAB/internal/models"
 	"HAB/internal/repositories"
+	"HAB/internal/services"
 	"context"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,23 +17,44 @@ import (
 
 type ProblemHandler struct {
 	problemRepo repositories.ProblemRepository
+	generations *services.TestGenerationJobs
 }
 
-func NewProblemHandler(problemRepo repositories.ProblemRepository) *ProblemHandler {
+func NewProblemHandler(problemRepo repositories.ProblemRepository, generations *services.TestGenerationJobs) *ProblemHandler {
 	return &ProblemHandler{
 		problemRepo: problemRepo,
+		generations: generations,
 	}
 }
 
+// GetProblems lists problems one page at a time. It takes the filters q
+// (full-text search), difficulty, tag (repeatable, all must match) and
+// solved (needs a login), with sort, page and limit.
 func (h *ProblemHandler) GetProblems(c *gin.Context) {
-	problems, err := h.problemRepo.GetProblems(context.Background())
+	filter, err := parseProblemFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, loggedIn := c.Get("userID")
+	if filter.Solved != nil && !loggedIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Filtering by solved needs a login"})
+		return
+	}
+
+	if loggedIn {
+		filter.UserID = userID.(int)
+	}
+
+	problems, total, err := h.problemRepo.ListProblems(context.Background(), filter)
 	if err != nil {
 		logger.Log.Error("Failed to get problems", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve problems"})
 		return
 	}
 
-	if userID, exists := c.Get("userID"); exists {
+	if loggedIn {
 		solvedMap, err := h.problemRepo.GetSolvedProblemIDs(context.Background(), userID.(int))
 		if err != nil {
 			logger.Log.Warn("Failed to get solved problem IDs", zap.Error(err))
@@ -45,9 +69,24 @@ func (h *ProblemHandler) GetProblems(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"problems": problems,
+		"total":    total,
+		"page":     filter.Page,
+		"limit":    filter.Limit,
 	})
 }
 
+// GetTags lists the tags in use with their number of problems
+func (h *ProblemHandler) GetTags(c *gin.Context) {
+	tags, err := h.problemRepo.ListTags(context.Background())
+	if err != nil {
+		logger.Log.Error("Failed to get tags", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
 func (h *ProblemHandler) GetProblemByID(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -85,11 +124,91 @@ func (h *ProblemHandler) GetProblemByID(c *gin.Context) {
 	c.JSON(http.StatusOK, problem)
 }
 
+// GetAttachment serves an attachment of a problem's statement. Attachments
+// are keyed by content, so the blob key makes a strong ETag.
+func (h *ProblemHandler) GetAttachment(c *gin.Context) {
+	problemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+		return
+	}
+
+	attachment, data, err := h.problemRepo.GetAttachment(context.Background(), problemID, c.Param("name"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+			return
+		}
+
+		logger.Log.Error("Failed to get attachment",
+			zap.Int("problem_id", problemID),
+			zap.String("name", c.Param("name")),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve attachment"})
+		return
+	}
+
+	etag := `"` + attachment.BlobKey + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=300")
+	c.Header("X-Content-Type-Options", "nosniff")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, attachment.ContentType, data)
+}
+
 func (h *ProblemHandler) RegisterRoutes(router *gin.Engine, optionalAuthMiddleware gin.HandlerFunc) {
 	problemGroup := router.Group("/problems")
 	problemGroup.Use(optionalAuthMiddleware)
 	{
 		problemGroup.GET("", h.GetProblems)
+		problemGroup.GET("/tags", h.GetTags)
 		problemGroup.GET("/:id", h.GetProblemByID)
+		problemGroup.GET("/:id/attachments/:name", h.GetAttachment)
+	}
+}
+
+// parseProblemFilter reads the problem list filters from the query string
+func parseProblemFilter(c *gin.Context) (models.ProblemFilter, error) {
+	filter := models.ProblemFilter{
+		Search:     c.Query("q"),
+		Difficulty: c.Query("difficulty"),
+		Tags:       c.QueryArray("tag"),
+		Sort:       c.Query("sort"),
+	}
+
+	if value := c.Query("solved"); value != "" {
+		solved, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid solved: use true or false")
+		}
+		filter.Solved = &solved
+	}
+
+	intParams := []struct {
+		name   string
+		target *int
+	}{
+		{"page", &filter.Page},
+		{"limit", &filter.Limit},
+	}
+	for _, param := range intParams {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return filter, fmt.Errorf("invalid %s", param.name)
+		}
+		*param.target = n
+	}
+
+	if err := filter.Validate(); err != nil {
+		return filter, err
 	}
+	return filter, nil
 }
@@ -0,0 +1,683 @@
+package handlers
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/services"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Problem authoring endpoints, limited to admins and problem setters
+
+func (h *ProblemHandler) CreateProblem(c *gin.Context) {
+	var req models.ProblemRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+
+	problemID, err := h.problemRepo.CreateProblem(context.Background(), &req)
+	if err != nil {
+		h.authoringError(c, err, "Failed to create problem")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"problem_id": problemID})
+}
+
+func (h *ProblemHandler) UpdateProblem(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	var req models.ProblemRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+
+	if err := h.problemRepo.UpdateProblem(context.Background(), problemID, &req); err != nil {
+		h.authoringError(c, err, "Failed to update problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"problem_id": problemID})
+}
+
+func (h *ProblemHandler) DeleteProblem(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	if err := h.problemRepo.DeleteProblem(context.Background(), problemID); err != nil {
+		h.authoringError(c, err, "Failed to delete problem")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Problem deleted"})
+}
+
+// SetProblemTags replaces the tags of a problem
+func (h *ProblemHandler) SetProblemTags(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	var req models.TagsRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+
+	if err := h.problemRepo.SetProblemTags(context.Background(), problemID, req.Tags); err != nil {
+		h.authoringError(c, err, "Failed to set problem tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"problem_id": problemID, "tags": req.Tags})
+}
+
+// ListTestCases returns the draft test set if there is one, and the latest
+// published version otherwise. Test case changes go to the draft, which is
+// created from the latest version on the first change.
+func (h *ProblemHandler) ListTestCases(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	testSet, testCases, err := h.problemRepo.ListTestCases(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to retrieve test cases")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"test_set":   testSet,
+		"test_cases": testCases,
+		"count":      len(testCases),
+	})
+}
+
+func (h *ProblemHandler) CreateTestCase(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	var req models.TestCaseRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+
+	testCase, err := h.problemRepo.CreateTestCase(context.Background(), problemID, &req)
+	if err != nil {
+		h.authoringError(c, err, "Failed to create test case")
+		return
+	}
+
+	c.JSON(http.StatusCreated, testCase)
+}
+
+func (h *ProblemHandler) UpdateTestCase(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+	testCaseID, ok := positiveParam(c, "testCaseId", "Invalid test case ID")
+	if !ok {
+		return
+	}
+
+	var req models.TestCaseRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+
+	testCaseID, err := h.problemRepo.UpdateTestCase(context.Background(), problemID, testCaseID, &req)
+	if err != nil {
+		h.authoringError(c, err, "Failed to update test case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_case_id": testCaseID})
+}
+
+func (h *ProblemHandler) DeleteTestCase(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+	testCaseID, ok := positiveParam(c, "testCaseId", "Invalid test case ID")
+	if !ok {
+		return
+	}
+
+	if err := h.problemRepo.DeleteTestCase(context.Background(), problemID, testCaseID); err != nil {
+		h.authoringError(c, err, "Failed to delete test case")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Test case deleted"})
+}
+
+// ListTestSets returns the draft and published versions of a problem's tests
+func (h *ProblemHandler) ListTestSets(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	testSets, err := h.problemRepo.ListTestSets(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to retrieve test sets")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"test_sets": testSets,
+		"count":     len(testSets),
+	})
+}
+
+// PublishTestSet makes the draft the next version of the tests, the one new
+// submissions and rejudges are judged against
+func (h *ProblemHandler) PublishTestSet(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	version, err := h.problemRepo.PublishTestSet(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to publish test set")
+		return
+	}
+
+	logger.Log.Info("Test set published",
+		zap.Int("problem_id", problemID),
+		zap.Int("version", version))
+
+	c.JSON(http.StatusOK, gin.H{"problem_id": problemID, "version": version})
+}
+
+func (h *ProblemHandler) DiscardTestSetDraft(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	if err := h.problemRepo.DiscardTestSetDraft(context.Background(), problemID); err != nil {
+		h.authoringError(c, err, "Failed to discard draft test set")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Draft test set discarded"})
+}
+
+// ListPrograms returns the generators, reference solution and validator of a problem
+func (h *ProblemHandler) ListPrograms(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	programs, err := h.problemRepo.ListPrograms(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to retrieve programs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"programs": programs,
+		"count":    len(programs),
+	})
+}
+
+// SetProgram creates or replaces the program with the name in the path
+func (h *ProblemHandler) SetProgram(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	if err := models.ValidateProgramName(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req models.ProblemProgramRequest
+	if !bindAndValidate(c, &req, req.Validate) {
+		return
+	}
+	if _, _, err := services.GetLanguageConfig(req.LanguageID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported language"})
+		return
+	}
+
+	if err := h.problemRepo.SetProgram(context.Background(), problemID, name, &req); err != nil {
+		h.authoringError(c, err, "Failed to set program")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"problem_id": problemID, "name": name})
+}
+
+func (h *ProblemHandler) DeleteProgram(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	if err := h.problemRepo.DeleteProgram(context.Background(), problemID, c.Param("name")); err != nil {
+		h.authoringError(c, err, "Failed to delete program")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program deleted"})
+}
+
+// ListAttachments lists the statement attachments of a problem, each
+// served at its url
+func (h *ProblemHandler) ListAttachments(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	attachments, err := h.problemRepo.ListAttachments(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to retrieve attachments")
+		return
+	}
+
+	items := make([]gin.H, len(attachments))
+	for i, attachment := range attachments {
+		items[i] = gin.H{
+			"name":         attachment.Name,
+			"content_type": attachment.ContentType,
+			"size":         attachment.Size,
+			"updated_at":   attachment.UpdatedAt,
+			"url":          services.AttachmentURL(problemID, attachment.Name),
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attachments": items,
+		"count":       len(items),
+	})
+}
+
+// SetAttachment creates or replaces the attachment with the name in the
+// path from the "file" form file, which must be a PNG, JPEG, GIF or WebP
+// image
+func (h *ProblemHandler) SetAttachment(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+	name := c.Param("name")
+	if err := models.ValidateAttachmentName(name); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachment too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read attachment file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read attachment file"})
+		return
+	}
+	if _, err := models.AttachmentContentType(data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	attachment, err := h.problemRepo.SetAttachment(context.Background(), problemID, name, data)
+	if err != nil {
+		h.authoringError(c, err, "Failed to store attachment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":         attachment.Name,
+		"content_type": attachment.ContentType,
+		"size":         attachment.Size,
+		"url":          services.AttachmentURL(problemID, attachment.Name),
+	})
+}
+
+func (h *ProblemHandler) DeleteAttachment(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	if err := h.problemRepo.DeleteAttachment(context.Background(), problemID, c.Param("name")); err != nil {
+		h.authoringError(c, err, "Failed to delete attachment")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
+// GenerateTests queues a generator script for the workers, which run it in
+// the sandbox: they compute the expected outputs with the reference solution
+// and publish the tests as the next version. It answers 202 with the job,
+// whose progress is polled with GetTestGeneration.
+func (h *ProblemHandler) GenerateTests(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	var req models.GenerateTestsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	commands, err := req.Commands()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := h.problemRepo.GetProblemByID(context.Background(), problemID); err != nil {
+		h.authoringError(c, err, "Failed to generate tests")
+		return
+	}
+
+	job, err := h.generations.Start(context.Background(), problemID, len(commands), req.Script, req.KeepExisting)
+	if err != nil {
+		h.authoringError(c, err, "Failed to start test generation")
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/admin/problems/%d/testsets/generate/%s", problemID, job.ID))
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetTestGeneration reports the progress and outcome of a test generation job
+func (h *ProblemHandler) GetTestGeneration(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	job, err := h.generations.Get(context.Background(), problemID, c.Param("jobId"))
+	if err != nil {
+		h.authoringError(c, err, "Failed to get test generation")
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// GetProblemCode returns the starter code, system code and imports of a problem for one language
+func (h *ProblemHandler) GetProblemCode(c *gin.Context) {
+	problemID, languageID, ok := problemLanguageParams(c)
+	if !ok {
+		return
+	}
+
+	code, err := h.problemRepo.GetProblemCode(context.Background(), problemID, languageID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to retrieve problem code")
+		return
+	}
+
+	c.JSON(http.StatusOK, code)
+}
+
+// SetProblemCode replaces the starter code, system code or imports of a problem for one language
+func (h *ProblemHandler) SetProblemCode(c *gin.Context) {
+	problemID, languageID, ok := problemLanguageParams(c)
+	if !ok {
+		return
+	}
+	kind := c.Param("kind")
+	if !models.IsValidProblemCodeKind(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown code kind"})
+		return
+	}
+
+	var req models.ProblemCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if kind != models.ProblemCodeImports && strings.TrimSpace(req.Code) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code cannot be empty"})
+		return
+	}
+
+	if err := h.problemRepo.SetProblemCode(context.Background(), problemID, languageID, kind, req.Code); err != nil {
+		h.authoringError(c, err, "Failed to store problem code")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"problem_id":  problemID,
+		"language_id": languageID,
+		"kind":        kind,
+	})
+}
+
+func (h *ProblemHandler) DeleteProblemCode(c *gin.Context) {
+	problemID, languageID, ok := problemLanguageParams(c)
+	if !ok {
+		return
+	}
+	kind := c.Param("kind")
+	if !models.IsValidProblemCodeKind(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown code kind"})
+		return
+	}
+
+	if err := h.problemRepo.DeleteProblemCode(context.Background(), problemID, languageID, kind); err != nil {
+		h.authoringError(c, err, "Failed to delete problem code")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Problem code deleted"})
+}
+
+// ExportProblem downloads a problem with its tests and code as a zip package
+func (h *ProblemHandler) ExportProblem(c *gin.Context) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return
+	}
+
+	pkg, err := h.problemRepo.ExportProblem(context.Background(), problemID)
+	if err != nil {
+		h.authoringError(c, err, "Failed to export problem")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteProblemPackage(&buf, pkg); err != nil {
+		h.authoringError(c, err, "Failed to export problem")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="problem-%d.zip"`, problemID))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+// ImportProblem creates a new problem from a zip package uploaded as the
+// "package" form file. The "format" form field selects a Polygon or Kattis
+// package instead of one of this judge.
+func (h *ProblemHandler) ImportProblem(c *gin.Context) {
+	fileHeader, err := c.FormFile("package")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Package too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A package file is required"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read package file"})
+		return
+	}
+	defer file.Close()
+
+	pkg, warnings, err := services.ImportProblemPackage(c.PostForm("format"), file, fileHeader.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid package: " + err.Error()})
+		return
+	}
+
+	problemID, err := h.problemRepo.ImportProblem(context.Background(), pkg)
+	if err != nil {
+		h.authoringError(c, err, "Failed to import problem")
+		return
+	}
+
+	logger.Log.Info("Problem imported",
+		zap.Int("problem_id", problemID),
+		zap.Int("test_cases", len(pkg.TestCases)),
+		zap.Strings("warnings", warnings))
+
+	if warnings == nil {
+		warnings = []string{}
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"problem_id":  problemID,
+		"test_cases":  len(pkg.TestCases),
+		"languages":   len(pkg.Code),
+		"attachments": len(pkg.Attachments),
+		"warnings":    warnings,
+	})
+}
+
+// authoringError maps repository errors of the authoring endpoints to responses
+func (h *ProblemHandler) authoringError(c *gin.Context, err error, message string) {
+	if strings.Contains(err.Error(), "not found") {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.Contains(err.Error(), "has submissions") {
+		c.JSON(http.StatusConflict, gin.H{"error": "Problem has submissions and cannot be deleted"})
+		return
+	}
+	if strings.Contains(err.Error(), "already has a") {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if strings.Contains(err.Error(), "has no test cases") {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	logger.Log.Error(message,
+		zap.String("path", c.FullPath()),
+		zap.Error(err))
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// bindAndValidate binds the JSON body and runs its validation, writing a 400
+// response and returning false when either fails.
+func bindAndValidate(c *gin.Context, req interface{}, validate func() error) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	return true
+}
+
+func positiveParam(c *gin.Context, name, message string) (int, bool) {
+	value, err := strconv.Atoi(c.Param(name))
+	if err != nil || value <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return value, true
+}
+
+func problemLanguageParams(c *gin.Context) (int, int, bool) {
+	problemID, ok := positiveParam(c, "id", "Invalid problem ID")
+	if !ok {
+		return 0, 0, false
+	}
+	languageID, ok := positiveParam(c, "languageId", "Invalid language ID")
+	if !ok {
+		return 0, 0, false
+	}
+	if _, _, err := services.GetLanguageConfig(languageID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unsupported language"})
+		return 0, 0, false
+	}
+	return problemID, languageID, true
+}
+
+func (h *ProblemHandler) RegisterAdminRoutes(router *gin.Engine, authMiddleware, authorMiddleware gin.HandlerFunc) {
+	adminGroup := router.Group("/admin/problems")
+	adminGroup.Use(authMiddleware, authorMiddleware)
+	{
+		adminGroup.POST("", h.CreateProblem)
+		adminGroup.POST("/import", h.ImportProblem)
+		adminGroup.GET("/:id/export", h.ExportProblem)
+		adminGroup.PUT("/:id", h.UpdateProblem)
+		adminGroup.DELETE("/:id", h.DeleteProblem)
+		adminGroup.PUT("/:id/tags", h.SetProblemTags)
+
+		adminGroup.GET("/:id/testcases", h.ListTestCases)
+		adminGroup.POST("/:id/testcases", h.CreateTestCase)
+		adminGroup.PUT("/:id/testcases/:testCaseId", h.UpdateTestCase)
+		adminGroup.DELETE("/:id/testcases/:testCaseId", h.DeleteTestCase)
+		adminGroup.GET("/:id/testsets", h.ListTestSets)
+		adminGroup.POST("/:id/testsets/publish", h.PublishTestSet)
+		adminGroup.DELETE("/:id/testsets/draft", h.DiscardTestSetDraft)
+		adminGroup.POST("/:id/testsets/generate", h.GenerateTests)
+		adminGroup.GET("/:id/testsets/generate/:jobId", h.GetTestGeneration)
+
+		adminGroup.GET("/:id/programs", h.ListPrograms)
+		adminGroup.PUT("/:id/programs/:name", h.SetProgram)
+		adminGroup.DELETE("/:id/programs/:name", h.DeleteProgram)
+
+		adminGroup.GET("/:id/attachments", h.ListAttachments)
+		adminGroup.PUT("/:id/attachments/:name", h.SetAttachment)
+		adminGroup.DELETE("/:id/attachments/:name", h.DeleteAttachment)
+
+		adminGroup.GET("/:id/languages/:languageId", h.GetProblemCode)
+		adminGroup.PUT("/:id/languages/:languageId/:kind", h.SetProblemCode)
+		adminGroup.DELETE("/:id/languages/:languageId/:kind", h.DeleteProblemCode)
+	}
+}
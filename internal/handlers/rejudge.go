@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type RejudgeHandler struct {
+	rejudgeRepo repositories.RejudgeRepository
+}
+
+func NewRejudgeHandler(rejudgeRepo repositories.RejudgeRepository) *RejudgeHandler {
+	return &RejudgeHandler{
+		rejudgeRepo: rejudgeRepo,
+	}
+}
+
+func (h *RejudgeHandler) RejudgeSubmission(c *gin.Context) {
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || submissionID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	h.startRejudge(c, &models.Rejudge{
+		Scope:        models.RejudgeScopeSubmission,
+		SubmissionID: &submissionID,
+	})
+}
+
+func (h *RejudgeHandler) RejudgeProblem(c *gin.Context) {
+	problemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || problemID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+		return
+	}
+
+	h.startRejudge(c, &models.Rejudge{
+		Scope:     models.RejudgeScopeProblem,
+		ProblemID: &problemID,
+	})
+}
+
+func (h *RejudgeHandler) RejudgeTimeRange(c *gin.Context) {
+	var req models.RejudgeTimeRangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.startRejudge(c, &models.Rejudge{
+		Scope:     models.RejudgeScopeTimeRange,
+		ProblemID: req.ProblemID,
+		FromTime:  &req.From,
+		ToTime:    &req.To,
+	})
+}
+
+// startRejudge resets the submissions in scope; the outbox relay queues them on the rejudge lane
+func (h *RejudgeHandler) startRejudge(c *gin.Context, rejudge *models.Rejudge) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	rejudge.RequestedBy = userID.(int)
+
+	if err := h.rejudgeRepo.CreateRejudge(context.Background(), rejudge); err != nil {
+		if strings.Contains(err.Error(), "no finished submissions") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No finished submissions to rejudge"})
+			return
+		}
+		logger.Log.Error("Failed to create rejudge",
+			zap.String("scope", rejudge.Scope),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start rejudge"})
+		return
+	}
+
+	logger.Log.Info("Rejudge started",
+		zap.Int("rejudge_id", rejudge.ID),
+		zap.String("scope", rejudge.Scope),
+		zap.Int("total", rejudge.Total))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"rejudge_id": rejudge.ID,
+		"total":      rejudge.Total,
+	})
+}
+
+func (h *RejudgeHandler) GetRejudge(c *gin.Context) {
+	rejudgeID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rejudge ID"})
+		return
+	}
+
+	report, err := h.rejudgeRepo.GetRejudgeReport(context.Background(), rejudgeID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rejudge not found"})
+			return
+		}
+		logger.Log.Error("Failed to get rejudge report",
+			zap.Int("rejudge_id", rejudgeID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rejudge"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+func (h *RejudgeHandler) RegisterRoutes(router *gin.Engine, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(authMiddleware, adminMiddleware)
+	{
+		adminGroup.POST("/submissions/:id/rejudge", h.RejudgeSubmission)
+		adminGroup.POST("/problems/:id/rejudge", h.RejudgeProblem)
+		adminGroup.POST("/rejudges", h.RejudgeTimeRange)
+		adminGroup.GET("/rejudges/:id", h.GetRejudge)
+	}
+}
@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// StatusHandler serves the public status page of recent submissions of all users
+type StatusHandler struct {
+	codeRepo    repositories.CodeRepository
+	problemRepo repositories.ProblemRepository
+}
+
+func NewStatusHandler(codeRepo repositories.CodeRepository, problemRepo repositories.ProblemRepository) *StatusHandler {
+	return &StatusHandler{
+		codeRepo:    codeRepo,
+		problemRepo: problemRepo,
+	}
+}
+
+// GetStatus lists recent submissions with the same filters and cursor as GET /submissions
+func (h *StatusHandler) GetStatus(c *gin.Context) {
+	filter, err := parseSubmissionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit := filter.Limit
+	filter.Limit++
+
+	entries, err := h.codeRepo.ListStatus(context.Background(), filter)
+	if err != nil {
+		logger.Log.Error("Failed to list status", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve status"})
+		return
+	}
+
+	nextCursor := ""
+	if len(entries) > limit {
+		entries = entries[:limit]
+		nextCursor = strconv.Itoa(entries[limit-1].ID)
+	}
+
+	viewerID, solved := h.viewer(c)
+	for i := range entries {
+		entries[i].LanguageName = getLanguageName(entries[i].LanguageID)
+		entries[i].SourceVisible = canViewSource(&entries[i], viewerID, solved)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"submissions": entries,
+		"count":       len(entries),
+		"next_cursor": nextCursor,
+	})
+}
+
+// GetStatusEntry returns one submission of the status page, with its source
+// code if the viewer may read it.
+func (h *StatusHandler) GetStatusEntry(c *gin.Context) {
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	detail, err := h.codeRepo.GetStatusDetail(context.Background(), submissionID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found"})
+			return
+		}
+		logger.Log.Error("Failed to get status entry",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submission"})
+		return
+	}
+
+	viewerID, solved := h.viewer(c)
+	detail.LanguageName = getLanguageName(detail.LanguageID)
+	detail.SourceVisible = canViewSource(&detail.StatusEntry, viewerID, solved)
+	if !detail.SourceVisible {
+		detail.SourceCode = nil
+	}
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// GetSharedSubmission returns the code and verdict of a submission its owner
+// shared by link. The token is the only credential needed.
+func (h *StatusHandler) GetSharedSubmission(c *gin.Context) {
+	detail, err := h.codeRepo.GetSharedSubmission(context.Background(), c.Param("token"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Shared submission not found"})
+			return
+		}
+		logger.Log.Error("Failed to get shared submission", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submission"})
+		return
+	}
+
+	detail.LanguageName = getLanguageName(detail.LanguageID)
+	detail.SourceVisible = true
+
+	c.JSON(http.StatusOK, detail)
+}
+
+// viewer returns the logged-in viewer, if any, and the problems they solved
+func (h *StatusHandler) viewer(c *gin.Context) (int, map[int]bool) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		return 0, nil
+	}
+
+	solved, err := h.problemRepo.GetSolvedProblemIDs(context.Background(), userID.(int))
+	if err != nil {
+		// Fall back to showing only public code
+		logger.Log.Warn("Failed to get solved problems",
+			zap.Any("user_id", userID),
+			zap.Error(err))
+		return userID.(int), nil
+	}
+
+	return userID.(int), solved
+}
+
+// canViewSource reports whether the viewer may read the code of a submission:
+// their own, a public one, or a shared one of a problem they solved. Private
+// submissions stay private even to solvers.
+func canViewSource(entry *models.StatusEntry, viewerID int, solved map[int]bool) bool {
+	if entry.Visibility == models.VisibilityPublic {
+		return true
+	}
+	if viewerID == 0 {
+		return false
+	}
+	if entry.UserID == viewerID {
+		return true
+	}
+	return entry.Visibility == models.VisibilityLink && solved[entry.ProblemID]
+}
+
+func (h *StatusHandler) RegisterRoutes(router *gin.Engine, optionalAuthMiddleware gin.HandlerFunc) {
+	statusGroup := router.Group("/status")
+	statusGroup.Use(optionalAuthMiddleware)
+	{
+		statusGroup.GET("", h.GetStatus)
+		statusGroup.GET("/:id", h.GetStatusEntry)
+	}
+
+	router.GET("/shared/:token", h.GetSharedSubmission)
+}
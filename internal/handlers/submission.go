@@ -4,26 +4,46 @@ import (
 	"HAB/internal/logger"
 	"HAB/internal/models"
 	"HAB/internal/repositories"
+	"HAB/internal/services"
+	"HAB/internal/utils"
 	"context"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+// backlogRetryAfter is suggested to clients while the judge queue is full
+const backlogRetryAfter = 30 * time.Second
+
 type SubmissionHandler struct {
-	codeRepo repositories.CodeRepository
-	redis    *redis.Client
+	codeRepo   repositories.CodeRepository
+	queue      *services.SubmissionQueue
+	events     *services.SubmissionEvents
+	hub        *services.UserEventHub
+	numWorkers int // used to estimate waiting times
+	maxBacklog int // new submissions are rejected above this many waiting jobs, 0 disables
 }
 
-func NewSubmissionHandler(codeRepo repositories.CodeRepository, redis *redis.Client) *SubmissionHandler {
+func NewSubmissionHandler(codeRepo repositories.CodeRepository, queue *services.SubmissionQueue, events *services.SubmissionEvents,
+	hub *services.UserEventHub, numWorkers int, maxBacklog int) *SubmissionHandler {
+	if numWorkers <= 0 {
+		numWorkers = 1
+	}
+
 	return &SubmissionHandler{
-		codeRepo: codeRepo,
-		redis:    redis,
+		codeRepo:   codeRepo,
+		queue:      queue,
+		events:     events,
+		hub:        hub,
+		numWorkers: numWorkers,
+		maxBacklog: maxBacklog,
 	}
 }
 
@@ -45,43 +65,85 @@ func (h *SubmissionHandler) CreateSubmission(c *gin.Context) {
 		return
 	}
 
+	if err := services.CheckSubmissionSource(req.LanguageID, req.SourceCode); err != nil {
+		if strings.Contains(err.Error(), "exceeds") {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lane := services.LaneNormal
+	if req.Lane != "" {
+		parsed, err := services.ParseLane(req.Lane)
+		if err != nil || !parsed.UserSelectable() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid queue lane"})
+			return
+		}
+		lane = parsed
+	}
+
+	if h.queueFull(c.Request.Context()) {
+		c.Header("Retry-After", strconv.Itoa(int(backlogRetryAfter.Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":       "The judge is busy, please try again later",
+			"retry_after": int(backlogRetryAfter.Seconds()),
+		})
+		return
+	}
+
 	submission := models.Submission{
 		UserID:     userID.(int),
 		ProblemID:  req.ProblemID,
 		LanguageID: req.LanguageID,
 		SourceCode: req.SourceCode,
-		Status:     models.StatusProcessing,
+		Status:     models.StatusPending,
 	}
 
-	if err := h.codeRepo.CreateSubmission(context.Background(), &submission); err != nil {
+	// The outbox relay queues the submission once it is stored
+	if err := h.codeRepo.CreateSubmission(context.Background(), &submission, lane); err != nil {
 		logger.Log.Error("Failed to create submission", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process submission"})
 		return
 	}
 
-	err := h.redis.XAdd(context.Background(), &redis.XAddArgs{
-		Stream: "code_submissions",
-		ID:     "*", // Auto-generate ID
-		Values: map[string]interface{}{
-			"submission_id": submission.ID,
-		},
-	}).Err()
-
-	if err != nil {
-		logger.Log.Error("Failed to add submission to Redis stream",
-			zap.Int("submission_id", submission.ID),
-			zap.Error(err))
-
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue submission"})
-		return
-	}
+	h.publishEvent(services.SubmissionEvent{
+		SubmissionID: submission.ID,
+		UserID:       submission.UserID,
+		Stage:        services.StageQueued,
+		Status:       submission.Status,
+	})
 
 	c.JSON(http.StatusAccepted, gin.H{
 		"message":       "Submission queued for processing",
 		"submission_id": submission.ID,
+		"lane":          lane,
 	})
 }
 
+// queueFull reports whether the judge queue is too backed up to take new submissions
+func (h *SubmissionHandler) queueFull(ctx context.Context) bool {
+	if h.maxBacklog <= 0 {
+		return false
+	}
+
+	backlog, err := h.queue.Backlog(ctx)
+	if err != nil {
+		// Enqueueing will fail on its own if Redis is really gone
+		logger.Log.Warn("Failed to get queue backlog", zap.Error(err))
+		return false
+	}
+
+	if backlog >= h.maxBacklog {
+		logger.Log.Warn("Rejecting submission, judge queue is full",
+			zap.Int("backlog", backlog),
+			zap.Int("max_backlog", h.maxBacklog))
+		return true
+	}
+	return false
+}
+
 func (h *SubmissionHandler) GetSubmission(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -122,9 +184,16 @@ func (h *SubmissionHandler) GetSubmission(c *gin.Context) {
 		"source_code": submission.SourceCode,
 	}
 
+	if submission.FailedTest != nil {
+		response["failed_test"] = submission.FailedTest
+	}
+
+	// Only visible tests have their data set
 	if submission.Status == models.StatusWrongAnswer && submission.WrongTestcase != nil {
 		response["wrong_testcase"] = *submission.WrongTestcase
-		response["expected_output"] = *submission.ExpectedOutput
+		if submission.ExpectedOutput != nil {
+			response["expected_output"] = *submission.ExpectedOutput
+		}
 	}
 
 	if submission.ProgramOutput != nil &&
@@ -133,41 +202,538 @@ func (h *SubmissionHandler) GetSubmission(c *gin.Context) {
 		response["program_output"] = *submission.ProgramOutput
 	}
 
+	if submission.Status == models.StatusPending {
+		h.addQueueEstimate(response, submissionID)
+	}
+
 	c.JSON(http.StatusOK, response)
 }
 
-func (h *SubmissionHandler) GetUserSubmissions(c *gin.Context) {
-
-	problemIDStr := c.Query("problem_id")
+// addQueueEstimate adds the queue position and estimated waiting time of a
+// pending submission to the response. The estimate is best effort, so
+// failures are only logged.
+func (h *SubmissionHandler) addQueueEstimate(response gin.H, submissionID int) {
+	position, queued, err := h.queue.Position(context.Background(), submissionID)
+	if err != nil {
+		logger.Log.Warn("Failed to get queue position",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		return
+	}
+	if !queued {
+		return
+	}
+	response["queue_position"] = position.Position
+	if position.Approximate {
+		response["queue_position_approximate"] = true
+	}
 
-	if problemIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "problem_id query parameter is required"})
+	average, err := h.queue.AverageJudgeDuration(context.Background())
+	if err != nil {
+		logger.Log.Warn("Failed to get average judge duration", zap.Error(err))
 		return
 	}
 
+	// Jobs ahead are spread over all workers; the submission itself needs one more judge run
+	wait := time.Duration(position.Position-1)*average/time.Duration(h.numWorkers) + average
+	response["estimated_wait_seconds"] = int(math.Ceil(wait.Seconds()))
+}
+
+// GetUserSubmissions lists the user's submissions, newest first, one page at
+// a time. Pass the returned next_cursor as ?cursor= to get the next page.
+func (h *SubmissionHandler) GetUserSubmissions(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	problemID, err := strconv.Atoi(problemIDStr)
-	if err != nil || problemID <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid problem ID"})
+	filter, err := parseSubmissionFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	ownerID := userID.(int)
+	filter.UserID = &ownerID
 
-	submissions, err := h.codeRepo.GetSubmissionsByUserAndProblem(context.Background(), userID.(int), problemID)
+	page, err := listSubmissionPage(context.Background(), h.codeRepo, filter)
 	if err != nil {
 		logger.Log.Error("Failed to get user submissions",
-			zap.Int("user_id", userID.(int)),
-			zap.Int("problem_id", problemID),
+			zap.Int("user_id", ownerID),
 			zap.Error(err))
 
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submission history"})
 		return
 	}
 
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *SubmissionHandler) GetJudgements(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	judgements, err := h.codeRepo.GetJudgements(context.Background(), submissionID, userID.(int))
+	if err != nil {
+		logger.Log.Error("Failed to get judgements",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve judgement history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"judgements": judgements,
+		"count":      len(judgements),
+	})
+}
+
+func (h *SubmissionHandler) CancelSubmission(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	if err := h.codeRepo.CancelSubmission(context.Background(), submissionID, userID.(int)); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or access denied"})
+			return
+		}
+		if strings.Contains(err.Error(), "already finished") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Submission has already finished"})
+			return
+		}
+		if strings.Contains(err.Error(), "being rejudged") {
+			c.JSON(http.StatusConflict, gin.H{"error": "Submission is being rejudged and cannot be cancelled"})
+			return
+		}
+		logger.Log.Error("Failed to cancel submission",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel submission"})
+		return
+	}
+
+	// The submission is already marked as cancelled, so workers skip it even
+	// if removing it from the queue or notifying them fails.
+	removed, err := h.queue.Remove(context.Background(), submissionID)
+	if err != nil {
+		logger.Log.Warn("Failed to remove cancelled submission from queue",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+	}
+
+	// The job may already have been read by a worker, so always signal it
+	if err := h.queue.PublishCancellation(context.Background(), submissionID); err != nil {
+		logger.Log.Warn("Failed to notify workers of cancelled submission",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+	}
+
+	h.publishEvent(services.SubmissionEvent{
+		SubmissionID: submissionID,
+		UserID:       userID.(int),
+		Stage:        services.StageFinished,
+		Status:       models.StatusCancelled,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Submission cancelled",
+		"submission_id":      submissionID,
+		"removed_from_queue": removed,
+	})
+}
+
+// SetVisibility lets the owner share a submission by link or publish it on the status page
+func (h *SubmissionHandler) SetVisibility(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	var req models.VisibilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	shareToken, err := h.codeRepo.SetVisibility(context.Background(), submissionID, userID.(int), req.Visibility)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or access denied"})
+			return
+		}
+		logger.Log.Error("Failed to set submission visibility",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update submission"})
+		return
+	}
+
+	response := gin.H{
+		"submission_id": submissionID,
+		"visibility":    req.Visibility,
+	}
+	if shareToken != "" {
+		response["share_token"] = shareToken
+		response["share_path"] = "/shared/" + shareToken
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// diffContextLines is the number of unchanged lines shown around each change
+const diffContextLines = 3
+
+// GetDiff returns a unified line diff of the source code of two submissions
+// the user can view, from :id to :other.
+func (h *SubmissionHandler) GetDiff(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	fromID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+	toID, err := strconv.Atoi(c.Param("other"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	var submissions [2]*models.StatusDetail
+	for i, submissionID := range []int{fromID, toID} {
+		submission, err := h.viewableSubmission(context.Background(), submissionID, userID.(int))
+		if err != nil {
+			if strings.Contains(err.Error(), "not found") {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or access denied"})
+				return
+			}
+			logger.Log.Error("Failed to get submission to diff",
+				zap.Int("submission_id", submissionID),
+				zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute diff"})
+			return
+		}
+		submissions[i] = submission
+	}
+	from, to := submissions[0], submissions[1]
+
+	lines := utils.DiffLines(utils.SplitLines(*from.SourceCode), utils.SplitLines(*to.SourceCode))
+	added, removed := 0, 0
+	for _, line := range lines {
+		switch line.Op {
+		case utils.DiffInsert:
+			added++
+		case utils.DiffDelete:
+			removed++
+		}
+	}
+
+	diff := utils.FormatUnifiedDiff(
+		fmt.Sprintf("submission %d (%s)", from.ID, from.Status),
+		fmt.Sprintf("submission %d (%s)", to.ID, to.Status),
+		lines, diffContextLines)
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      gin.H{"id": from.ID, "status": from.Status, "submitted_at": from.SubmittedAt},
+		"to":        gin.H{"id": to.ID, "status": to.Status, "submitted_at": to.SubmittedAt},
+		"diff":      diff,
+		"added":     added,
+		"removed":   removed,
+		"identical": added == 0 && removed == 0,
+	})
+}
+
+// viewableSubmission returns a submission with its source code if the user
+// may read it: their own, a public one, or a shared one of a problem they
+// solved. Private submissions stay private even to solvers.
+func (h *SubmissionHandler) viewableSubmission(ctx context.Context, submissionID, userID int) (*models.StatusDetail, error) {
+	submission, err := h.codeRepo.GetStatusDetail(ctx, submissionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if submission.UserID == userID || submission.Visibility == models.VisibilityPublic {
+		return submission, nil
+	}
+	if submission.Visibility != models.VisibilityLink {
+		return nil, fmt.Errorf("submission not found or access denied: %d", submissionID)
+	}
+
+	solved, err := h.codeRepo.HasSolvedProblem(ctx, userID, submission.ProblemID)
+	if err != nil {
+		return nil, err
+	}
+	if !solved {
+		return nil, fmt.Errorf("submission not found or access denied: %d", submissionID)
+	}
+
+	return submission, nil
+}
+
+// StreamSubmissionEvents streams the status transitions of a submission over
+// Server-Sent Events until it reaches a final verdict.
+func (h *SubmissionHandler) StreamSubmissionEvents(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	submissionID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid submission ID"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	viewerID := userID.(int)
+
+	// Subscribe, and note where the user's events stand, before reading the
+	// status, so no transition is missed in between. Events come through the
+	// hub, which follows every user's events on a single connection.
+	sub := h.hub.Subscribe(viewerID)
+	defer func() { sub.Close() }()
+
+	lastID, err := h.events.LastUserEventID(ctx, viewerID)
+	if err != nil {
+		logger.Log.Error("Failed to get last user event",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stream submission status"})
+		return
+	}
+
+	submission, err := h.codeRepo.GetSubmissionByID(ctx, submissionID, viewerID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "access denied") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Submission not found or access denied"})
+			return
+		}
+		logger.Log.Error("Failed to get submission",
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve submission details"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	current := services.SubmissionEvent{
+		SubmissionID: submissionID,
+		UserID:       viewerID,
+		Stage:        services.StageQueued,
+		Status:       submission.Status,
+		Time:         time.Now(),
+	}
+	if submission.Status == models.StatusProcessing {
+		current.Stage = services.StageRunning
+	}
+	if models.IsFinalStatus(submission.Status) {
+		current.Stage = services.StageFinished
+	}
+	c.SSEvent("status", current)
+	c.Writer.Flush()
+	if current.Stage == services.StageFinished {
+		return
+	}
+
+	// send writes the events of this submission newer than those seen, and
+	// reports whether to keep streaming
+	send := func(event services.UserEvent) bool {
+		if !services.StreamIDAfter(event.ID, lastID) {
+			return true
+		}
+		lastID = event.ID
+		if event.Event.SubmissionID != submissionID {
+			return true
+		}
+		c.SSEvent("status", event.Event)
+		return event.Event.Stage != services.StageFinished
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case event, ok := <-sub.Events:
+			if ok {
+				return send(event)
+			}
+			// Dropped for falling behind: start over from the user's stream
+			sub = h.hub.Subscribe(viewerID)
+			for {
+				missed, err := h.events.UserEventsAfter(ctx, viewerID, lastID, liveCatchUpBatch)
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Log.Error("Failed to read user events",
+							zap.Int("submission_id", submissionID),
+							zap.Error(err))
+					}
+					return false
+				}
+				for _, event := range missed {
+					if !send(event) {
+						return false
+					}
+				}
+				if len(missed) < liveCatchUpBatch {
+					return true
+				}
+			}
+		}
+	})
+}
+
+// publishEvent reports a status transition to clients. The stored status
+// stays authoritative, so failures are only logged.
+func (h *SubmissionHandler) publishEvent(event services.SubmissionEvent) {
+	if err := h.events.Publish(context.Background(), event); err != nil {
+		logger.Log.Warn("Failed to publish submission event",
+			zap.Int("submission_id", event.SubmissionID),
+			zap.Error(err))
+	}
+}
+
+// parseSubmissionFilter reads the listing filters from the query string:
+// problem_id, language_id, status, from and to (RFC 3339 or YYYY-MM-DD, to
+// being inclusive for dates), cursor and limit.
+func parseSubmissionFilter(c *gin.Context) (models.SubmissionFilter, error) {
+	var filter models.SubmissionFilter
+
+	intParams := []struct {
+		name   string
+		target **int
+	}{
+		{"problem_id", &filter.ProblemID},
+		{"language_id", &filter.LanguageID},
+	}
+	for _, param := range intParams {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			return filter, fmt.Errorf("invalid %s", param.name)
+		}
+		*param.target = &id
+	}
+
+	filter.Status = strings.ToUpper(c.Query("status"))
+
+	if value := c.Query("from"); value != "" {
+		from, _, err := parseFilterTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: use RFC 3339 or YYYY-MM-DD")
+		}
+		filter.From = &from
+	}
+	if value := c.Query("to"); value != "" {
+		to, dateOnly, err := parseFilterTime(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: use RFC 3339 or YYYY-MM-DD")
+		}
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.To = &to
+	}
+
+	if value := c.Query("cursor"); value != "" {
+		cursor, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid cursor")
+		}
+		filter.Cursor = cursor
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = limit
+	}
+
+	if err := filter.Validate(); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func parseFilterTime(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	return t, true, err
+}
+
+// submissionPage is one page of a submission listing. NextCursor is empty on the last page.
+type submissionPage struct {
+	Submissions []models.SubmissionListItem `json:"submissions"`
+	Count       int                         `json:"count"`
+	NextCursor  string                      `json:"next_cursor"`
+}
+
+// listSubmissionPage fetches one page of submissions and the cursor of the next one
+func listSubmissionPage(ctx context.Context, codeRepo repositories.CodeRepository, filter models.SubmissionFilter) (*submissionPage, error) {
+	limit := filter.Limit
+	// One extra row tells whether there is a next page
+	filter.Limit++
+
+	submissions, err := codeRepo.ListSubmissions(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	nextCursor := ""
+	if len(submissions) > limit {
+		submissions = submissions[:limit]
+		nextCursor = strconv.Itoa(submissions[limit-1].ID)
+	}
+
 	for i := range submissions {
 		gmt7Time := submissions[i].SubmittedAt.Add(7 * time.Hour)
 		submissions[i].FormattedTime = gmt7Time.Format("02/01/2006 3:04 PM")
@@ -175,10 +741,11 @@ func (h *SubmissionHandler) GetUserSubmissions(c *gin.Context) {
 		submissions[i].LanguageName = getLanguageName(submissions[i].LanguageID)
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"submissions": submissions,
-		"count":       len(submissions),
-	})
+	return &submissionPage{
+		Submissions: submissions,
+		Count:       len(submissions),
+		NextCursor:  nextCursor,
+	}, nil
 }
 
 func getLanguageName(languageID int) string {
@@ -192,12 +759,17 @@ func getLanguageName(languageID int) string {
 	}
 }
 
-func (h *SubmissionHandler) RegisterRoutes(router *gin.Engine, authMiddleware gin.HandlerFunc) {
+func (h *SubmissionHandler) RegisterRoutes(router *gin.Engine, authMiddleware, submitRateLimit gin.HandlerFunc) {
 	submissionGroup := router.Group("/submissions")
 	submissionGroup.Use(authMiddleware)
 	{
-		submissionGroup.POST("", h.CreateSubmission)
+		submissionGroup.POST("", submitRateLimit, h.CreateSubmission)
 		submissionGroup.GET("/:id", h.GetSubmission)
+		submissionGroup.DELETE("/:id", h.CancelSubmission)
+		submissionGroup.PATCH("/:id/visibility", h.SetVisibility)
+		submissionGroup.GET("/:id/judgements", h.GetJudgements)
+		submissionGroup.GET("/:id/diff/:other", h.GetDiff)
+		submissionGroup.GET("/:id/events", h.StreamSubmissionEvents)
 		submissionGroup.GET("", h.GetUserSubmissions)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"HAB/internal/utils"
 	"context"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,12 +18,14 @@ import (
 
 type AuthHandler struct {
 	userRepo     repositories.UserRepository
+	codeRepo     repositories.CodeRepository
 	tokenService *services.TokenService
 }
 
-func NewAuthHandler(userRepo repositories.UserRepository, tokenService *services.TokenService) *AuthHandler {
+func NewAuthHandler(userRepo repositories.UserRepository, codeRepo repositories.CodeRepository, tokenService *services.TokenService) *AuthHandler {
 	return &AuthHandler{
 		userRepo:     userRepo,
+		codeRepo:     codeRepo,
 		tokenService: tokenService,
 	}
 }
@@ -64,7 +67,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	accessToken, refreshToken, err := h.tokenService.GenerateTokens(user.ID, user.Username, user.Email)
+	accessToken, refreshToken, err := h.tokenService.GenerateTokens(user.ID, user.Username, user.Email, user.Role)
 	if err != nil {
 		logger.Log.Error("Failed to generate tokens", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
@@ -101,13 +104,14 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 func (h *AuthHandler) Verify(c *gin.Context) {
 	accessToken, err := c.Cookie("access_token")
 	if err == nil {
-		claims, err := h.tokenService.ValidateToken(accessToken)
+		claims, err := h.tokenService.ValidateToken(accessToken, services.TokenTypeAccess)
 		if err == nil {
 			c.JSON(http.StatusOK, gin.H{
 				"is_authenticated": true,
 				"user_id":          claims.UserID,
 				"username":         claims.Username,
 				"email":            claims.Email,
+				"role":             claims.Role,
 			})
 			return
 		}
@@ -126,14 +130,26 @@ func (h *AuthHandler) Verify(c *gin.Context) {
 	}
 
 	// Validate refresh token signature
-	claims, err := h.tokenService.ValidateToken(refreshToken)
+	claims, err := h.tokenService.ValidateToken(refreshToken, services.TokenTypeRefresh)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"is_authenticated": false, "error": "Invalid token"})
 		return
 	}
 
-	// No need to fetch user data again, as it's in the claims
-	newAccessToken, _, err := h.tokenService.GenerateTokens(claims.UserID, claims.Username, claims.Email)
+	// Refresh tokens carry no role, it is read again so role changes apply from the next refresh
+	user, err := h.userRepo.GetUserByID(context.Background(), claims.UserID)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusUnauthorized, gin.H{"is_authenticated": false, "error": "Invalid session"})
+			return
+		}
+		logger.Log.Error("Failed to get user role during verify", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"is_authenticated": false, "error": "Could not refresh session"})
+		return
+	}
+	role := user.Role
+
+	newAccessToken, _, err := h.tokenService.GenerateTokens(claims.UserID, claims.Username, claims.Email, role)
 	if err != nil {
 		logger.Log.Error("Failed to generate new access token during verify", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"is_authenticated": false, "error": "Could not refresh session"})
@@ -146,6 +162,7 @@ func (h *AuthHandler) Verify(c *gin.Context) {
 		"user_id":          claims.UserID,
 		"username":         claims.Username,
 		"email":            claims.Email,
+		"role":             role,
 	})
 }
 
@@ -156,7 +173,8 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	userInfo, err := h.userRepo.GetUserInfo(context.Background(), userID.(int))
+	userIDInt := userID.(int)
+	userInfo, err := h.userRepo.GetUserInfo(context.Background(), userIDInt)
 	if err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -167,23 +185,82 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	// Populate derived fields for submissions
-	for i := range userInfo.Submissions {
-		gmt7Time := userInfo.Submissions[i].SubmittedAt.Add(7 * time.Hour)
-		userInfo.Submissions[i].FormattedTime = gmt7Time.Format("02/01/2006 3:04PM")
-		userInfo.Submissions[i].LanguageName = getLanguageName(userInfo.Submissions[i].LanguageID)
+	// Only the latest submissions; the rest is paged through GET /submissions
+	page, err := listSubmissionPage(context.Background(), h.codeRepo, models.SubmissionFilter{
+		UserID: &userIDInt,
+		Limit:  models.DefaultSubmissionPageSize,
+	})
+	if err != nil {
+		logger.Log.Error("Failed to get user submissions", zap.Error(err), zap.Any("user_id", userID))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user profile"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"username":    userInfo.Username,
 		"email":       userInfo.Email,
+		"role":        userInfo.Role,
 		"created_at":  userInfo.CreatedAt.Format("02/01/2006 3:04PM"),
-		"submissions": userInfo.Submissions,
+		"submissions": page.Submissions,
+		"next_cursor": page.NextCursor,
 	})
 }
 
-func (h *AuthHandler) RegisterRoutes(router *gin.Engine) {
+// SetUserRole changes the role of a user. It applies to the user's next
+// login or session refresh, at most an hour later.
+func (h *AuthHandler) SetUserRole(c *gin.Context) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || targetID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if userID, _ := c.Get("userID"); userID == targetID && req.Role != models.RoleAdmin {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins cannot demote themselves"})
+		return
+	}
+
+	if err := h.userRepo.SetUserRole(context.Background(), targetID, req.Role); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		logger.Log.Error("Failed to set user role", zap.Int("user_id", targetID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
+		return
+	}
+
+	logger.Log.Info("User role changed",
+		zap.Int("user_id", targetID),
+		zap.String("role", req.Role))
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": targetID,
+		"role":    req.Role,
+	})
+}
+
+func (h *AuthHandler) RegisterAdminRoutes(router *gin.Engine, authMiddleware, adminMiddleware gin.HandlerFunc) {
+	adminGroup := router.Group("/admin/users")
+	adminGroup.Use(authMiddleware, adminMiddleware)
+	{
+		adminGroup.PUT("/:id/role", h.SetUserRole)
+	}
+}
+
+func (h *AuthHandler) RegisterRoutes(router *gin.Engine, rateLimit gin.HandlerFunc) {
 	authGroup := router.Group("/auth")
+	authGroup.Use(rateLimit)
 	{
 		authGroup.POST("/register", h.Register)
 		authGroup.POST("/login", h.Login)
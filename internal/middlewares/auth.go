@@ -12,10 +12,12 @@ const (
 	userContextKey     = "userID"
 	usernameContextKey = "username"
 	emailContextKey    = "email"
+	roleContextKey     = "role"
 )
 
 // AuthMiddleware creates a middleware that enforces authentication.
 // It validates the access token from the cookie and sets the userID in the context.
+// Refresh tokens are rejected, they are only good for /auth/verify.
 func AuthMiddleware(tokenService *services.TokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString, err := c.Cookie("access_token")
@@ -25,7 +27,7 @@ func AuthMiddleware(tokenService *services.TokenService) gin.HandlerFunc {
 			return
 		}
 
-		claims, err := tokenService.ValidateToken(tokenString)
+		claims, err := tokenService.ValidateToken(tokenString, services.TokenTypeAccess)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -35,6 +37,7 @@ func AuthMiddleware(tokenService *services.TokenService) gin.HandlerFunc {
 		c.Set(userContextKey, claims.UserID)
 		c.Set(usernameContextKey, claims.Username)
 		c.Set(emailContextKey, claims.Email)
+		c.Set(roleContextKey, claims.Role)
 		c.Next()
 	}
 }
@@ -49,9 +52,10 @@ func OptionalAuthMiddleware(tokenService *services.TokenService) gin.HandlerFunc
 			return
 		}
 
-		claims, err := tokenService.ValidateToken(tokenString)
+		claims, err := tokenService.ValidateToken(tokenString, services.TokenTypeAccess)
 		if err == nil && claims != nil {
 			c.Set(userContextKey, claims.UserID)
+			c.Set(roleContextKey, claims.Role)
 		}
 
 		c.Next()
@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BodySizeLimitMiddleware rejects requests whose body is larger than maxBytes.
+// Bodies without a declared length are cut off while being read, which makes
+// binding them fail. routeLimits replaces maxBytes for the given route paths,
+// such as uploads that need more room.
+func BodySizeLimitMiddleware(maxBytes int64, routeLimits map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		maxBytes := maxBytes
+		if limit, ok := routeLimits[c.FullPath()]; ok {
+			maxBytes = limit
+		}
+
+		if c.Request.ContentLength > maxBytes {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Request body too large"})
+			c.Abort()
+			return
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		}
+
+		c.Next()
+	}
+}
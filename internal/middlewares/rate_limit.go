@@ -0,0 +1,68 @@
+package middlewares
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/services"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// UserRateLimitMiddleware limits requests per authenticated user.
+// It must run after AuthMiddleware, which sets the userID in the context.
+func UserRateLimitMiddleware(limiter *services.RateLimiter) gin.HandlerFunc {
+	return rateLimitMiddleware(limiter, func(c *gin.Context) (string, bool) {
+		userID, exists := c.Get(userContextKey)
+		if !exists {
+			return "", false
+		}
+		return strconv.Itoa(userID.(int)), true
+	})
+}
+
+// IPRateLimitMiddleware limits requests per client IP, for routes used before logging in.
+func IPRateLimitMiddleware(limiter *services.RateLimiter) gin.HandlerFunc {
+	return rateLimitMiddleware(limiter, func(c *gin.Context) (string, bool) {
+		return c.ClientIP(), true
+	})
+}
+
+func rateLimitMiddleware(limiter *services.RateLimiter, keyFunc func(c *gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key, ok := keyFunc(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		allowed, retryAfter, err := limiter.Allow(c.Request.Context(), key)
+		if err != nil {
+			// Losing Redis should not take the whole API down with it
+			logger.Log.Warn("Rate limit check failed, letting request through",
+				zap.String("key", key),
+				zap.Error(err))
+			c.Next()
+			return
+		}
+
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			if seconds < 1 {
+				seconds = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.JSON(http.StatusTooManyRequests, gin.H{
+				"error":       "Too many requests, please slow down",
+				"retry_after": seconds,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Judgement is one judging attempt of a submission. Every attempt, including
+// rejudges and retries, gets its own row; the submission points at the
+// current one. Users see it as a JudgementResponse.
+type Judgement struct {
+	ID           int    `db:"id" json:"id"`
+	SubmissionID int    `db:"submission_id" json:"submission_id"`
+	WorkerID     string `db:"worker_id" json:"-"`
+	Toolchain    string `db:"toolchain" json:"toolchain"`
+	// TestSetVersion is the version of the tests judged against, nil for
+	// verdicts from before test sets were versioned
+	TestSetVersion *int                 `db:"test_set_version" json:"test_set_version"`
+	Status         string               `db:"status" json:"status"`
+	WrongTestcase  *int                 `db:"wrong_testcase" json:"-"`
+	ProgramOutput  *string              `db:"program_output" json:"-"`
+	TestResults    JudgementTestResults `db:"test_results" json:"test_results"`
+	StartedAt      time.Time            `db:"started_at" json:"started_at"`
+	FinishedAt     time.Time            `db:"finished_at" json:"finished_at"`
+	ExecutionMs    int64                `db:"execution_ms" json:"execution_ms"`
+	IsCurrent      bool                 `db:"is_current" json:"is_current"`
+	// Attempt is the requeue count of the submission when judging started;
+	// the verdict of an attempt given up on is not recorded
+	Attempt int `db:"-" json:"-"`
+}
+
+// JudgementResponse is a judgement as shown to the owner of the submission.
+// Tests are numbered from 1 in the order they ran, and hidden tests are not
+// identified, like in a SubmissionResponse.
+type JudgementResponse struct {
+	ID             int                     `json:"id"`
+	SubmissionID   int                     `json:"submission_id"`
+	Toolchain      string                  `json:"toolchain"`
+	TestSetVersion *int                    `json:"test_set_version"`
+	Status         string                  `json:"status"`
+	FailedTest     *FailedTest             `json:"failed_test,omitempty"`
+	TestResults    []JudgementTestResponse `json:"test_results"`
+	StartedAt      time.Time               `json:"started_at"`
+	FinishedAt     time.Time               `json:"finished_at"`
+	ExecutionMs    int64                   `json:"execution_ms"`
+	IsCurrent      bool                    `json:"is_current"`
+}
+
+type JudgementTestResponse struct {
+	Index      int   `json:"index"`
+	TestCaseID *int  `json:"test_case_id,omitempty"` // visible tests only
+	Passed     bool  `json:"passed"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+type JudgementTestResult struct {
+	TestCaseID int   `json:"test_case_id"`
+	Passed     bool  `json:"passed"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// JudgementTestResults is stored as a JSON column
+type JudgementTestResults []JudgementTestResult
+
+func (r JudgementTestResults) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (r *JudgementTestResults) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*r = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("unsupported type for test results")
+	}
+	return json.Unmarshal(data, r)
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// OutboxEntry is a queue message waiting to be published to the judge queue
+type OutboxEntry struct {
+	ID           int64      `db:"id"`
+	SubmissionID int        `db:"submission_id"`
+	UserID       int        `db:"user_id"`
+	Lane         string     `db:"lane"`
+	RejudgeID    *int       `db:"rejudge_id"`
+	Attempts     int        `db:"attempts"`
+	CreatedAt    time.Time  `db:"created_at"`
+	PublishedAt  *time.Time `db:"published_at"`
+}
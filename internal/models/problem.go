@@ -1,22 +1,337 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type ProblemListItem struct {
-	ID         int    `db:"id" json:"id"`
-	Title      string `db:"title" json:"title"`
-	Difficulty string `db:"difficulty" json:"difficulty"`
-	IsSolved   bool   `json:"is_solved"`
+	ID                  int      `db:"id" json:"id"`
+	Title               string   `db:"title" json:"title"`
+	Difficulty          string   `db:"difficulty" json:"difficulty"`
+	Tags                []string `json:"tags"`
+	TotalSubmissions    int      `db:"total_submissions" json:"total_submissions"`
+	AcceptedSubmissions int      `db:"accepted_submissions" json:"accepted_submissions"`
+	AcceptanceRate      float64  `json:"acceptance_rate"`
+	IsSolved            bool     `json:"is_solved"`
+}
+
+// Orders of the problem list
+const (
+	ProblemSortID         = "id"         // oldest first, the default
+	ProblemSortNewest     = "newest"     // newest first
+	ProblemSortAcceptance = "acceptance" // highest acceptance rate first
+	ProblemSortRelevance  = "relevance"  // best search matches first, the default with a search
+)
+
+const (
+	DefaultProblemPageSize = 50
+	MaxProblemPageSize     = 100
+	MaxProblemTags         = 10
+	MaxTagLength           = 32
+	MaxProblemSearchLength = 100
+)
+
+// ProblemFilter selects and orders problems of the problem list
+type ProblemFilter struct {
+	Search     string
+	Difficulty string
+	Tags       []string // problems having all of them
+	Solved     *bool    // only applied for a logged-in user
+	UserID     int      // the logged-in user Solved applies to
+	Sort       string
+	Page       int // 1-based
+	Limit      int
+}
+
+func (f *ProblemFilter) Validate() error {
+	f.Search = strings.TrimSpace(f.Search)
+	if len(f.Search) > MaxProblemSearchLength {
+		return fmt.Errorf("search must be at most %d characters", MaxProblemSearchLength)
+	}
+
+	switch f.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		return errors.New("difficulty must be Easy, Medium or Hard")
+	}
+
+	tags, err := NormalizeTags(f.Tags)
+	if err != nil {
+		return err
+	}
+	f.Tags = tags
+
+	switch f.Sort {
+	case "":
+		f.Sort = ProblemSortID
+		if f.Search != "" {
+			f.Sort = ProblemSortRelevance
+		}
+	case ProblemSortID, ProblemSortNewest, ProblemSortAcceptance:
+	case ProblemSortRelevance:
+		if f.Search == "" {
+			return errors.New("sort by relevance needs a search")
+		}
+	default:
+		return errors.New("sort must be id, newest, acceptance or relevance")
+	}
+
+	if f.Page <= 0 {
+		f.Page = 1
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultProblemPageSize
+	}
+	if f.Limit > MaxProblemPageSize {
+		f.Limit = MaxProblemPageSize
+	}
+
+	return nil
+}
+
+// NormalizeTags lowercases and trims tags, dropping duplicates. Tags are
+// letters, digits, spaces and dashes.
+func NormalizeTags(tags []string) ([]string, error) {
+	if len(tags) > MaxProblemTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", MaxProblemTags)
+	}
+
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" {
+			return nil, errors.New("tags cannot be empty")
+		}
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tags must be at most %d characters: %s", MaxTagLength, tag)
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == ' ' || r == '-') {
+				return nil, fmt.Errorf("tags may only contain letters, digits, spaces and dashes: %s", tag)
+			}
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	return normalized, nil
+}
+
+type TagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+func (r *TagsRequest) Validate() error {
+	tags, err := NormalizeTags(r.Tags)
+	if err != nil {
+		return err
+	}
+	r.Tags = tags
+	return nil
+}
+
+// TagCount is a tag with the number of problems having it
+type TagCount struct {
+	Name     string `db:"name" json:"name"`
+	Problems int    `db:"problems" json:"problems"`
 }
 
 type ProblemDetail struct {
 	ID                  int            `db:"id" json:"id"`
 	Title               string         `db:"title" json:"title"`
 	Description         string         `db:"description" json:"description"`
+	DescriptionHTML     string         `json:"description_html"` // rendered and sanitized
 	Difficulty          string         `db:"difficulty" json:"difficulty"`
 	SampleInput         string         `db:"sample_input" json:"sample_input"`
 	SampleOutput        string         `db:"sample_output" json:"sample_output"`
+	TimeLimitMs         int            `db:"time_limit_ms" json:"time_limit_ms"`
+	MemoryLimitMB       int            `db:"memory_limit_mb" json:"memory_limit_mb"`
+	Tags                []string       `json:"tags"`
 	StarterCode         map[int]string `json:"starter_code,omitempty"`
 	IsSolved            bool           `json:"is_solved"`
-	TotalSubmissions    int            `json:"total_submissions"`
-	AcceptedSubmissions int            `json:"accepted_submissions"`
+	TotalSubmissions    int            `db:"total_submissions" json:"total_submissions"`
+	AcceptedSubmissions int            `db:"accepted_submissions" json:"accepted_submissions"`
 	AcceptanceRate      float64        `json:"acceptance_rate"`
 }
+
+const (
+	DifficultyEasy   = "Easy"
+	DifficultyMedium = "Medium"
+	DifficultyHard   = "Hard"
+)
+
+// Kinds of per-language code attached to a problem
+const (
+	ProblemCodeStarter = "starter-code" // shown to users in the editor
+	ProblemCodeSystem  = "system-code"  // driver code wrapped around submissions
+	ProblemCodeImports = "imports"      // imports prepended to submissions
+)
+
+// Limits of a single test run
+const (
+	DefaultTimeLimitMs   = 2000
+	MinTimeLimitMs       = 100
+	MaxTimeLimitMs       = 30000
+	DefaultMemoryLimitMB = 256
+	MinMemoryLimitMB     = 32
+	MaxMemoryLimitMB     = 2048
+)
+
+// Checkers compare the output of a test run with the expected output
+const (
+	CheckerExact  = "exact"  // trimmed outputs must be equal
+	CheckerTokens = "tokens" // same whitespace-separated tokens
+	// CheckerFloatPrefix starts a checker like "float:1e-6", comparing tokens
+	// and accepting numbers within that absolute or relative error
+	CheckerFloatPrefix = "float:"
+)
+
+type ProblemRequest struct {
+	Title         string `json:"title" binding:"required"`
+	Description   string `json:"description" binding:"required"`
+	Difficulty    string `json:"difficulty" binding:"required"`
+	SampleInput   string `json:"sample_input"`
+	SampleOutput  string `json:"sample_output"`
+	TimeLimitMs   int    `json:"time_limit_ms"`   // DefaultTimeLimitMs when 0
+	MemoryLimitMB int    `json:"memory_limit_mb"` // DefaultMemoryLimitMB when 0
+	Checker       string `json:"checker"`         // CheckerExact when empty
+}
+
+func (r *ProblemRequest) Validate() error {
+	r.Title = strings.TrimSpace(r.Title)
+	if r.Title == "" {
+		return errors.New("title cannot be empty")
+	}
+	if len(r.Title) > 255 {
+		return errors.New("title must be at most 255 characters")
+	}
+	if strings.TrimSpace(r.Description) == "" {
+		return errors.New("description cannot be empty")
+	}
+
+	switch r.Difficulty {
+	case DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		return errors.New("difficulty must be Easy, Medium or Hard")
+	}
+
+	if r.TimeLimitMs == 0 {
+		r.TimeLimitMs = DefaultTimeLimitMs
+	}
+	if r.TimeLimitMs < MinTimeLimitMs || r.TimeLimitMs > MaxTimeLimitMs {
+		return fmt.Errorf("time_limit_ms must be between %d and %d", MinTimeLimitMs, MaxTimeLimitMs)
+	}
+	if r.MemoryLimitMB == 0 {
+		r.MemoryLimitMB = DefaultMemoryLimitMB
+	}
+	if r.MemoryLimitMB < MinMemoryLimitMB || r.MemoryLimitMB > MaxMemoryLimitMB {
+		return fmt.Errorf("memory_limit_mb must be between %d and %d", MinMemoryLimitMB, MaxMemoryLimitMB)
+	}
+
+	if r.Checker == "" {
+		r.Checker = CheckerExact
+	}
+	return ValidateChecker(r.Checker)
+}
+
+// ValidateChecker checks that checker is exact, tokens or float:<tolerance>
+func ValidateChecker(checker string) error {
+	if checker == CheckerExact || checker == CheckerTokens {
+		return nil
+	}
+	if tolerance, ok := strings.CutPrefix(checker, CheckerFloatPrefix); ok {
+		value, err := strconv.ParseFloat(tolerance, 64)
+		if err != nil || value <= 0 || value >= 1 {
+			return fmt.Errorf("float checker tolerance must be between 0 and 1: %s", tolerance)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported checker: %s", checker)
+}
+
+type TestCase struct {
+	ID             int    `db:"id" json:"id"`
+	ProblemID      int    `db:"problem_id" json:"problem_id"`
+	Input          string `db:"input" json:"input"`
+	ExpectedOutput string `db:"expected_output" json:"expected_output"`
+	// Files larger than the inline limit are in the blob store under these
+	// keys, and left empty above in listings
+	InputBlob          *string `db:"input_blob" json:"input_blob,omitempty"`
+	ExpectedOutputBlob *string `db:"expected_output_blob" json:"expected_output_blob,omitempty"`
+	InputSize          int     `db:"input_size" json:"input_size"`
+	ExpectedOutputSize int     `db:"expected_output_size" json:"expected_output_size"`
+	// Visible tests have their data shown to users failing them
+	Visible bool `db:"visible" json:"visible"`
+}
+
+// TestSet is one version of the tests of a problem. Published versions
+// never change; the draft, with no version, collects edits until it is
+// published as the next one.
+type TestSet struct {
+	ID          int        `db:"id" json:"id"`
+	ProblemID   int        `db:"problem_id" json:"problem_id"`
+	Version     *int       `db:"version" json:"version"`
+	TestCount   int        `db:"test_count" json:"test_count"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	PublishedAt *time.Time `db:"published_at" json:"published_at,omitempty"`
+	// GeneratorScript is the script the tests were generated with, if they were
+	GeneratorScript *string `db:"generator_script" json:"generator_script,omitempty"`
+}
+
+type TestCaseRequest struct {
+	Input          string `json:"input"`
+	ExpectedOutput string `json:"expected_output"`
+	Visible        bool   `json:"visible"`
+}
+
+func (r *TestCaseRequest) Validate() error {
+	if r.Input == "" && r.ExpectedOutput == "" {
+		return errors.New("input and expected output cannot both be empty")
+	}
+	return nil
+}
+
+// ProblemLanguageCode is the code of every kind a problem has for one language
+type ProblemLanguageCode struct {
+	LanguageID  int     `json:"language_id"`
+	StarterCode *string `json:"starter_code,omitempty"`
+	SystemCode  *string `json:"system_code,omitempty"`
+	Imports     *string `json:"imports,omitempty"`
+}
+
+type ProblemCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// IsValidProblemCodeKind reports whether kind is one of the per-language code kinds
+func IsValidProblemCodeKind(kind string) bool {
+	switch kind {
+	case ProblemCodeStarter, ProblemCodeSystem, ProblemCodeImports:
+		return true
+	}
+	return false
+}
+
+// ProblemPackage is everything needed to recreate and judge a problem on
+// another deployment: its statement, limits, checker, tests and per-language code.
+type ProblemPackage struct {
+	Problem     ProblemRequest
+	Tags        []string
+	TestCases   []TestCaseRequest
+	Code        []ProblemLanguageCode
+	Attachments []AttachmentFile
+}
+
+// JudgeSettings are the limits and checker workers judge a problem with
+type JudgeSettings struct {
+	TimeLimitMs   int    `db:"time_limit_ms" json:"time_limit_ms"`
+	MemoryLimitMB int    `db:"memory_limit_mb" json:"memory_limit_mb"`
+	Checker       string `db:"checker" json:"checker"`
+}
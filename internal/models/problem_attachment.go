@@ -0,0 +1,54 @@
+package models
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// AttachmentContentTypes are the images a statement can include. SVG is
+// left out, as it can carry scripts.
+var AttachmentContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+var attachmentNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*(\.[A-Za-z0-9_-]+)+$`)
+
+// ProblemAttachment is a file of a problem's statement, such as an image,
+// kept in the blob store
+type ProblemAttachment struct {
+	Name        string    `db:"name" json:"name"`
+	ContentType string    `db:"content_type" json:"content_type"`
+	BlobKey     string    `db:"blob_key" json:"-"`
+	Size        int       `db:"size" json:"size"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+// AttachmentFile is an attachment as carried by a problem package
+type AttachmentFile struct {
+	Name string
+	Data []byte
+}
+
+// ValidateAttachmentName checks that an attachment name is a plain file
+// name with an extension, as statements refer to it, e.g. "graph-1.png"
+func ValidateAttachmentName(name string) error {
+	if len(name) > 128 || !attachmentNamePattern.MatchString(name) {
+		return errors.New("attachment names are up to 128 letters, digits, dashes and underscores, with an extension")
+	}
+	return nil
+}
+
+// AttachmentContentType returns the content type of an attachment, sniffed
+// from its data rather than trusted from the upload
+func AttachmentContentType(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if !AttachmentContentTypes[contentType] {
+		return "", errors.New("attachments must be PNG, JPEG, GIF or WebP images")
+	}
+	return contentType, nil
+}
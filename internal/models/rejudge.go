@@ -0,0 +1,60 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	RejudgeScopeSubmission = "submission"
+	RejudgeScopeProblem    = "problem"
+	RejudgeScopeTimeRange  = "time_range"
+)
+
+type Rejudge struct {
+	ID           int        `db:"id" json:"id"`
+	RequestedBy  int        `db:"requested_by" json:"requested_by"`
+	Scope        string     `db:"scope" json:"scope"`
+	SubmissionID *int       `db:"submission_id" json:"submission_id,omitempty"`
+	ProblemID    *int       `db:"problem_id" json:"problem_id,omitempty"`
+	FromTime     *time.Time `db:"from_time" json:"from,omitempty"`
+	ToTime       *time.Time `db:"to_time" json:"to,omitempty"`
+	Total        int        `db:"total" json:"total"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+// RejudgeItem links the judgement a submission had before a rejudge to the
+// one it got afterwards (nil until the worker finishes it).
+type RejudgeItem struct {
+	SubmissionID        int        `db:"submission_id" json:"submission_id"`
+	UserID              int        `db:"user_id" json:"-"`
+	PreviousStatus      string     `db:"previous_status" json:"previous_status"`
+	PreviousJudgementID *int       `db:"previous_judgement_id" json:"previous_judgement_id,omitempty"`
+	NewStatus           *string    `db:"new_status" json:"new_status,omitempty"`
+	NewJudgementID      *int       `db:"new_judgement_id" json:"new_judgement_id,omitempty"`
+	JudgedAt            *time.Time `db:"judged_at" json:"judged_at,omitempty"`
+}
+
+type RejudgeReport struct {
+	Rejudge Rejudge       `json:"rejudge"`
+	Judged  int           `json:"judged"`
+	Pending int           `json:"pending"`
+	Changed int           `json:"changed"`
+	Changes []RejudgeItem `json:"changes"`
+}
+
+type RejudgeTimeRangeRequest struct {
+	From      time.Time `json:"from" binding:"required"`
+	To        time.Time `json:"to" binding:"required"`
+	ProblemID *int      `json:"problem_id"`
+}
+
+func (r *RejudgeTimeRangeRequest) Validate() error {
+	if !r.From.Before(r.To) {
+		return errors.New("from must be before to")
+	}
+	if r.ProblemID != nil && *r.ProblemID <= 0 {
+		return errors.New("problem ID must be a positive integer")
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -12,36 +13,59 @@ const (
 	StatusCompilationError = "COMPILATION_ERROR"
 	StatusPending          = "PENDING"
 	StatusProcessing       = "PROCESSING"
+	StatusCancelled        = "CANCELLED"
+	StatusInternalError    = "INTERNAL_ERROR"
+	StatusTimeLimit        = "TIME_LIMIT_EXCEEDED"
+	StatusMemoryLimit      = "MEMORY_LIMIT_EXCEEDED"
 )
 
 type Submission struct {
-	ID            int       `db:"id" json:"id"`
-	UserID        int       `db:"user_id" json:"user_id"`
-	ProblemID     int       `db:"problem_id" json:"problem_id"`
-	LanguageID    int       `db:"language_id" json:"language_id"`
-	SourceCode    string    `db:"source_code" json:"source_code"`
-	Status        string    `db:"status" json:"status"`
-	WrongTestcase *int      `db:"wrong_testcase" json:"wrong_testcase,omitempty"`
-	ProgramOutput *string   `db:"program_output" json:"program_output,omitempty"`
-	SubmittedAt   time.Time `db:"submitted_at" json:"submitted_at"`
+	ID         int    `db:"id" json:"id"`
+	UserID     int    `db:"user_id" json:"user_id"`
+	ProblemID  int    `db:"problem_id" json:"problem_id"`
+	LanguageID int    `db:"language_id" json:"language_id"`
+	SourceCode string `db:"source_code" json:"source_code"`
+	Status     string `db:"status" json:"status"`
+	// Verdict details come from the current judgement, nil while not judged yet
+	CurrentJudgementID *int      `db:"current_judgement_id" json:"current_judgement_id,omitempty"`
+	WrongTestcase      *int      `db:"wrong_testcase" json:"wrong_testcase,omitempty"`
+	ProgramOutput      *string   `db:"program_output" json:"program_output,omitempty"`
+	SubmittedAt        time.Time `db:"submitted_at" json:"submitted_at"`
+	// Times the sweeper put the submission back in the queue after its worker died
+	RequeueCount int `db:"requeue_count" json:"-"`
+	// Lane and rejudge the submission was last queued for, reused when it is requeued
+	QueueLane string `db:"queue_lane" json:"-"`
+	RejudgeID *int   `db:"rejudge_id" json:"-"`
 }
 
 type SubmissionResponse struct {
-	Status         string  `json:"status"`
-	WrongTestcase  *string `json:"wrong_testcase,omitempty"`
-	ExpectedOutput *string `json:"expected_output,omitempty"`
-	ProgramOutput  *string `json:"program_output,omitempty"`
-	SourceCode     string  `json:"source_code"`
+	Status         string      `json:"status"`
+	FailedTest     *FailedTest `json:"failed_test,omitempty"`
+	WrongTestcase  *string     `json:"wrong_testcase,omitempty"`
+	ExpectedOutput *string     `json:"expected_output,omitempty"`
+	ProgramOutput  *string     `json:"program_output,omitempty"`
+	SourceCode     string      `json:"source_code"`
+}
+
+// FailedTest is the test a submission was rejected on. The input, expected
+// output and program output of hidden tests are left out of the response.
+type FailedTest struct {
+	Index   *int   `json:"index,omitempty"` // 1-based, in the order tests ran
+	Verdict string `json:"verdict"`
+	Hidden  bool   `json:"hidden"`
 }
 
 type SubmissionRequest struct {
 	ProblemID  int    `json:"problem_id" binding:"required"`
 	LanguageID int    `json:"language_id" binding:"required"`
 	SourceCode string `json:"source_code" binding:"required"`
+	// Lane is the optional queue lane ("normal" or "interactive"), defaults to normal
+	Lane string `json:"lane"`
 }
 
 type SubmissionListItem struct {
 	ID          int       `db:"id" json:"id"`
+	ProblemID   int       `db:"problem_id" json:"problem_id"`
 	LanguageID  int       `db:"language_id" json:"language_id"`
 	Status      string    `db:"status" json:"status"`
 	SubmittedAt time.Time `db:"submitted_at" json:"submitted_at"`
@@ -50,6 +74,103 @@ type SubmissionListItem struct {
 	LanguageName  string `db:"-" json:"language_name"`
 }
 
+// Who can read the source code of a submission besides its owner
+const (
+	VisibilityPrivate = "private"
+	VisibilityLink    = "link" // anyone with the share link
+	VisibilityPublic  = "public"
+)
+
+// StatusEntry is a submission as listed on the public status page
+type StatusEntry struct {
+	ID           int       `db:"id" json:"id"`
+	UserID       int       `db:"user_id" json:"user_id"`
+	Username     string    `db:"username" json:"username"`
+	ProblemID    int       `db:"problem_id" json:"problem_id"`
+	ProblemTitle string    `db:"problem_title" json:"problem_title"`
+	LanguageID   int       `db:"language_id" json:"language_id"`
+	Status       string    `db:"status" json:"status"`
+	ExecutionMs  *int64    `db:"execution_ms" json:"execution_ms,omitempty"`
+	Visibility   string    `db:"visibility" json:"visibility"`
+	SubmittedAt  time.Time `db:"submitted_at" json:"submitted_at"`
+	// Derived fields filled in by the handler
+	LanguageName  string `db:"-" json:"language_name"`
+	SourceVisible bool   `db:"-" json:"source_visible"`
+}
+
+// StatusDetail is a status page entry with its source code, which is only
+// filled in for viewers allowed to read it.
+type StatusDetail struct {
+	StatusEntry
+	SourceCode *string `db:"source_code" json:"source_code,omitempty"`
+}
+
+type VisibilityRequest struct {
+	Visibility string `json:"visibility" binding:"required"`
+}
+
+func (r *VisibilityRequest) Validate() error {
+	switch r.Visibility {
+	case VisibilityPrivate, VisibilityLink, VisibilityPublic:
+		return nil
+	}
+	return errors.New("visibility must be private, link or public")
+}
+
+// Page sizes of submission listings
+const (
+	DefaultSubmissionPageSize = 20
+	MaxSubmissionPageSize     = 100
+)
+
+// SubmissionFilter selects a page of submissions, newest first. Nil and
+// empty fields are not filtered on.
+type SubmissionFilter struct {
+	UserID     *int
+	ProblemID  *int
+	LanguageID *int
+	Status     string
+	From       *time.Time // submitted at or after
+	To         *time.Time // submitted before
+	// Cursor is the ID of the last submission of the previous page, 0 for the first page
+	Cursor int
+	Limit  int
+}
+
+func (f *SubmissionFilter) Validate() error {
+	if f.Status != "" && !IsValidStatus(f.Status) {
+		return errors.New("unknown submission status")
+	}
+	if f.From != nil && f.To != nil && !f.From.Before(*f.To) {
+		return errors.New("from must be before to")
+	}
+	if f.Cursor < 0 {
+		return errors.New("invalid cursor")
+	}
+	if f.Limit <= 0 {
+		f.Limit = DefaultSubmissionPageSize
+	}
+	if f.Limit > MaxSubmissionPageSize {
+		f.Limit = MaxSubmissionPageSize
+	}
+	return nil
+}
+
+// IsValidStatus reports whether status is one of the submission statuses
+func IsValidStatus(status string) bool {
+	switch status {
+	case StatusAccepted, StatusWrongAnswer, StatusCompilationError, StatusPending,
+		StatusProcessing, StatusCancelled, StatusInternalError, StatusTimeLimit, StatusMemoryLimit:
+		return true
+	}
+	return false
+}
+
+// IsFinalStatus reports whether a submission with this status will not change anymore
+func IsFinalStatus(status string) bool {
+	return status != StatusPending && status != StatusProcessing
+}
+
 func (r *SubmissionRequest) ValidateRequest() error {
 
 	if r.ProblemID <= 0 {
@@ -64,5 +185,10 @@ func (r *SubmissionRequest) ValidateRequest() error {
 		return errors.New("source code cannot be empty")
 	}
 
+	// Source code is stored and compiled as text, so reject binary uploads
+	if !utf8.ValidString(r.SourceCode) || strings.ContainsRune(r.SourceCode, 0) {
+		return errors.New("source code must be UTF-8 text without NUL bytes")
+	}
+
 	return nil
 }
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of programs a problem can have for generating its tests
+const (
+	ProgramGenerator = "generator" // prints a test input from its arguments
+	ProgramSolution  = "solution"  // reference solution, prints the expected output
+	ProgramValidator = "validator" // exits non-zero on an invalid input
+)
+
+const (
+	// MaxGeneratedTests bounds the lines of a generator script
+	MaxGeneratedTests = 100
+	// GeneratorTimeLimitMs limits each run of a generator or validator. The
+	// reference solution runs with the problem's time limit.
+	GeneratorTimeLimitMs = 10000
+)
+
+// TestGenerationTimeout bounds a test generation job, from the moment a
+// worker picks it up
+const TestGenerationTimeout = 2 * time.Hour
+
+// GenerationHeartbeat is how often a worker saves the job it runs
+const GenerationHeartbeat = 10 * time.Second
+
+// Statuses of a test generation job
+const (
+	GenerationQueued    = "queued"
+	GenerationRunning   = "running"
+	GenerationSucceeded = "succeeded"
+	GenerationFailed    = "failed"
+)
+
+var programNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// ProblemProgram is a generator, reference solution or validator of a problem
+type ProblemProgram struct {
+	Name       string    `db:"name" json:"name"`
+	Kind       string    `db:"kind" json:"kind"`
+	LanguageID int       `db:"language_id" json:"language_id"`
+	SourceCode string    `db:"source_code" json:"source_code"`
+	UpdatedAt  time.Time `db:"updated_at" json:"updated_at"`
+}
+
+type ProblemProgramRequest struct {
+	Kind       string `json:"kind" binding:"required"`
+	LanguageID int    `json:"language_id" binding:"required"`
+	SourceCode string `json:"source_code" binding:"required"`
+}
+
+func (r *ProblemProgramRequest) Validate() error {
+	switch r.Kind {
+	case ProgramGenerator, ProgramSolution, ProgramValidator:
+	default:
+		return errors.New("kind must be generator, solution or validator")
+	}
+	if strings.TrimSpace(r.SourceCode) == "" {
+		return errors.New("source code cannot be empty")
+	}
+	return nil
+}
+
+// ValidateProgramName checks that a program name is lowercase letters,
+// digits, dashes and underscores, as used in generator scripts
+func ValidateProgramName(name string) error {
+	if !programNamePattern.MatchString(name) {
+		return errors.New("program names are 1 to 64 lowercase letters, digits, dashes and underscores")
+	}
+	return nil
+}
+
+// GeneratorCommand is one line of a generator script: a generator and the
+// arguments it is run with
+type GeneratorCommand struct {
+	Line      int
+	Generator string
+	Args      []string
+}
+
+// GenerateTestsRequest generates tests from a script with one generator
+// command per line, such as "gen 10 1000". Blank lines and lines starting
+// with # are skipped.
+type GenerateTestsRequest struct {
+	Script string `json:"script" binding:"required"`
+	// KeepExisting keeps the current tests ahead of the generated ones
+	KeepExisting bool `json:"keep_existing"`
+}
+
+// Commands parses the script
+func (r *GenerateTestsRequest) Commands() ([]GeneratorCommand, error) {
+	var commands []GeneratorCommand
+	for i, line := range strings.Split(r.Script, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if err := ValidateProgramName(fields[0]); err != nil {
+			return nil, fmt.Errorf("line %d: invalid generator name %q", i+1, fields[0])
+		}
+		commands = append(commands, GeneratorCommand{Line: i + 1, Generator: fields[0], Args: fields[1:]})
+	}
+
+	if len(commands) == 0 {
+		return nil, errors.New("script has no generator commands")
+	}
+	if len(commands) > MaxGeneratedTests {
+		return nil, fmt.Errorf("script has more than %d generator commands", MaxGeneratedTests)
+	}
+	return commands, nil
+}
+
+// TestGenerationJob is a test generation running in the background, polled
+// for its progress and outcome
+type TestGenerationJob struct {
+	ID        string `json:"id"`
+	ProblemID int    `json:"problem_id"`
+	Status    string `json:"status"`
+	Generated int    `json:"generated"` // tests stored so far
+	Total     int    `json:"total"`
+	// Version is the published test set, once succeeded
+	Version int `json:"version,omitempty"`
+	// Error, with the script line and the program at fault when it is
+	// theirs, once failed
+	Error   string `json:"error,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Program string `json:"program,omitempty"`
+	// Worker runs the job; it saves the job at least every
+	// GenerationHeartbeat, which tells a running job from a lost one
+	Worker     string     `json:"worker,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
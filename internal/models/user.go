@@ -7,11 +7,18 @@ import (
 	"time"
 )
 
+const (
+	RoleUser          = "user"
+	RoleProblemSetter = "problem_setter" // can author problems
+	RoleAdmin         = "admin"          // can do everything, including rejudges and managing roles
+)
+
 type User struct {
 	ID           int       `db:"id"`
 	Username     string    `db:"username"`
 	Email        string    `db:"email"`
 	PasswordHash string    `db:"password_hash"`
+	Role         string    `db:"role"`
 	CreatedAt    time.Time `db:"created_at"`
 }
 
@@ -27,10 +34,29 @@ type LoginRequest struct {
 }
 
 type UserInfo struct {
-	Username    string               `db:"username" json:"username"`
-	Email       string               `db:"email" json:"email"`
-	CreatedAt   time.Time            `db:"created_at" json:"created_at"`
-	Submissions []SubmissionListItem `json:"submissions"`
+	Username  string    `db:"username" json:"username"`
+	Email     string    `db:"email" json:"email"`
+	Role      string    `db:"role" json:"role"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+func (r *RoleRequest) Validate() error {
+	if !IsValidRole(r.Role) {
+		return errors.New("role must be user, problem_setter or admin")
+	}
+	return nil
+}
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleProblemSetter, RoleAdmin:
+		return true
+	}
+	return false
 }
 
 func (r *RegisterRequest) Validate() error {
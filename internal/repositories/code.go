@@ -4,9 +4,11 @@ import (
 	"HAB/internal/logger"
 	"HAB/internal/models"
 	"HAB/internal/services"
+	"HAB/internal/utils"
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -15,12 +17,24 @@ import (
 type CodeRepository interface {
 	GetSubmission(ctx context.Context, submissionID int) (*models.Submission, error)
 	GetSubmissionByID(ctx context.Context, submissionID int, userID int) (*models.SubmissionResponse, error)
-	GetTestCases(ctx context.Context, problemID int) ([]services.TestCase, error)
+	GetTestSet(ctx context.Context, problemID int) (*services.TestSet, error)
 	GetSystemCode(ctx context.Context, problemID int, languageID int) (string, error)
 	GetLanguageImports(ctx context.Context, problemID int, languageID int) (string, error)
-	CreateSubmission(ctx context.Context, submission *models.Submission) error
-	UpdateSubmissionStatus(ctx context.Context, submissionID int, status string, wrongTestcase *int, wrongOutput *string) error
-	GetSubmissionsByUserAndProblem(ctx context.Context, userID int, problemID int) ([]models.SubmissionListItem, error)
+	GetJudgeSettings(ctx context.Context, problemID int) (*models.JudgeSettings, error)
+	CreateSubmission(ctx context.Context, submission *models.Submission, lane services.Lane) error
+	RecordJudgement(ctx context.Context, judgement *models.Judgement) error
+	GetJudgements(ctx context.Context, submissionID int, userID int) ([]models.JudgementResponse, error)
+	CancelSubmission(ctx context.Context, submissionID int, userID int) error
+	MarkProcessing(ctx context.Context, submissionID int, attempt int) (bool, error)
+	GetStuckSubmissions(ctx context.Context, stuckFor time.Duration, limit int) ([]models.Submission, error)
+	RequeueSubmission(ctx context.Context, submission *models.Submission) (bool, error)
+	FailSubmission(ctx context.Context, submissionID int, status string) (bool, error)
+	ListSubmissions(ctx context.Context, filter models.SubmissionFilter) ([]models.SubmissionListItem, error)
+	ListStatus(ctx context.Context, filter models.SubmissionFilter) ([]models.StatusEntry, error)
+	GetStatusDetail(ctx context.Context, submissionID int) (*models.StatusDetail, error)
+	SetVisibility(ctx context.Context, submissionID int, userID int, visibility string) (string, error)
+	GetSharedSubmission(ctx context.Context, shareToken string) (*models.StatusDetail, error)
+	HasSolvedProblem(ctx context.Context, userID int, problemID int) (bool, error)
 }
 
 type codeRepository struct {
@@ -34,9 +48,11 @@ func NewCodeRepository(db *sqlx.DB, cache services.Cache) CodeRepository {
 }
 
 func (r *codeRepository) GetSubmission(ctx context.Context, submissionID int) (*models.Submission, error) {
-	query := `SELECT id, user_id, problem_id, language_id, source_code, status, 
-                  wrong_testcase, program_output, submitted_at 
-              FROM submissions WHERE id = ?`
+	query := `SELECT s.id, s.user_id, s.problem_id, s.language_id, s.source_code, s.status, s.requeue_count,
+                  s.current_judgement_id, j.wrong_testcase, j.program_output, s.submitted_at 
+              FROM submissions s
+              LEFT JOIN judgements j ON j.id = s.current_judgement_id
+              WHERE s.id = ?`
 
 	var submission models.Submission
 
@@ -52,11 +68,16 @@ func (r *codeRepository) GetSubmission(ctx context.Context, submissionID int) (*
 }
 
 func (r *codeRepository) GetSubmissionByID(ctx context.Context, submissionID, userID int) (*models.SubmissionResponse, error) {
-	query := `SELECT id, user_id, problem_id, language_id, source_code, status, 
-              wrong_testcase, program_output, submitted_at 
-              FROM submissions WHERE id = ? AND user_id = ?`
-
-	var submission models.Submission
+	query := `SELECT s.id, s.user_id, s.problem_id, s.language_id, s.source_code, s.status, 
+              s.current_judgement_id, j.wrong_testcase, j.program_output, j.test_results, s.submitted_at 
+              FROM submissions s
+              LEFT JOIN judgements j ON j.id = s.current_judgement_id
+              WHERE s.id = ? AND s.user_id = ?`
+
+	var submission struct {
+		models.Submission
+		TestResults models.JudgementTestResults `db:"test_results"`
+	}
 
 	err := r.db.GetContext(ctx, &submission, query, submissionID, userID)
 	if err != nil {
@@ -72,60 +93,101 @@ func (r *codeRepository) GetSubmissionByID(ctx context.Context, submissionID, us
 		SourceCode:    submission.SourceCode,
 	}
 	if submission.WrongTestcase != nil {
-		testcaseQuery := `SELECT input, expected_output FROM test_cases WHERE id = ?`
+		// Files kept in the blob store are too large to show
+		testcaseQuery := `SELECT input, expected_output, visible FROM test_cases WHERE id = ?`
 
 		var testcase struct {
-			Input          string `db:"input"`
-			ExpectedOutput string `db:"expected_output"`
+			Input          *string `db:"input"`
+			ExpectedOutput *string `db:"expected_output"`
+			Visible        bool    `db:"visible"`
 		}
 
 		err := r.db.GetContext(ctx, &testcase, testcaseQuery, *submission.WrongTestcase)
-		if err != nil {
-			if err != sql.ErrNoRows {
-				return nil, fmt.Errorf("failed to get testcase data: %w", err)
-			}
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get testcase data: %w", err)
+		}
+
+		// A test deleted since is kept hidden, having no visibility to go by
+		response.FailedTest = failedTest(submission.Status, *submission.WrongTestcase, submission.TestResults,
+			testcase.Visible)
+
+		if testcase.Visible {
+			response.WrongTestcase = testcase.Input
+			response.ExpectedOutput = testcase.ExpectedOutput
 		} else {
-			response.WrongTestcase = &testcase.Input
-			response.ExpectedOutput = &testcase.ExpectedOutput
+			response.ProgramOutput = nil
 		}
 	}
 
 	return response, nil
 }
-func (r *codeRepository) GetTestCases(ctx context.Context, problemID int) ([]services.TestCase, error) {
-	cacheKey := fmt.Sprintf("problem:%d:testcases", problemID)
-	var testCases []services.TestCase
-	fmt.Println(cacheKey)
-	if err := r.cache.Get(ctx, cacheKey, &testCases); err == nil {
+
+// GetTestSet returns the latest published version of a problem's tests.
+// The latest version is always read from the database, and the tests are
+// cached per version: published versions never change, so a worker that
+// loaded an older version while a new one was published can't leave it
+// cached in place of the new one. Large files are left in the blob store,
+// keeping the cached entry small.
+func (r *codeRepository) GetTestSet(ctx context.Context, problemID int) (*services.TestSet, error) {
+	var published struct {
+		ID      int `db:"id"`
+		Version int `db:"version"`
+	}
+	query := `SELECT id, version FROM test_sets 
+              WHERE problem_id = ? AND version IS NOT NULL 
+              ORDER BY version DESC LIMIT 1`
+	if err := r.db.GetContext(ctx, &published, query, problemID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("problem has no published test set: %d", problemID)
+		}
+		return nil, fmt.Errorf("failed to get test set: %w", err)
+	}
+
+	cacheKey := fmt.Sprintf("problem:%d:testcases:v%d", problemID, published.Version)
+	var testSet services.TestSet
+	if err := r.cache.Get(ctx, cacheKey, &testSet); err == nil {
 		logger.Log.Info("Cache hit, returning testcases")
-		return testCases, nil // Cache hit
+		return &testSet, nil // Cache hit
 	}
 	logger.Log.Info("Test cases not in cache, retrieving in DB")
 
-	query := `SELECT id, input, expected_output FROM test_cases WHERE problem_id = ?`
+	query = `SELECT tc.id, COALESCE(tc.input, '') AS input, COALESCE(tc.input_blob, '') AS input_blob, 
+                 COALESCE(tc.expected_output, '') AS expected_output, 
+                 COALESCE(tc.expected_output_blob, '') AS expected_output_blob 
+             FROM test_set_cases tsc
+             JOIN test_cases tc ON tc.id = tsc.test_case_id
+             WHERE tsc.test_set_id = ?
+             ORDER BY tsc.position`
 
 	var dbTestCases []struct {
-		ID       int    `db:"id"`
-		Input    string `db:"input"`
-		Expected string `db:"expected_output"`
+		ID           int    `db:"id"`
+		Input        string `db:"input"`
+		InputBlob    string `db:"input_blob"`
+		Expected     string `db:"expected_output"`
+		ExpectedBlob string `db:"expected_output_blob"`
 	}
 
-	if err := r.db.SelectContext(ctx, &dbTestCases, query, problemID); err != nil {
+	if err := r.db.SelectContext(ctx, &dbTestCases, query, published.ID); err != nil {
 		return nil, fmt.Errorf("failed to get test cases: %w", err)
 	}
 
-	result := make([]services.TestCase, len(dbTestCases))
+	testSet = services.TestSet{
+		Version:   published.Version,
+		TestCases: make([]services.TestCase, len(dbTestCases)),
+	}
 	for i, tc := range dbTestCases {
-		result[i] = services.TestCase{
-			ID:       tc.ID,
-			Input:    tc.Input,
-			Expected: tc.Expected,
+		testSet.TestCases[i] = services.TestCase{
+			ID:           tc.ID,
+			Input:        tc.Input,
+			Expected:     tc.Expected,
+			InputBlob:    tc.InputBlob,
+			ExpectedBlob: tc.ExpectedBlob,
 		}
 	}
 
-	_ = r.cache.Set(ctx, cacheKey, result, 1*time.Hour)
+	_ = r.cache.Set(ctx, cacheKey, testSet, 1*time.Hour)
 
-	return result, nil
+	return &testSet, nil
 }
 
 func (r *codeRepository) GetSystemCode(ctx context.Context, problemID int, languageID int) (string, error) {
@@ -141,8 +203,10 @@ func (r *codeRepository) GetSystemCode(ctx context.Context, problemID int, langu
 	query := `SELECT code FROM system_code WHERE problem_id = ? AND language_id = ?`
 
 	if err := r.db.GetContext(ctx, &code, query, problemID, languageID); err != nil {
+		// Without system code, submissions are complete programs
 		if err == sql.ErrNoRows {
-			return "", fmt.Errorf("system code not found for problem %d and language %d", problemID, languageID)
+			_ = r.cache.Set(ctx, cacheKey, "", 1*time.Hour)
+			return "", nil
 		}
 		return "", fmt.Errorf("failed to get system code: %w", err)
 	}
@@ -177,16 +241,48 @@ func (r *codeRepository) GetLanguageImports(ctx context.Context, problemID int,
 	return code, nil
 }
 
-func (r *codeRepository) CreateSubmission(ctx context.Context, submission *models.Submission) error {
-	query := `INSERT INTO submissions (user_id, problem_id, language_id, source_code, status) 
-              VALUES (?, ?, ?, ?, ?)`
+// GetJudgeSettings returns the limits and checker of a problem
+func (r *codeRepository) GetJudgeSettings(ctx context.Context, problemID int) (*models.JudgeSettings, error) {
+	cacheKey := fmt.Sprintf("problem:%d:settings", problemID)
+	var settings models.JudgeSettings
 
-	result, err := r.db.ExecContext(ctx, query,
+	if err := r.cache.Get(ctx, cacheKey, &settings); err == nil {
+		return &settings, nil
+	}
+
+	query := `SELECT time_limit_ms, memory_limit_mb, checker FROM problems WHERE id = ?`
+
+	if err := r.db.GetContext(ctx, &settings, query, problemID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("problem not found: %d", problemID)
+		}
+		return nil, fmt.Errorf("failed to get judge settings: %w", err)
+	}
+
+	_ = r.cache.Set(ctx, cacheKey, settings, 1*time.Hour)
+
+	return &settings, nil
+}
+
+// CreateSubmission inserts the submission together with its outbox entry, so
+// a stored submission always ends up in the judge queue.
+func (r *codeRepository) CreateSubmission(ctx context.Context, submission *models.Submission, lane services.Lane) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO submissions (user_id, problem_id, language_id, source_code, status, queue_lane, queued_at) 
+              VALUES (?, ?, ?, ?, ?, ?, NOW(3))`
+
+	result, err := tx.ExecContext(ctx, query,
 		submission.UserID,
 		submission.ProblemID,
 		submission.LanguageID,
 		submission.SourceCode,
 		submission.Status,
+		string(lane),
 	)
 
 	if err != nil {
@@ -198,31 +294,591 @@ func (r *codeRepository) CreateSubmission(ctx context.Context, submission *model
 		return fmt.Errorf("failed to get last insert ID: %w", err)
 	}
 
+	_, err = tx.ExecContext(ctx, `UPDATE problems SET total_submissions = total_submissions + 1 WHERE id = ?`,
+		submission.ProblemID)
+	if err != nil {
+		return fmt.Errorf("failed to count submission: %w", err)
+	}
+
+	if err := insertOutboxEntry(ctx, tx, int(id), submission.UserID, lane, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit submission: %w", err)
+	}
+
 	submission.ID = int(id)
 	return nil
 }
 
-func (r *codeRepository) GetSubmissionsByUserAndProblem(ctx context.Context, userID int, problemID int) ([]models.SubmissionListItem, error) {
-	query := `SELECT id, language_id, status, submitted_at 
-              FROM submissions 
-              WHERE user_id = ? AND problem_id = ? 
-              ORDER BY submitted_at DESC`
+// ListSubmissions returns one page of the submissions matching filter,
+// newest first. Pages are keyed by submission ID, so submissions arriving
+// meanwhile do not shift the following pages.
+func (r *codeRepository) ListSubmissions(ctx context.Context, filter models.SubmissionFilter) ([]models.SubmissionListItem, error) {
+	where, args := submissionFilterClause(filter, "")
 
-	var submissions []models.SubmissionListItem
-	if err := r.db.SelectContext(ctx, &submissions, query, userID, problemID); err != nil {
-		return nil, fmt.Errorf("failed to get user submissions: %w", err)
+	query := `SELECT id, problem_id, language_id, status, submitted_at FROM submissions` + where +
+		` ORDER BY id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	submissions := []models.SubmissionListItem{}
+	if err := r.db.SelectContext(ctx, &submissions, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list submissions: %w", err)
 	}
 
 	return submissions, nil
 }
 
-func (r *codeRepository) UpdateSubmissionStatus(ctx context.Context, submissionID int, status string, wrongTestcase *int, wrongOutput *string) error {
-	query := `UPDATE submissions SET status = ?, wrong_testcase = ?, program_output = ? WHERE id = ?`
+const statusEntryColumns = `s.id, s.user_id, u.username, s.problem_id, p.title AS problem_title,
+                  s.language_id, s.status, j.execution_ms, s.visibility, s.submitted_at`
+
+const statusEntryJoins = ` FROM submissions s
+              JOIN users u ON u.id = s.user_id
+              JOIN problems p ON p.id = s.problem_id
+              LEFT JOIN judgements j ON j.id = s.current_judgement_id`
+
+// ListStatus returns one page of the status page, newest first, with the
+// same filtering and cursor as ListSubmissions.
+func (r *codeRepository) ListStatus(ctx context.Context, filter models.SubmissionFilter) ([]models.StatusEntry, error) {
+	where, args := submissionFilterClause(filter, "s.")
+
+	query := `SELECT ` + statusEntryColumns + statusEntryJoins + where + ` ORDER BY s.id DESC LIMIT ?`
+	args = append(args, filter.Limit)
+
+	entries := []models.StatusEntry{}
+	if err := r.db.SelectContext(ctx, &entries, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to list status: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *codeRepository) GetStatusDetail(ctx context.Context, submissionID int) (*models.StatusDetail, error) {
+	query := `SELECT ` + statusEntryColumns + `, s.source_code` + statusEntryJoins + ` WHERE s.id = ?`
+
+	var detail models.StatusDetail
+	if err := r.db.GetContext(ctx, &detail, query, submissionID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("submission not found: %d", submissionID)
+		}
+		return nil, fmt.Errorf("failed to get submission: %w", err)
+	}
 
-	_, err := r.db.ExecContext(ctx, query, status, wrongTestcase, wrongOutput, submissionID)
+	return &detail, nil
+}
+
+// SetVisibility changes who can read a submission and returns its share
+// token. Shared submissions keep their token when switching between link and
+// public; making a submission private revokes it, and sharing it again later
+// creates a new one.
+func (r *codeRepository) SetVisibility(ctx context.Context, submissionID int, userID int, visibility string) (string, error) {
+	var shareToken *string
+	if visibility != models.VisibilityPrivate {
+		token, err := utils.GenerateToken(24)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate share token: %w", err)
+		}
+		shareToken = &token
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
 	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		UserID     int     `db:"user_id"`
+		ShareToken *string `db:"share_token"`
+	}
+	err = tx.GetContext(ctx, &current, `SELECT user_id, share_token FROM submissions WHERE id = ? FOR UPDATE`, submissionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("submission not found or access denied: %d", submissionID)
+		}
+		return "", fmt.Errorf("failed to get submission: %w", err)
+	}
+	if current.UserID != userID {
+		return "", fmt.Errorf("submission not found or access denied: %d", submissionID)
+	}
+
+	if shareToken != nil && current.ShareToken != nil {
+		shareToken = current.ShareToken
+	}
+
+	query := `UPDATE submissions SET visibility = ?, share_token = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, visibility, shareToken, submissionID); err != nil {
+		return "", fmt.Errorf("failed to set submission visibility: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit submission visibility: %w", err)
+	}
+
+	if shareToken == nil {
+		return "", nil
+	}
+	return *shareToken, nil
+}
+
+// GetSharedSubmission returns a submission shared by link or public, by its share token
+func (r *codeRepository) GetSharedSubmission(ctx context.Context, shareToken string) (*models.StatusDetail, error) {
+	query := `SELECT ` + statusEntryColumns + `, s.source_code` + statusEntryJoins +
+		` WHERE s.share_token = ? AND s.visibility IN (?, ?)`
+
+	var detail models.StatusDetail
+	err := r.db.GetContext(ctx, &detail, query, shareToken, models.VisibilityLink, models.VisibilityPublic)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("shared submission not found")
+		}
+		return nil, fmt.Errorf("failed to get shared submission: %w", err)
+	}
+
+	return &detail, nil
+}
+
+func (r *codeRepository) HasSolvedProblem(ctx context.Context, userID int, problemID int) (bool, error) {
+	query := `SELECT EXISTS(SELECT 1 FROM submissions WHERE user_id = ? AND problem_id = ? AND status = ?)`
+
+	var solved bool
+	if err := r.db.GetContext(ctx, &solved, query, userID, problemID, models.StatusAccepted); err != nil {
+		return false, fmt.Errorf("failed to check solved problem: %w", err)
+	}
+
+	return solved, nil
+}
+
+// submissionFilterClause builds the WHERE clause of a submission listing,
+// prefixing the columns with the submissions table alias.
+func submissionFilterClause(filter models.SubmissionFilter, alias string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.UserID != nil {
+		conditions = append(conditions, alias+"user_id = ?")
+		args = append(args, *filter.UserID)
+	}
+	if filter.ProblemID != nil {
+		conditions = append(conditions, alias+"problem_id = ?")
+		args = append(args, *filter.ProblemID)
+	}
+	if filter.LanguageID != nil {
+		conditions = append(conditions, alias+"language_id = ?")
+		args = append(args, *filter.LanguageID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, alias+"status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, alias+"submitted_at >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, alias+"submitted_at < ?")
+		args = append(args, *filter.To)
+	}
+	if filter.Cursor > 0 {
+		conditions = append(conditions, alias+"id < ?")
+		args = append(args, filter.Cursor)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return ` WHERE ` + strings.Join(conditions, " AND "), args
+}
+
+// RecordJudgement stores a judging attempt and makes it the current verdict
+// of its submission. Nothing is stored unless the submission is still being
+// judged by this attempt: it may have been cancelled meanwhile, or given up
+// on by the sweeper and queued again.
+func (r *codeRepository) RecordJudgement(ctx context.Context, judgement *models.Judgement) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var previous struct {
+		ProblemID    int    `db:"problem_id"`
+		Status       string `db:"status"`
+		RequeueCount int    `db:"requeue_count"`
+	}
+	err = tx.GetContext(ctx, &previous, `SELECT problem_id, status, requeue_count FROM submissions WHERE id = ? FOR UPDATE`,
+		judgement.SubmissionID)
+	if err != nil {
+		return fmt.Errorf("failed to get submission status: %w", err)
+	}
+	if previous.Status != models.StatusProcessing || previous.RequeueCount != judgement.Attempt {
+		return nil
+	}
+
+	judgement.ID, err = insertJudgement(ctx, tx, judgement)
+	if err != nil {
+		return err
+	}
+
+	updateQuery := `UPDATE submissions SET status = ?, current_judgement_id = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, updateQuery, judgement.Status, judgement.ID, judgement.SubmissionID); err != nil {
 		return fmt.Errorf("failed to update submission status: %w", err)
 	}
 
+	if err := countAccepted(ctx, tx, previous.ProblemID, previous.Status, judgement.Status); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit judgement: %w", err)
+	}
+
+	judgement.IsCurrent = true
 	return nil
 }
+
+func insertJudgement(ctx context.Context, tx *sqlx.Tx, judgement *models.Judgement) (int, error) {
+	insertQuery := `INSERT INTO judgements (submission_id, worker_id, toolchain, test_set_version, status, 
+                        wrong_testcase, program_output, test_results, started_at, finished_at, execution_ms) 
+                    VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := tx.ExecContext(ctx, insertQuery,
+		judgement.SubmissionID,
+		judgement.WorkerID,
+		judgement.Toolchain,
+		judgement.TestSetVersion,
+		judgement.Status,
+		judgement.WrongTestcase,
+		judgement.ProgramOutput,
+		judgement.TestResults,
+		judgement.StartedAt,
+		judgement.FinishedAt,
+		judgement.ExecutionMs,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert judgement: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	return int(id), nil
+}
+
+// countAccepted keeps the accepted submissions count of a problem in step
+// with a submission's status changing from previous to status
+func countAccepted(ctx context.Context, tx *sqlx.Tx, problemID int, previous, status string) error {
+	delta := 0
+	if status == models.StatusAccepted {
+		delta++
+	}
+	if previous == models.StatusAccepted {
+		delta--
+	}
+	if delta == 0 {
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE problems SET accepted_submissions = accepted_submissions + ? WHERE id = ?`,
+		delta, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to count accepted submissions: %w", err)
+	}
+	return nil
+}
+
+// GetJudgements returns the verdict history of a submission, newest first
+func (r *codeRepository) GetJudgements(ctx context.Context, submissionID int, userID int) ([]models.JudgementResponse, error) {
+	query := `SELECT j.id, j.submission_id, j.toolchain, j.test_set_version, j.status, j.wrong_testcase, 
+                  j.test_results, j.started_at, j.finished_at, j.execution_ms, 
+                  (j.id = s.current_judgement_id) AS is_current
+              FROM judgements j
+              JOIN submissions s ON s.id = j.submission_id
+              WHERE j.submission_id = ? AND s.user_id = ?
+              ORDER BY j.id DESC`
+
+	var judgements []models.Judgement
+	if err := r.db.SelectContext(ctx, &judgements, query, submissionID, userID); err != nil {
+		return nil, fmt.Errorf("failed to get judgements: %w", err)
+	}
+
+	visible, err := r.visibleTestCases(ctx, judgements)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]models.JudgementResponse, len(judgements))
+	for i, judgement := range judgements {
+		response := models.JudgementResponse{
+			ID:             judgement.ID,
+			SubmissionID:   judgement.SubmissionID,
+			Toolchain:      judgement.Toolchain,
+			TestSetVersion: judgement.TestSetVersion,
+			Status:         judgement.Status,
+			TestResults:    make([]models.JudgementTestResponse, len(judgement.TestResults)),
+			StartedAt:      judgement.StartedAt,
+			FinishedAt:     judgement.FinishedAt,
+			ExecutionMs:    judgement.ExecutionMs,
+			IsCurrent:      judgement.IsCurrent,
+		}
+		for j, result := range judgement.TestResults {
+			test := models.JudgementTestResponse{Index: j + 1, Passed: result.Passed, DurationMs: result.DurationMs}
+			if visible[result.TestCaseID] {
+				test.TestCaseID = &result.TestCaseID
+			}
+			response.TestResults[j] = test
+		}
+		if judgement.WrongTestcase != nil {
+			response.FailedTest = failedTest(judgement.Status, *judgement.WrongTestcase, judgement.TestResults,
+				visible[*judgement.WrongTestcase])
+		}
+		responses[i] = response
+	}
+
+	return responses, nil
+}
+
+// visibleTestCases returns which of the tests judgements ran are visible.
+// Deleted tests count as hidden.
+func (r *codeRepository) visibleTestCases(ctx context.Context, judgements []models.Judgement) (map[int]bool, error) {
+	visible := make(map[int]bool)
+	var ids []int
+	for _, judgement := range judgements {
+		for _, result := range judgement.TestResults {
+			ids = append(ids, result.TestCaseID)
+		}
+		if judgement.WrongTestcase != nil {
+			ids = append(ids, *judgement.WrongTestcase)
+		}
+	}
+	if len(ids) == 0 {
+		return visible, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT id FROM test_cases WHERE id IN (?) AND visible`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build visible tests query: %w", err)
+	}
+	var visibleIDs []int
+	if err := r.db.SelectContext(ctx, &visibleIDs, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get visible tests: %w", err)
+	}
+	for _, id := range visibleIDs {
+		visible[id] = true
+	}
+	return visible, nil
+}
+
+// failedTest describes the test a verdict was given on, numbered by the
+// order the tests ran
+func failedTest(verdict string, testCaseID int, results models.JudgementTestResults, visible bool) *models.FailedTest {
+	failed := &models.FailedTest{Verdict: verdict, Hidden: !visible}
+	for i, result := range results {
+		if result.TestCaseID == testCaseID {
+			index := i + 1
+			failed.Index = &index
+			break
+		}
+	}
+	return failed
+}
+
+// MarkProcessing moves a pending submission to PROCESSING when a worker
+// starts judging it, as the given attempt: its requeue count. It reports
+// false if the submission is no longer pending, or was queued again.
+func (r *codeRepository) MarkProcessing(ctx context.Context, submissionID int, attempt int) (bool, error) {
+	query := `UPDATE submissions SET status = ?, processing_started_at = NOW(3)
+              WHERE id = ? AND status = ? AND requeue_count = ?`
+
+	result, err := r.db.ExecContext(ctx, query, models.StatusProcessing, submissionID, models.StatusPending, attempt)
+	if err != nil {
+		return false, fmt.Errorf("failed to mark submission as processing: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// GetStuckSubmissions returns submissions that have been PROCESSING for longer
+// than stuckFor, most likely because the worker judging them died, and
+// submissions PENDING for longer than that with no outbox entry left to
+// publish, whose job may have been lost from the queue.
+func (r *codeRepository) GetStuckSubmissions(ctx context.Context, stuckFor time.Duration, limit int) ([]models.Submission, error) {
+	query := `SELECT s.id, s.user_id, s.problem_id, s.language_id, s.status, s.requeue_count,
+                  s.queue_lane, s.rejudge_id, s.submitted_at
+              FROM submissions s
+              WHERE (s.status = ? AND COALESCE(s.processing_started_at, s.submitted_at) < NOW(3) - INTERVAL ? SECOND)
+                 OR (s.status = ? AND COALESCE(s.queued_at, s.submitted_at) < NOW(3) - INTERVAL ? SECOND
+                     AND NOT EXISTS (SELECT 1 FROM submission_outbox o
+                                     WHERE o.submission_id = s.id AND o.published_at IS NULL))
+              ORDER BY s.id
+              LIMIT ?`
+
+	seconds := int(stuckFor.Seconds())
+	var submissions []models.Submission
+	err := r.db.SelectContext(ctx, &submissions, query,
+		models.StatusProcessing, seconds, models.StatusPending, seconds, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stuck submissions: %w", err)
+	}
+
+	return submissions, nil
+}
+
+// RequeueSubmission puts a stuck submission back to PENDING and into the
+// outbox, on the lane and rejudge it was queued for before. It reports false
+// if the submission's status changed since it was found stuck.
+func (r *codeRepository) RequeueSubmission(ctx context.Context, submission *models.Submission) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE submissions
+              SET status = ?, processing_started_at = NULL, queued_at = NOW(3), requeue_count = requeue_count + 1
+              WHERE id = ? AND status = ?`
+
+	result, err := tx.ExecContext(ctx, query, models.StatusPending, submission.ID, submission.Status)
+	if err != nil {
+		return false, fmt.Errorf("failed to requeue submission: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return false, nil
+	}
+
+	lane, err := services.ParseLane(submission.QueueLane)
+	if err != nil {
+		lane = services.LaneNormal
+	}
+	if err := insertOutboxEntry(ctx, tx, submission.ID, submission.UserID, lane, submission.RejudgeID); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit requeue: %w", err)
+	}
+
+	return true, nil
+}
+
+// FailSubmission gives up on a stuck submission: it records an
+// INTERNAL_ERROR judgement as its verdict and, for a rejudge, as the result
+// of its rejudge item. It reports false if the submission's status is not
+// the given one anymore.
+func (r *codeRepository) FailSubmission(ctx context.Context, submissionID int, status string) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var submission struct {
+		ProblemID           int        `db:"problem_id"`
+		Status              string     `db:"status"`
+		RejudgeID           *int       `db:"rejudge_id"`
+		ProcessingStartedAt *time.Time `db:"processing_started_at"`
+	}
+	err = tx.GetContext(ctx, &submission,
+		`SELECT problem_id, status, rejudge_id, processing_started_at FROM submissions WHERE id = ? FOR UPDATE`,
+		submissionID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get submission status: %w", err)
+	}
+	if submission.Status != status {
+		return false, nil
+	}
+
+	now := time.Now()
+	judgement := &models.Judgement{
+		SubmissionID: submissionID,
+		WorkerID:     "StuckSubmissionSweeper",
+		Toolchain:    "unknown",
+		Status:       models.StatusInternalError,
+		StartedAt:    now,
+		FinishedAt:   now,
+	}
+	if submission.ProcessingStartedAt != nil {
+		judgement.StartedAt = *submission.ProcessingStartedAt
+	}
+	judgement.ID, err = insertJudgement(ctx, tx, judgement)
+	if err != nil {
+		return false, err
+	}
+
+	query := `UPDATE submissions SET status = ?, current_judgement_id = ?, processing_started_at = NULL WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, models.StatusInternalError, judgement.ID, submissionID); err != nil {
+		return false, fmt.Errorf("failed to fail submission: %w", err)
+	}
+
+	if submission.RejudgeID != nil {
+		_, err := tx.ExecContext(ctx,
+			`UPDATE rejudge_items SET new_status = ?, new_judgement_id = ?, judged_at = NOW()
+             WHERE rejudge_id = ? AND submission_id = ?`,
+			models.StatusInternalError, judgement.ID, *submission.RejudgeID, submissionID,
+		)
+		if err != nil {
+			return false, fmt.Errorf("failed to record rejudge result: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit failed submission: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *codeRepository) CancelSubmission(ctx context.Context, submissionID int, userID int) error {
+	// A submission being rejudged already has a verdict, which the rejudge
+	// restores or replaces; cancelling would lose it along with the rejudge item
+	query := `UPDATE submissions SET status = ? 
+              WHERE id = ? AND user_id = ? AND status IN (?, ?)
+                AND NOT EXISTS (SELECT 1 FROM judgements j WHERE j.submission_id = submissions.id)
+                AND NOT EXISTS (SELECT 1 FROM rejudge_items ri
+                                WHERE ri.submission_id = submissions.id AND ri.new_status IS NULL)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		models.StatusCancelled, submissionID, userID,
+		models.StatusPending, models.StatusProcessing,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel submission: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var status string
+	err = r.db.GetContext(ctx, &status, `SELECT status FROM submissions WHERE id = ? AND user_id = ?`, submissionID, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("submission not found or access denied: %d", submissionID)
+		}
+		return fmt.Errorf("failed to get submission status: %w", err)
+	}
+
+	if status == models.StatusPending || status == models.StatusProcessing {
+		return fmt.Errorf("submission %d is being rejudged and cannot be cancelled", submissionID)
+	}
+	return fmt.Errorf("submission %d is already finished with status %s", submissionID, status)
+}
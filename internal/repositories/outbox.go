@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"HAB/internal/models"
+	"HAB/internal/services"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type OutboxRepository interface {
+	RelayPending(ctx context.Context, limit int, publish func(ctx context.Context, entry models.OutboxEntry) error) (int, error)
+	DeletePublished(ctx context.Context, olderThan time.Duration) (int64, error)
+}
+
+type outboxRepository struct {
+	db *sqlx.DB
+}
+
+func NewOutboxRepository(db *sqlx.DB) OutboxRepository {
+	return &outboxRepository{db: db}
+}
+
+// insertOutboxEntry queues a submission as part of the transaction that created or reset it
+func insertOutboxEntry(ctx context.Context, tx *sqlx.Tx, submissionID, userID int, lane services.Lane, rejudgeID *int) error {
+	query := `INSERT INTO submission_outbox (submission_id, user_id, lane, rejudge_id) VALUES (?, ?, ?, ?)`
+
+	if _, err := tx.ExecContext(ctx, query, submissionID, userID, string(lane), rejudgeID); err != nil {
+		return fmt.Errorf("failed to add submission %d to the outbox: %w", submissionID, err)
+	}
+
+	return nil
+}
+
+// RelayPending locks up to limit unpublished entries, oldest first, and hands
+// them to publish one by one. Entries that were published are marked as such;
+// on the first failure the attempt is recorded and relaying stops, so that
+// entries keep their order. Entries locked by another relay are skipped.
+func (r *outboxRepository) RelayPending(ctx context.Context, limit int, publish func(ctx context.Context, entry models.OutboxEntry) error) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `SELECT id, submission_id, user_id, lane, rejudge_id, attempts, created_at, published_at
+              FROM submission_outbox
+              WHERE published_at IS NULL
+              ORDER BY id
+              LIMIT ?
+              FOR UPDATE SKIP LOCKED`
+
+	var entries []models.OutboxEntry
+	if err := tx.SelectContext(ctx, &entries, query, limit); err != nil {
+		return 0, fmt.Errorf("failed to get outbox entries: %w", err)
+	}
+
+	published := 0
+	var publishErr error
+	for _, entry := range entries {
+		if err := publish(ctx, entry); err != nil {
+			publishErr = fmt.Errorf("failed to publish outbox entry %d: %w", entry.ID, err)
+
+			lastError := err.Error()
+			if len(lastError) > 1024 {
+				lastError = lastError[:1024]
+			}
+			_, err := tx.ExecContext(ctx,
+				`UPDATE submission_outbox SET attempts = attempts + 1, last_error = ? WHERE id = ?`,
+				lastError, entry.ID)
+			if err != nil {
+				return published, fmt.Errorf("failed to record outbox failure: %w", err)
+			}
+			break
+		}
+
+		_, err := tx.ExecContext(ctx,
+			`UPDATE submission_outbox SET published_at = NOW(3), attempts = attempts + 1 WHERE id = ?`,
+			entry.ID)
+		if err != nil {
+			return published, fmt.Errorf("failed to mark outbox entry as published: %w", err)
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit outbox relay: %w", err)
+	}
+
+	return published, publishErr
+}
+
+// DeletePublished removes entries published more than olderThan ago
+func (r *outboxRepository) DeletePublished(ctx context.Context, olderThan time.Duration) (int64, error) {
+	query := `DELETE FROM submission_outbox
+              WHERE published_at IS NOT NULL AND published_at < NOW(3) - INTERVAL ? SECOND`
+
+	result, err := r.db.ExecContext(ctx, query, int(olderThan.Seconds()))
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete published outbox entries: %w", err)
+	}
+
+	return result.RowsAffected()
+}
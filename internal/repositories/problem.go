@@ -7,46 +7,307 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 type ProblemRepository interface {
-	GetProblems(ctx context.Context) ([]models.ProblemListItem, error)
+	ListProblems(ctx context.Context, filter models.ProblemFilter) ([]models.ProblemListItem, int, error)
+	ListTags(ctx context.Context) ([]models.TagCount, error)
+	SetProblemTags(ctx context.Context, problemID int, tags []string) error
 	GetProblemByID(ctx context.Context, problemID int) (*models.ProblemDetail, error)
 	GetStarterCode(ctx context.Context, problemID int) (map[int]string, error)
 	GetSolvedProblemIDs(ctx context.Context, userID int) (map[int]bool, error)
+
+	CreateProblem(ctx context.Context, req *models.ProblemRequest) (int, error)
+	UpdateProblem(ctx context.Context, problemID int, req *models.ProblemRequest) error
+	DeleteProblem(ctx context.Context, problemID int) error
+	ListTestCases(ctx context.Context, problemID int) (*models.TestSet, []models.TestCase, error)
+	CreateTestCase(ctx context.Context, problemID int, req *models.TestCaseRequest) (*models.TestCase, error)
+	UpdateTestCase(ctx context.Context, problemID int, testCaseID int, req *models.TestCaseRequest) (int, error)
+	DeleteTestCase(ctx context.Context, problemID int, testCaseID int) error
+	ListTestSets(ctx context.Context, problemID int) ([]models.TestSet, error)
+	PublishTestSet(ctx context.Context, problemID int) (int, error)
+	DiscardTestSetDraft(ctx context.Context, problemID int) error
+	StoreTestCase(ctx context.Context, req *models.TestCaseRequest) (*models.TestCase, error)
+	PublishGeneratedTests(ctx context.Context, problemID int, script string, testCases []models.TestCase, keepExisting bool) (int, error)
+	ListPrograms(ctx context.Context, problemID int) ([]models.ProblemProgram, error)
+	SetProgram(ctx context.Context, problemID int, name string, req *models.ProblemProgramRequest) error
+	DeleteProgram(ctx context.Context, problemID int, name string) error
+	ListAttachments(ctx context.Context, problemID int) ([]models.ProblemAttachment, error)
+	GetAttachment(ctx context.Context, problemID int, name string) (*models.ProblemAttachment, []byte, error)
+	SetAttachment(ctx context.Context, problemID int, name string, data []byte) (*models.ProblemAttachment, error)
+	DeleteAttachment(ctx context.Context, problemID int, name string) error
+	GetProblemCode(ctx context.Context, problemID int, languageID int) (*models.ProblemLanguageCode, error)
+	SetProblemCode(ctx context.Context, problemID int, languageID int, kind string, code string) error
+	DeleteProblemCode(ctx context.Context, problemID int, languageID int, kind string) error
+
+	ExportProblem(ctx context.Context, problemID int) (*models.ProblemPackage, error)
+	ImportProblem(ctx context.Context, pkg *models.ProblemPackage) (int, error)
+}
+
+// problemCodeTables maps each kind of per-language problem code to its table
+var problemCodeTables = map[string]string{
+	models.ProblemCodeStarter: "starter_code",
+	models.ProblemCodeSystem:  "system_code",
+	models.ProblemCodeImports: "language_imports",
 }
 
 type problemRepository struct {
 	db    *sqlx.DB
 	cache services.Cache
+	blobs services.BlobStore
+	// Test files larger than this many bytes go to the blob store
+	inlineLimit int
+}
+
+func NewProblemRepository(db *sqlx.DB, cache services.Cache, blobs services.BlobStore, inlineLimit int) ProblemRepository {
+	return &problemRepository{db: db, cache: cache, blobs: blobs, inlineLimit: inlineLimit}
+}
+
+// problemListVersionKey is bumped on every problem write. Cached problem
+// lists are keyed by it, so a write invalidates every cached query at once.
+const problemListVersionKey = "problems:list:version"
+
+// problemListPage is a page of the problem list as cached
+type problemListPage struct {
+	Problems []models.ProblemListItem `json:"problems"`
+	Total    int                      `json:"total"`
+}
+
+// ListProblems returns the page of problems matching the filter, in its
+// order, and how many match in all. Whether each problem is solved is left
+// to the caller, so pages without a search or solved filter are cached and
+// shared by all users.
+func (r *problemRepository) ListProblems(ctx context.Context, filter models.ProblemFilter) ([]models.ProblemListItem, int, error) {
+	var version int64
+	if err := r.cache.Get(ctx, problemListVersionKey, &version); err != nil && err != redis.Nil {
+		logger.Log.Warn("Failed to get problem list version", zap.Error(err))
+	}
+
+	cacheKey := ""
+	if filter.Search == "" && filter.Solved == nil {
+		cacheKey = fmt.Sprintf("problems:list:v%d:%s:%s:%s:%d:%d",
+			version, filter.Difficulty, strings.Join(filter.Tags, ","), filter.Sort, filter.Page, filter.Limit)
+	}
+
+	var page problemListPage
+	if cacheKey != "" {
+		if err := r.cache.Get(ctx, cacheKey, &page); err == nil {
+			logger.Log.Info("Cache hit, returning problem list...")
+			return page.Problems, page.Total, nil // Cache hit
+		}
+		logger.Log.Info("Problem list not in cache, retrieving database")
+	}
+
+	where := ` WHERE 1 = 1`
+	var args []interface{}
+
+	if filter.Difficulty != "" {
+		where += ` AND p.difficulty = ?`
+		args = append(args, filter.Difficulty)
+	}
+
+	search := fullTextQuery(filter.Search)
+	if filter.Search != "" {
+		if search == "" {
+			return []models.ProblemListItem{}, 0, nil
+		}
+		where += ` AND MATCH(p.title, p.description) AGAINST (? IN BOOLEAN MODE)`
+		args = append(args, search)
+	}
+
+	if len(filter.Tags) > 0 {
+		tagQuery, tagArgs, err := sqlx.In(`SELECT pt.problem_id FROM problem_tags pt
+                  JOIN tags t ON t.id = pt.tag_id
+                  WHERE t.name IN (?)
+                  GROUP BY pt.problem_id HAVING COUNT(*) = ?`, filter.Tags, len(filter.Tags))
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to build tag filter: %w", err)
+		}
+		where += ` AND p.id IN (` + tagQuery + `)`
+		args = append(args, tagArgs...)
+	}
+
+	if filter.Solved != nil {
+		solved := ` EXISTS (SELECT 1 FROM submissions s
+                  WHERE s.problem_id = p.id AND s.user_id = ? AND s.status = ?)`
+		if !*filter.Solved {
+			solved = ` NOT` + solved
+		}
+		where += ` AND` + solved
+		args = append(args, filter.UserID, models.StatusAccepted)
+	}
+
+	if err := r.db.GetContext(ctx, &page.Total, `SELECT COUNT(*) FROM problems p`+where, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count problems: %w", err)
+	}
+
+	query := `SELECT p.id, p.title, p.difficulty, p.total_submissions, p.accepted_submissions
+              FROM problems p` + where
+
+	switch filter.Sort {
+	case models.ProblemSortNewest:
+		query += ` ORDER BY p.id DESC`
+	case models.ProblemSortAcceptance:
+		query += ` ORDER BY COALESCE(p.accepted_submissions / p.total_submissions, 0) DESC, p.id`
+	case models.ProblemSortRelevance:
+		query += ` ORDER BY MATCH(p.title, p.description) AGAINST (? IN BOOLEAN MODE) DESC, p.id`
+		args = append(args, search)
+	default:
+		query += ` ORDER BY p.id`
+	}
+	query += ` LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, (filter.Page-1)*filter.Limit)
+
+	page.Problems = []models.ProblemListItem{}
+	if err := r.db.SelectContext(ctx, &page.Problems, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to get problems: %w", err)
+	}
+	problems := page.Problems
+
+	problemIDs := make([]int, len(problems))
+	for i := range problems {
+		problemIDs[i] = problems[i].ID
+	}
+	tags, err := r.getTags(ctx, problemIDs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range problems {
+		problems[i].Tags = tags[problems[i].ID]
+		if problems[i].Tags == nil {
+			problems[i].Tags = []string{}
+		}
+		if problems[i].TotalSubmissions > 0 {
+			problems[i].AcceptanceRate = float64(problems[i].AcceptedSubmissions) / float64(problems[i].TotalSubmissions) * 100
+		}
+	}
+
+	// Kept short, as submissions change the acceptance rates
+	if cacheKey != "" {
+		_ = r.cache.Set(ctx, cacheKey, page, 10*time.Minute)
+	}
+
+	return problems, page.Total, nil
+}
+
+// fullTextQuery turns a search into a boolean full-text query requiring
+// every word, as a prefix so partly typed words match. Operators typed by
+// users are dropped.
+func fullTextQuery(search string) string {
+	words := strings.FieldsFunc(search, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, len(words))
+	for i, word := range words {
+		terms[i] = "+" + word + "*"
+	}
+	return strings.Join(terms, " ")
+}
+
+// getTags returns the tags of each of the problems, sorted by name
+func (r *problemRepository) getTags(ctx context.Context, problemIDs []int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(problemIDs) == 0 {
+		return tags, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT pt.problem_id, t.name FROM problem_tags pt
+              JOIN tags t ON t.id = pt.tag_id
+              WHERE pt.problem_id IN (?)
+              ORDER BY t.name`, problemIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tags query: %w", err)
+	}
+
+	var rows []struct {
+		ProblemID int    `db:"problem_id"`
+		Name      string `db:"name"`
+	}
+	if err := r.db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to get problem tags: %w", err)
+	}
+
+	for _, row := range rows {
+		tags[row.ProblemID] = append(tags[row.ProblemID], row.Name)
+	}
+	return tags, nil
 }
 
-func NewProblemRepository(db *sqlx.DB, cache services.Cache) ProblemRepository {
-	return &problemRepository{db: db, cache: cache}
+// ListTags returns the tags in use with their number of problems
+func (r *problemRepository) ListTags(ctx context.Context) ([]models.TagCount, error) {
+	query := `SELECT t.name, COUNT(*) AS problems FROM tags t
+              JOIN problem_tags pt ON pt.tag_id = t.id
+              GROUP BY t.id, t.name
+              ORDER BY t.name`
+
+	tags := []models.TagCount{}
+	if err := r.db.SelectContext(ctx, &tags, query); err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	return tags, nil
 }
 
-func (r *problemRepository) GetProblems(ctx context.Context) ([]models.ProblemListItem, error) {
-	cacheKey := "problems:list"
-	var problems []models.ProblemListItem
+// SetProblemTags replaces the tags of a problem
+func (r *problemRepository) SetProblemTags(ctx context.Context, problemID int, tags []string) error {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := replaceProblemTags(ctx, tx, problemID, tags); err != nil {
+		return err
+	}
 
-	if err := r.cache.Get(ctx, cacheKey, &problems); err == nil {
-		logger.Log.Info("Cache hit, returning problem list...")
-		return problems, nil // Cache hit
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit problem tags: %w", err)
 	}
 
-	logger.Log.Info("Problem list not in cache, retrieving database")
+	r.invalidateProblemCache(ctx, problemID)
+
+	return nil
+}
+
+// replaceProblemTags sets the tags of a problem within tx, creating the
+// tags that do not exist yet
+func replaceProblemTags(ctx context.Context, tx *sqlx.Tx, problemID int, tags []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM problem_tags WHERE problem_id = ?`, problemID); err != nil {
+		return fmt.Errorf("failed to clear problem tags: %w", err)
+	}
+	if len(tags) == 0 {
+		return nil
+	}
 
-	query := `SELECT id, title, difficulty FROM problems`
-	if err := r.db.SelectContext(ctx, &problems, query); err != nil {
-		return nil, fmt.Errorf("failed to get problems: %w", err)
+	for _, tag := range tags {
+		if _, err := tx.ExecContext(ctx, `INSERT IGNORE INTO tags (name) VALUES (?)`, tag); err != nil {
+			return fmt.Errorf("failed to create tag: %w", err)
+		}
 	}
 
-	_ = r.cache.Set(ctx, cacheKey, problems, 4*time.Hour)
+	query, args, err := sqlx.In(`INSERT INTO problem_tags (problem_id, tag_id)
+              SELECT ?, id FROM tags WHERE name IN (?)`, problemID, tags)
+	if err != nil {
+		return fmt.Errorf("failed to build tags query: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set problem tags: %w", err)
+	}
 
-	return problems, nil
+	return nil
 }
 
 func (r *problemRepository) GetProblemByID(ctx context.Context, problemID int) (*models.ProblemDetail, error) {
@@ -58,7 +319,8 @@ func (r *problemRepository) GetProblemByID(ctx context.Context, problemID int) (
 		return &problem, nil
 	}
 	logger.Log.Info("Problem details not in cache, retrieving database")
-	query := `SELECT id, title, description, difficulty, sample_input, sample_output 
+	query := `SELECT id, title, description, difficulty, sample_input, sample_output, time_limit_ms, memory_limit_mb,
+                  total_submissions, accepted_submissions
               FROM problems WHERE id = ?`
 
 	if err := r.db.GetContext(ctx, &problem, query, problemID); err != nil {
@@ -68,27 +330,14 @@ func (r *problemRepository) GetProblemByID(ctx context.Context, problemID int) (
 		return nil, fmt.Errorf("failed to get problem: %w", err)
 	}
 
-	statsQuery := `
-        SELECT 
-            COUNT(*) as total_submissions,
-            COUNT(CASE WHEN status = 'ACCEPTED' THEN 1 END) as accepted_submissions
-        FROM submissions 
-        WHERE problem_id = ?`
-
-	var stats struct {
-		TotalSubmissions    int `db:"total_submissions"`
-		AcceptedSubmissions int `db:"accepted_submissions"`
-	}
-	if err := r.db.GetContext(ctx, &stats, statsQuery, problemID); err != nil {
-		return nil, fmt.Errorf("failed to get submission stats: %w", err)
+	descriptionHTML, err := services.RenderStatement(problemID, problem.Description)
+	if err != nil {
+		return nil, err
 	}
+	problem.DescriptionHTML = descriptionHTML
 
-	problem.TotalSubmissions = stats.TotalSubmissions
-	problem.AcceptedSubmissions = stats.AcceptedSubmissions
-	if stats.TotalSubmissions > 0 {
-		problem.AcceptanceRate = (float64(stats.AcceptedSubmissions) / float64(stats.TotalSubmissions)) * 100
-	} else {
-		problem.AcceptanceRate = 0
+	if problem.TotalSubmissions > 0 {
+		problem.AcceptanceRate = (float64(problem.AcceptedSubmissions) / float64(problem.TotalSubmissions)) * 100
 	}
 
 	starterCode, err := r.GetStarterCode(ctx, problemID)
@@ -98,6 +347,15 @@ func (r *problemRepository) GetProblemByID(ctx context.Context, problemID int) (
 
 	problem.StarterCode = starterCode
 
+	tags, err := r.getTags(ctx, []int{problemID})
+	if err != nil {
+		return nil, err
+	}
+	problem.Tags = tags[problemID]
+	if problem.Tags == nil {
+		problem.Tags = []string{}
+	}
+
 	_ = r.cache.Set(ctx, cacheKey, problem, 4*time.Hour)
 
 	return &problem, nil
@@ -139,3 +397,1139 @@ func (r *problemRepository) GetSolvedProblemIDs(ctx context.Context, userID int)
 
 	return solvedMap, nil
 }
+
+func (r *problemRepository) CreateProblem(ctx context.Context, req *models.ProblemRequest) (int, error) {
+	query := `INSERT INTO problems (title, description, difficulty, sample_input, sample_output, time_limit_ms, memory_limit_mb, checker) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+
+	result, err := r.db.ExecContext(ctx, query,
+		req.Title, req.Description, req.Difficulty, req.SampleInput, req.SampleOutput,
+		req.TimeLimitMs, req.MemoryLimitMB, req.Checker)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create problem: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	r.invalidateProblemCache(ctx, int(id))
+
+	return int(id), nil
+}
+
+func (r *problemRepository) UpdateProblem(ctx context.Context, problemID int, req *models.ProblemRequest) error {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	query := `UPDATE problems 
+              SET title = ?, description = ?, difficulty = ?, sample_input = ?, sample_output = ?, 
+                  time_limit_ms = ?, memory_limit_mb = ?, checker = ? 
+              WHERE id = ?`
+
+	_, err := r.db.ExecContext(ctx, query,
+		req.Title, req.Description, req.Difficulty, req.SampleInput, req.SampleOutput,
+		req.TimeLimitMs, req.MemoryLimitMB, req.Checker, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to update problem: %w", err)
+	}
+
+	r.invalidateProblemCache(ctx, problemID)
+
+	return nil
+}
+
+// DeleteProblem deletes a problem with its test cases and code. Problems that
+// already have submissions are kept, so no verdict loses its problem.
+func (r *problemRepository) DeleteProblem(ctx context.Context, problemID int) error {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	var hasSubmissions bool
+	err := r.db.GetContext(ctx, &hasSubmissions,
+		`SELECT EXISTS(SELECT 1 FROM submissions WHERE problem_id = ?)`, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to check problem submissions: %w", err)
+	}
+	if hasSubmissions {
+		return fmt.Errorf("problem has submissions: %d", problemID)
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"test_sets", "test_cases", "starter_code", "system_code", "language_imports", "problem_tags", "problem_programs", "problem_attachments"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE problem_id = ?`, problemID); err != nil {
+			return fmt.Errorf("failed to delete %s of problem: %w", table, err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM problems WHERE id = ?`, problemID); err != nil {
+		return fmt.Errorf("failed to delete problem: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit problem deletion: %w", err)
+	}
+
+	r.invalidateProblemCache(ctx, problemID)
+
+	return nil
+}
+
+// ListTestCases returns the test set authors work on, the draft if there is
+// one and the latest published version otherwise, with its test cases. The
+// test set is nil for a problem without tests.
+func (r *problemRepository) ListTestCases(ctx context.Context, problemID int) (*models.TestSet, []models.TestCase, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, nil, err
+	}
+
+	testSet, err := latestTestSet(ctx, r.db, problemID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if testSet == nil {
+		return nil, []models.TestCase{}, nil
+	}
+
+	testCases, err := testSetCases(ctx, r.db, testSet.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return testSet, testCases, nil
+}
+
+// CreateTestCase adds a test case at the end of the draft
+func (r *problemRepository) CreateTestCase(ctx context.Context, problemID int, req *models.TestCaseRequest) (*models.TestCase, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draftID, err := draftTestSet(ctx, tx, problemID)
+	if err != nil {
+		return nil, err
+	}
+
+	testCase, err := r.insertTestCase(ctx, tx, problemID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `INSERT INTO test_set_cases (test_set_id, test_case_id, position) 
+             SELECT ?, ?, COALESCE(MAX(position), 0) + 1 FROM test_set_cases WHERE test_set_id = ?`
+	if _, err := tx.ExecContext(ctx, query, draftID, testCase.ID, draftID); err != nil {
+		return nil, fmt.Errorf("failed to add test case to draft: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit test case: %w", err)
+	}
+
+	return testCase, nil
+}
+
+// UpdateTestCase changes a test case of the draft and returns its ID. A test
+// case that is also in a published version is copied instead, so the
+// returned ID differs from testCaseID.
+func (r *problemRepository) UpdateTestCase(ctx context.Context, problemID int, testCaseID int, req *models.TestCaseRequest) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draftID, err := draftTestSet(ctx, tx, problemID)
+	if err != nil {
+		return 0, err
+	}
+
+	sets, err := testCaseSets(ctx, tx, draftID, testCaseID)
+	if err != nil {
+		return 0, err
+	}
+
+	if sets == 1 {
+		input, expected, err := r.storeTestFiles(ctx, req)
+		if err != nil {
+			return 0, err
+		}
+
+		query := `UPDATE test_cases SET input = ?, input_blob = ?, input_size = ?, 
+                      expected_output = ?, expected_output_blob = ?, expected_output_size = ?, visible = ? 
+                  WHERE id = ?`
+		_, err = tx.ExecContext(ctx, query, input.inline, input.blob, input.size,
+			expected.inline, expected.blob, expected.size, req.Visible, testCaseID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update test case: %w", err)
+		}
+	} else {
+		testCase, err := r.insertTestCase(ctx, tx, problemID, req)
+		if err != nil {
+			return 0, err
+		}
+
+		query := `UPDATE test_set_cases SET test_case_id = ? WHERE test_set_id = ? AND test_case_id = ?`
+		if _, err := tx.ExecContext(ctx, query, testCase.ID, draftID, testCaseID); err != nil {
+			return 0, fmt.Errorf("failed to replace test case in draft: %w", err)
+		}
+		testCaseID = testCase.ID
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit test case: %w", err)
+	}
+
+	return testCaseID, nil
+}
+
+// DeleteTestCase removes a test case from the draft. Its data is kept while
+// a published version has it.
+func (r *problemRepository) DeleteTestCase(ctx context.Context, problemID int, testCaseID int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draftID, err := draftTestSet(ctx, tx, problemID)
+	if err != nil {
+		return err
+	}
+
+	sets, err := testCaseSets(ctx, tx, draftID, testCaseID)
+	if err != nil {
+		return err
+	}
+
+	query := `DELETE FROM test_set_cases WHERE test_set_id = ? AND test_case_id = ?`
+	if _, err := tx.ExecContext(ctx, query, draftID, testCaseID); err != nil {
+		return fmt.Errorf("failed to remove test case from draft: %w", err)
+	}
+	if sets == 1 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM test_cases WHERE id = ?`, testCaseID); err != nil {
+			return fmt.Errorf("failed to delete test case: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit test case deletion: %w", err)
+	}
+
+	return nil
+}
+
+// ListTestSets returns the versions of a problem's tests, newest first,
+// with the draft ahead of them
+func (r *problemRepository) ListTestSets(ctx context.Context, problemID int) ([]models.TestSet, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	query := testSetSelect + ` WHERE ts.problem_id = ? ORDER BY ts.version IS NULL DESC, ts.version DESC`
+
+	testSets := []models.TestSet{}
+	if err := r.db.SelectContext(ctx, &testSets, query, problemID); err != nil {
+		return nil, fmt.Errorf("failed to get test sets: %w", err)
+	}
+
+	return testSets, nil
+}
+
+// PublishTestSet makes the draft the next version of a problem's tests and
+// returns that version. Workers judge against it from then on.
+func (r *problemRepository) PublishTestSet(ctx context.Context, problemID int) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockProblem(ctx, tx, problemID); err != nil {
+		return 0, err
+	}
+
+	version, err := publishDraft(ctx, tx, problemID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit test set: %w", err)
+	}
+
+	// Drops the cached tests of older versions; workers look the latest one up
+	r.invalidateProblemCache(ctx, problemID)
+
+	return version, nil
+}
+
+// PublishGeneratedTests puts generated tests, stored with StoreTestCase, in
+// the draft, after its current tests if keepExisting is set and instead of
+// them otherwise, and publishes it with the script they were generated with
+func (r *problemRepository) PublishGeneratedTests(ctx context.Context, problemID int, script string,
+	testCases []models.TestCase, keepExisting bool) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	draftID, err := draftTestSet(ctx, tx, problemID)
+	if err != nil {
+		return 0, err
+	}
+
+	if !keepExisting {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM test_set_cases WHERE test_set_id = ?`, draftID); err != nil {
+			return 0, fmt.Errorf("failed to clear draft test set: %w", err)
+		}
+		if err := deleteUnusedTestCases(ctx, tx, problemID); err != nil {
+			return 0, err
+		}
+	}
+
+	var position int
+	err = tx.GetContext(ctx, &position,
+		`SELECT COALESCE(MAX(position), 0) FROM test_set_cases WHERE test_set_id = ?`, draftID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get draft test set size: %w", err)
+	}
+
+	for i := range testCases {
+		if err := insertStoredTestCase(ctx, tx, problemID, &testCases[i]); err != nil {
+			return 0, err
+		}
+		position++
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO test_set_cases (test_set_id, test_case_id, position) VALUES (?, ?, ?)`,
+			draftID, testCases[i].ID, position)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add test case to draft: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `UPDATE test_sets SET generator_script = ? WHERE id = ?`, script, draftID); err != nil {
+		return 0, fmt.Errorf("failed to record generator script: %w", err)
+	}
+
+	version, err := publishDraft(ctx, tx, problemID)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit generated test set: %w", err)
+	}
+
+	// Drops the cached tests of older versions; workers look the latest one up
+	r.invalidateProblemCache(ctx, problemID)
+
+	return version, nil
+}
+
+// DiscardTestSetDraft drops the draft with the test cases only it has
+func (r *problemRepository) DiscardTestSetDraft(ctx context.Context, problemID int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockProblem(ctx, tx, problemID); err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM test_sets WHERE problem_id = ? AND version IS NULL`, problemID)
+	if err != nil {
+		return fmt.Errorf("failed to delete draft test set: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("draft test set not found for problem: %d", problemID)
+	}
+
+	if err := deleteUnusedTestCases(ctx, tx, problemID); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit draft deletion: %w", err)
+	}
+
+	return nil
+}
+
+// ListPrograms returns the generators, reference solution and validator of a problem
+func (r *problemRepository) ListPrograms(ctx context.Context, problemID int) ([]models.ProblemProgram, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT name, kind, language_id, source_code, updated_at 
+              FROM problem_programs WHERE problem_id = ? ORDER BY kind, name`
+
+	programs := []models.ProblemProgram{}
+	if err := r.db.SelectContext(ctx, &programs, query, problemID); err != nil {
+		return nil, fmt.Errorf("failed to get problem programs: %w", err)
+	}
+
+	return programs, nil
+}
+
+// SetProgram creates or replaces a program of a problem. A problem has at
+// most one reference solution and one validator.
+func (r *problemRepository) SetProgram(ctx context.Context, problemID int, name string, req *models.ProblemProgramRequest) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockProblem(ctx, tx, problemID); err != nil {
+		return err
+	}
+
+	if req.Kind != models.ProgramGenerator {
+		var other string
+		err := tx.GetContext(ctx, &other,
+			`SELECT name FROM problem_programs WHERE problem_id = ? AND kind = ? AND name <> ?`,
+			problemID, req.Kind, name)
+		if err == nil {
+			return fmt.Errorf("problem already has a %s: %s", req.Kind, other)
+		}
+		if err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check problem programs: %w", err)
+		}
+	}
+
+	query := `INSERT INTO problem_programs (problem_id, name, kind, language_id, source_code) 
+              VALUES (?, ?, ?, ?, ?) 
+              ON DUPLICATE KEY UPDATE kind = VALUES(kind), language_id = VALUES(language_id), source_code = VALUES(source_code)`
+	if _, err := tx.ExecContext(ctx, query, problemID, name, req.Kind, req.LanguageID, req.SourceCode); err != nil {
+		return fmt.Errorf("failed to store problem program: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit problem program: %w", err)
+	}
+
+	return nil
+}
+
+func (r *problemRepository) DeleteProgram(ctx context.Context, problemID int, name string) error {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM problem_programs WHERE problem_id = ? AND name = ?`, problemID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete problem program: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("program not found: %s", name)
+	}
+
+	return nil
+}
+
+// ListAttachments returns the statement attachments of a problem
+func (r *problemRepository) ListAttachments(ctx context.Context, problemID int) ([]models.ProblemAttachment, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	query := `SELECT name, content_type, blob_key, size, updated_at 
+              FROM problem_attachments WHERE problem_id = ? ORDER BY name`
+
+	attachments := []models.ProblemAttachment{}
+	if err := r.db.SelectContext(ctx, &attachments, query, problemID); err != nil {
+		return nil, fmt.Errorf("failed to get problem attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// GetAttachment returns an attachment of a problem with its content
+func (r *problemRepository) GetAttachment(ctx context.Context, problemID int, name string) (*models.ProblemAttachment, []byte, error) {
+	query := `SELECT name, content_type, blob_key, size, updated_at 
+              FROM problem_attachments WHERE problem_id = ? AND name = ?`
+
+	var attachment models.ProblemAttachment
+	if err := r.db.GetContext(ctx, &attachment, query, problemID, name); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, fmt.Errorf("attachment not found: %s", name)
+		}
+		return nil, nil, fmt.Errorf("failed to get problem attachment: %w", err)
+	}
+
+	data, err := r.blobs.Get(ctx, attachment.BlobKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load attachment %s: %w", name, err)
+	}
+
+	return &attachment, data, nil
+}
+
+// SetAttachment creates or replaces an attachment of a problem. The data
+// must be one of the allowed images.
+func (r *problemRepository) SetAttachment(ctx context.Context, problemID int, name string, data []byte) (*models.ProblemAttachment, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	return r.storeAttachment(ctx, r.db, problemID, models.AttachmentFile{Name: name, Data: data})
+}
+
+func (r *problemRepository) DeleteAttachment(ctx context.Context, problemID int, name string) error {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM problem_attachments WHERE problem_id = ? AND name = ?`, problemID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete problem attachment: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("attachment not found: %s", name)
+	}
+
+	return nil
+}
+
+// storeAttachment puts an attachment in the blob store and records it.
+// Blobs of a rolled back import are left behind, as for test files.
+func (r *problemRepository) storeAttachment(ctx context.Context, exec sqlx.ExecerContext, problemID int, file models.AttachmentFile) (*models.ProblemAttachment, error) {
+	contentType, err := models.AttachmentContentType(file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("attachment %s: %w", file.Name, err)
+	}
+
+	key, err := r.blobs.Put(ctx, file.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	query := `INSERT INTO problem_attachments (problem_id, name, content_type, blob_key, size) 
+              VALUES (?, ?, ?, ?, ?) 
+              ON DUPLICATE KEY UPDATE content_type = VALUES(content_type), blob_key = VALUES(blob_key), size = VALUES(size)`
+	if _, err := exec.ExecContext(ctx, query, problemID, file.Name, contentType, key, len(file.Data)); err != nil {
+		return nil, fmt.Errorf("failed to record attachment: %w", err)
+	}
+
+	return &models.ProblemAttachment{
+		Name:        file.Name,
+		ContentType: contentType,
+		BlobKey:     key,
+		Size:        len(file.Data),
+		UpdatedAt:   time.Now(),
+	}, nil
+}
+
+// publishDraft makes the draft the next version of the problem's tests,
+// within tx, with the problem locked
+func publishDraft(ctx context.Context, tx *sqlx.Tx, problemID int) (int, error) {
+	draft, err := latestTestSet(ctx, tx, problemID, true)
+	if err != nil {
+		return 0, err
+	}
+	if draft == nil || draft.Version != nil {
+		return 0, fmt.Errorf("draft test set not found for problem: %d", problemID)
+	}
+	if draft.TestCount == 0 {
+		return 0, fmt.Errorf("draft test set has no test cases")
+	}
+
+	var version int
+	err = tx.GetContext(ctx, &version,
+		`SELECT COALESCE(MAX(version), 0) + 1 FROM test_sets WHERE problem_id = ?`, problemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get next test set version: %w", err)
+	}
+
+	query := `UPDATE test_sets SET version = ?, published_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, query, version, time.Now(), draft.ID); err != nil {
+		return 0, fmt.Errorf("failed to publish test set: %w", err)
+	}
+
+	return version, nil
+}
+
+// deleteUnusedTestCases deletes the test cases of a problem no test set has
+func deleteUnusedTestCases(ctx context.Context, tx *sqlx.Tx, problemID int) error {
+	query := `DELETE tc FROM test_cases tc
+              LEFT JOIN test_set_cases tsc ON tsc.test_case_id = tc.id
+              WHERE tc.problem_id = ? AND tsc.test_case_id IS NULL`
+	if _, err := tx.ExecContext(ctx, query, problemID); err != nil {
+		return fmt.Errorf("failed to delete unused test cases: %w", err)
+	}
+	return nil
+}
+
+const testSetSelect = `SELECT ts.id, ts.problem_id, ts.version, ts.created_at, ts.published_at, ts.generator_script,
+                  (SELECT COUNT(*) FROM test_set_cases tsc WHERE tsc.test_set_id = ts.id) AS test_count
+              FROM test_sets ts`
+
+// latestTestSet returns the latest published version of a problem's tests,
+// or the draft ahead of it if withDraft is set. It is nil if there is none.
+func latestTestSet(ctx context.Context, q sqlx.QueryerContext, problemID int, withDraft bool) (*models.TestSet, error) {
+	query := testSetSelect + ` WHERE ts.problem_id = ?`
+	if !withDraft {
+		query += ` AND ts.version IS NOT NULL`
+	}
+	query += ` ORDER BY ts.version IS NULL DESC, ts.version DESC LIMIT 1`
+
+	var testSet models.TestSet
+	if err := sqlx.GetContext(ctx, q, &testSet, query, problemID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get test set: %w", err)
+	}
+	return &testSet, nil
+}
+
+// testSetCases returns the test cases of a test set in order. The content
+// of files kept in the blob store is left empty.
+func testSetCases(ctx context.Context, q sqlx.QueryerContext, testSetID int) ([]models.TestCase, error) {
+	query := `SELECT tc.id, tc.problem_id, COALESCE(tc.input, '') AS input, tc.input_blob, tc.input_size, 
+                  COALESCE(tc.expected_output, '') AS expected_output, tc.expected_output_blob, tc.expected_output_size, 
+                  tc.visible 
+              FROM test_set_cases tsc
+              JOIN test_cases tc ON tc.id = tsc.test_case_id
+              WHERE tsc.test_set_id = ?
+              ORDER BY tsc.position`
+
+	testCases := []models.TestCase{}
+	if err := sqlx.SelectContext(ctx, q, &testCases, query, testSetID); err != nil {
+		return nil, fmt.Errorf("failed to get test cases: %w", err)
+	}
+	return testCases, nil
+}
+
+// testFile is one file of a test case as stored: inline, or the key of
+// its blob
+type testFile struct {
+	inline *string
+	blob   *string
+	size   int
+}
+
+// storeTestFiles puts the files of a test case larger than the inline limit
+// in the blob store. Blobs of a rolled back change are left behind, which
+// is harmless as they are keyed by content.
+func (r *problemRepository) storeTestFiles(ctx context.Context, req *models.TestCaseRequest) (testFile, testFile, error) {
+	var files [2]testFile
+	for i, data := range []string{req.Input, req.ExpectedOutput} {
+		files[i].size = len(data)
+		if len(data) <= r.inlineLimit {
+			files[i].inline = &data
+			continue
+		}
+
+		key, err := r.blobs.Put(ctx, []byte(data))
+		if err != nil {
+			return testFile{}, testFile{}, fmt.Errorf("failed to store test file: %w", err)
+		}
+		files[i].blob = &key
+	}
+	return files[0], files[1], nil
+}
+
+// StoreTestCase stores the files of a test case ahead of adding it to a
+// test set, large ones in the blob store. Only small files stay in the
+// returned test case, so tests can be stored one at a time as they are
+// generated without keeping them all in memory.
+func (r *problemRepository) StoreTestCase(ctx context.Context, req *models.TestCaseRequest) (*models.TestCase, error) {
+	input, expected, err := r.storeTestFiles(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	testCase := &models.TestCase{
+		InputBlob:          input.blob,
+		InputSize:          input.size,
+		ExpectedOutputBlob: expected.blob,
+		ExpectedOutputSize: expected.size,
+		Visible:            req.Visible,
+	}
+	if input.inline != nil {
+		testCase.Input = *input.inline
+	}
+	if expected.inline != nil {
+		testCase.ExpectedOutput = *expected.inline
+	}
+	return testCase, nil
+}
+
+func (r *problemRepository) insertTestCase(ctx context.Context, tx *sqlx.Tx, problemID int, req *models.TestCaseRequest) (*models.TestCase, error) {
+	testCase, err := r.StoreTestCase(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertStoredTestCase(ctx, tx, problemID, testCase); err != nil {
+		return nil, err
+	}
+	return testCase, nil
+}
+
+// insertStoredTestCase adds a test case whose files are stored, setting its ID
+func insertStoredTestCase(ctx context.Context, tx *sqlx.Tx, problemID int, testCase *models.TestCase) error {
+	var input, expected *string
+	if testCase.InputBlob == nil {
+		input = &testCase.Input
+	}
+	if testCase.ExpectedOutputBlob == nil {
+		expected = &testCase.ExpectedOutput
+	}
+
+	query := `INSERT INTO test_cases (problem_id, input, input_blob, input_size, 
+                  expected_output, expected_output_blob, expected_output_size, visible) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.ExecContext(ctx, query, problemID, input, testCase.InputBlob, testCase.InputSize,
+		expected, testCase.ExpectedOutputBlob, testCase.ExpectedOutputSize, testCase.Visible)
+	if err != nil {
+		return fmt.Errorf("failed to create test case: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	testCase.ID = int(id)
+	testCase.ProblemID = problemID
+	return nil
+}
+
+// loadTestFiles fills in the files of a test case kept in the blob store
+func (r *problemRepository) loadTestFiles(ctx context.Context, testCase *models.TestCase) error {
+	files := []struct {
+		key    *string
+		target *string
+	}{
+		{testCase.InputBlob, &testCase.Input},
+		{testCase.ExpectedOutputBlob, &testCase.ExpectedOutput},
+	}
+	for _, file := range files {
+		if file.key == nil {
+			continue
+		}
+		data, err := r.blobs.Get(ctx, *file.key)
+		if err != nil {
+			return fmt.Errorf("failed to load test case %d: %w", testCase.ID, err)
+		}
+		*file.target = string(data)
+	}
+	return nil
+}
+
+// lockProblem locks the problem row until tx ends, serializing test set
+// changes of the problem
+func lockProblem(ctx context.Context, tx *sqlx.Tx, problemID int) error {
+	var id int
+	err := tx.GetContext(ctx, &id, `SELECT id FROM problems WHERE id = ? FOR UPDATE`, problemID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("problem not found: %d", problemID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock problem: %w", err)
+	}
+	return nil
+}
+
+// draftTestSet returns the ID of the problem's draft, creating it from the
+// latest published version when there is none
+func draftTestSet(ctx context.Context, tx *sqlx.Tx, problemID int) (int, error) {
+	if err := lockProblem(ctx, tx, problemID); err != nil {
+		return 0, err
+	}
+
+	latest, err := latestTestSet(ctx, tx, problemID, true)
+	if err != nil {
+		return 0, err
+	}
+	if latest != nil && latest.Version == nil {
+		return latest.ID, nil
+	}
+
+	result, err := tx.ExecContext(ctx, `INSERT INTO test_sets (problem_id) VALUES (?)`, problemID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create draft test set: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	if latest != nil {
+		query := `INSERT INTO test_set_cases (test_set_id, test_case_id, position) 
+                  SELECT ?, test_case_id, position FROM test_set_cases WHERE test_set_id = ?`
+		if _, err := tx.ExecContext(ctx, query, id, latest.ID); err != nil {
+			return 0, fmt.Errorf("failed to copy test set: %w", err)
+		}
+	}
+
+	return int(id), nil
+}
+
+// testCaseSets returns how many test sets have a test case of the draft
+func testCaseSets(ctx context.Context, tx *sqlx.Tx, draftID int, testCaseID int) (int, error) {
+	var inDraft bool
+	query := `SELECT EXISTS(SELECT 1 FROM test_set_cases WHERE test_set_id = ? AND test_case_id = ?)`
+	if err := tx.GetContext(ctx, &inDraft, query, draftID, testCaseID); err != nil {
+		return 0, fmt.Errorf("failed to check test case: %w", err)
+	}
+	if !inDraft {
+		return 0, fmt.Errorf("test case not found: %d", testCaseID)
+	}
+
+	var sets int
+	query = `SELECT COUNT(*) FROM test_set_cases WHERE test_case_id = ?`
+	if err := tx.GetContext(ctx, &sets, query, testCaseID); err != nil {
+		return 0, fmt.Errorf("failed to count test case sets: %w", err)
+	}
+	return sets, nil
+}
+
+// GetProblemCode returns the starter code, system code and imports of a
+// problem for one language, each nil when not set.
+func (r *problemRepository) GetProblemCode(ctx context.Context, problemID int, languageID int) (*models.ProblemLanguageCode, error) {
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return nil, err
+	}
+
+	code := &models.ProblemLanguageCode{LanguageID: languageID}
+	targets := map[string]**string{
+		models.ProblemCodeStarter: &code.StarterCode,
+		models.ProblemCodeSystem:  &code.SystemCode,
+		models.ProblemCodeImports: &code.Imports,
+	}
+
+	for kind, target := range targets {
+		query := `SELECT code FROM ` + problemCodeTables[kind] + ` WHERE problem_id = ? AND language_id = ?`
+
+		var value string
+		err := r.db.GetContext(ctx, &value, query, problemID, languageID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", kind, err)
+		}
+		*target = &value
+	}
+
+	return code, nil
+}
+
+// SetProblemCode replaces the code of one kind of a problem for one language
+func (r *problemRepository) SetProblemCode(ctx context.Context, problemID int, languageID int, kind string, code string) error {
+	table, ok := problemCodeTables[kind]
+	if !ok {
+		return fmt.Errorf("unknown problem code kind: %s", kind)
+	}
+	if err := r.ensureProblemExists(ctx, problemID); err != nil {
+		return err
+	}
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE problem_id = ? AND language_id = ?`, problemID, languageID); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", kind, err)
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (problem_id, language_id, code) VALUES (?, ?, ?)`, problemID, languageID, code); err != nil {
+		return fmt.Errorf("failed to store %s: %w", kind, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit %s: %w", kind, err)
+	}
+
+	r.invalidateProblemCache(ctx, problemID)
+
+	return nil
+}
+
+func (r *problemRepository) DeleteProblemCode(ctx context.Context, problemID int, languageID int, kind string) error {
+	table, ok := problemCodeTables[kind]
+	if !ok {
+		return fmt.Errorf("unknown problem code kind: %s", kind)
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE problem_id = ? AND language_id = ?`, problemID, languageID)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %w", kind, err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%s not found for problem %d and language %d", kind, problemID, languageID)
+	}
+
+	r.invalidateProblemCache(ctx, problemID)
+
+	return nil
+}
+
+// ExportProblem reads a problem with its tests, code and attachments as a package,
+// straight from the database
+func (r *problemRepository) ExportProblem(ctx context.Context, problemID int) (*models.ProblemPackage, error) {
+	var problem struct {
+		models.ProblemDetail
+		Checker string `db:"checker"`
+	}
+	query := `SELECT id, title, description, difficulty, sample_input, sample_output, time_limit_ms, memory_limit_mb, checker 
+              FROM problems WHERE id = ?`
+	if err := r.db.GetContext(ctx, &problem, query, problemID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("problem not found: %d", problemID)
+		}
+		return nil, fmt.Errorf("failed to get problem: %w", err)
+	}
+
+	pkg := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title:         problem.Title,
+			Description:   problem.Description,
+			Difficulty:    problem.Difficulty,
+			SampleInput:   problem.SampleInput,
+			SampleOutput:  problem.SampleOutput,
+			TimeLimitMs:   problem.TimeLimitMs,
+			MemoryLimitMB: problem.MemoryLimitMB,
+			Checker:       problem.Checker,
+		},
+	}
+
+	tags, err := r.getTags(ctx, []int{problemID})
+	if err != nil {
+		return nil, err
+	}
+	pkg.Tags = tags[problemID]
+
+	// The published tests are what submissions are judged against; a
+	// problem that has none yet exports its draft
+	testSet, err := latestTestSet(ctx, r.db, problemID, false)
+	if err != nil {
+		return nil, err
+	}
+	if testSet == nil {
+		testSet, err = latestTestSet(ctx, r.db, problemID, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var testCases []models.TestCase
+	if testSet != nil {
+		testCases, err = testSetCases(ctx, r.db, testSet.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, tc := range testCases {
+		if err := r.loadTestFiles(ctx, &tc); err != nil {
+			return nil, err
+		}
+		pkg.TestCases = append(pkg.TestCases, models.TestCaseRequest{
+			Input:          tc.Input,
+			ExpectedOutput: tc.ExpectedOutput,
+			Visible:        tc.Visible,
+		})
+	}
+
+	type codeRow struct {
+		LanguageID int    `db:"language_id"`
+		Code       string `db:"code"`
+	}
+
+	code := make(map[int]*models.ProblemLanguageCode)
+	for _, kind := range []string{models.ProblemCodeStarter, models.ProblemCodeSystem, models.ProblemCodeImports} {
+		var rows []codeRow
+		query := `SELECT language_id, code FROM ` + problemCodeTables[kind] + ` WHERE problem_id = ? ORDER BY language_id`
+		if err := r.db.SelectContext(ctx, &rows, query, problemID); err != nil {
+			return nil, fmt.Errorf("failed to get %s: %w", kind, err)
+		}
+
+		for _, row := range rows {
+			if code[row.LanguageID] == nil {
+				code[row.LanguageID] = &models.ProblemLanguageCode{LanguageID: row.LanguageID}
+			}
+			value := row.Code
+			switch kind {
+			case models.ProblemCodeStarter:
+				code[row.LanguageID].StarterCode = &value
+			case models.ProblemCodeSystem:
+				code[row.LanguageID].SystemCode = &value
+			case models.ProblemCodeImports:
+				code[row.LanguageID].Imports = &value
+			}
+		}
+	}
+	for _, languageCode := range code {
+		pkg.Code = append(pkg.Code, *languageCode)
+	}
+	// Map order is random, and exports of the same problem should match
+	sort.Slice(pkg.Code, func(i, j int) bool { return pkg.Code[i].LanguageID < pkg.Code[j].LanguageID })
+
+	var attachments []models.ProblemAttachment
+	query = `SELECT name, content_type, blob_key, size, updated_at 
+             FROM problem_attachments WHERE problem_id = ? ORDER BY name`
+	if err := r.db.SelectContext(ctx, &attachments, query, problemID); err != nil {
+		return nil, fmt.Errorf("failed to get problem attachments: %w", err)
+	}
+	for _, attachment := range attachments {
+		data, err := r.blobs.Get(ctx, attachment.BlobKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load attachment %s: %w", attachment.Name, err)
+		}
+		pkg.Attachments = append(pkg.Attachments, models.AttachmentFile{Name: attachment.Name, Data: data})
+	}
+
+	return pkg, nil
+}
+
+// ImportProblem creates a new problem from a package in one transaction, so
+// a failed import leaves nothing behind
+func (r *problemRepository) ImportProblem(ctx context.Context, pkg *models.ProblemPackage) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	problem := pkg.Problem
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO problems (title, description, difficulty, sample_input, sample_output, time_limit_ms, memory_limit_mb, checker) 
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		problem.Title, problem.Description, problem.Difficulty, problem.SampleInput, problem.SampleOutput,
+		problem.TimeLimitMs, problem.MemoryLimitMB, problem.Checker)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create problem: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	problemID := int(id)
+
+	// The tests of the package are published right away as version 1
+	result, err = tx.ExecContext(ctx,
+		`INSERT INTO test_sets (problem_id, version, published_at) VALUES (?, 1, ?)`, problemID, time.Now())
+	if err != nil {
+		return 0, fmt.Errorf("failed to create test set: %w", err)
+	}
+	testSetID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+
+	for i := range pkg.TestCases {
+		testCase, err := r.insertTestCase(ctx, tx, problemID, &pkg.TestCases[i])
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO test_set_cases (test_set_id, test_case_id, position) VALUES (?, ?, ?)`,
+			testSetID, testCase.ID, i+1)
+		if err != nil {
+			return 0, fmt.Errorf("failed to add test case to test set: %w", err)
+		}
+	}
+
+	if err := replaceProblemTags(ctx, tx, problemID, pkg.Tags); err != nil {
+		return 0, err
+	}
+
+	for _, languageCode := range pkg.Code {
+		values := map[string]*string{
+			models.ProblemCodeStarter: languageCode.StarterCode,
+			models.ProblemCodeSystem:  languageCode.SystemCode,
+			models.ProblemCodeImports: languageCode.Imports,
+		}
+		for kind, value := range values {
+			if value == nil {
+				continue
+			}
+			query := `INSERT INTO ` + problemCodeTables[kind] + ` (problem_id, language_id, code) VALUES (?, ?, ?)`
+			if _, err := tx.ExecContext(ctx, query, problemID, languageCode.LanguageID, *value); err != nil {
+				return 0, fmt.Errorf("failed to store %s: %w", kind, err)
+			}
+		}
+	}
+
+	for _, file := range pkg.Attachments {
+		if _, err := r.storeAttachment(ctx, tx, problemID, file); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit problem import: %w", err)
+	}
+
+	r.invalidateProblemCache(ctx, problemID)
+
+	return problemID, nil
+}
+
+func (r *problemRepository) ensureProblemExists(ctx context.Context, problemID int) error {
+	var exists bool
+	if err := r.db.GetContext(ctx, &exists, `SELECT EXISTS(SELECT 1 FROM problems WHERE id = ?)`, problemID); err != nil {
+		return fmt.Errorf("failed to check problem: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("problem not found: %d", problemID)
+	}
+	return nil
+}
+
+// invalidateProblemCache drops every cached entry derived from a problem:
+// the problem lists, its details and its test cases and per-language code.
+func (r *problemRepository) invalidateProblemCache(ctx context.Context, problemID int) {
+	if _, err := r.cache.Incr(ctx, problemListVersionKey); err != nil {
+		logger.Log.Warn("Failed to invalidate problem lists", zap.Error(err))
+	}
+
+	keys := []string{fmt.Sprintf("problem:%d", problemID)}
+	for _, key := range keys {
+		if err := r.cache.Delete(ctx, key); err != nil {
+			logger.Log.Warn("Failed to invalidate problem cache",
+				zap.String("key", key),
+				zap.Error(err))
+		}
+	}
+
+	pattern := fmt.Sprintf("problem:%d:*", problemID)
+	if err := r.cache.DeleteMatching(ctx, pattern); err != nil {
+		logger.Log.Warn("Failed to invalidate problem cache",
+			zap.String("pattern", pattern),
+			zap.Error(err))
+	}
+}
@@ -0,0 +1,194 @@
+package repositories
+
+import (
+	"HAB/internal/models"
+	"HAB/internal/services"
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type RejudgeRepository interface {
+	CreateRejudge(ctx context.Context, rejudge *models.Rejudge) error
+	RecordRejudgeResult(ctx context.Context, rejudgeID int, submissionID int, judgementID int, status string) error
+	GetRejudgeReport(ctx context.Context, rejudgeID int) (*models.RejudgeReport, error)
+}
+
+type rejudgeRepository struct {
+	db *sqlx.DB
+}
+
+func NewRejudgeRepository(db *sqlx.DB) RejudgeRepository {
+	return &rejudgeRepository{db: db}
+}
+
+// CreateRejudge selects the finished submissions matching the rejudge scope,
+// records their current judgement, resets them to PENDING and queues them on
+// the rejudge lane through the outbox, all in one transaction.
+func (r *rejudgeRepository) CreateRejudge(ctx context.Context, rejudge *models.Rejudge) error {
+	var condition string
+	var args []interface{}
+
+	switch rejudge.Scope {
+	case models.RejudgeScopeSubmission:
+		condition = `id = ?`
+		args = append(args, *rejudge.SubmissionID)
+	case models.RejudgeScopeProblem:
+		condition = `problem_id = ?`
+		args = append(args, *rejudge.ProblemID)
+	case models.RejudgeScopeTimeRange:
+		condition = `submitted_at BETWEEN ? AND ?`
+		args = append(args, *rejudge.FromTime, *rejudge.ToTime)
+		if rejudge.ProblemID != nil {
+			condition += ` AND problem_id = ?`
+			args = append(args, *rejudge.ProblemID)
+		}
+	default:
+		return fmt.Errorf("unknown rejudge scope: %s", rejudge.Scope)
+	}
+
+	// Submissions still in the queue or cancelled by their owner are left alone
+	query := `SELECT id AS submission_id, user_id, status AS previous_status,
+                  current_judgement_id AS previous_judgement_id
+              FROM submissions
+              WHERE ` + condition + ` AND status NOT IN (?, ?, ?)
+              ORDER BY id
+              FOR UPDATE`
+	args = append(args, models.StatusPending, models.StatusProcessing, models.StatusCancelled)
+
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var items []models.RejudgeItem
+	if err := tx.SelectContext(ctx, &items, query, args...); err != nil {
+		return fmt.Errorf("failed to get submissions to rejudge: %w", err)
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no finished submissions found to rejudge")
+	}
+
+	result, err := tx.ExecContext(ctx,
+		`INSERT INTO rejudges (requested_by, scope, submission_id, problem_id, from_time, to_time, total)
+         VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		rejudge.RequestedBy, rejudge.Scope, rejudge.SubmissionID, rejudge.ProblemID,
+		rejudge.FromTime, rejudge.ToTime, len(items),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create rejudge: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert ID: %w", err)
+	}
+	rejudge.ID = int(id)
+	rejudge.Total = len(items)
+
+	for _, item := range items {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO rejudge_items (rejudge_id, submission_id, previous_status, previous_judgement_id)
+             VALUES (?, ?, ?, ?)`,
+			rejudge.ID, item.SubmissionID, item.PreviousStatus, item.PreviousJudgementID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to record previous verdict of submission %d: %w", item.SubmissionID, err)
+		}
+	}
+
+	// Accepted submissions stop counting as such until judged again
+	_, err = tx.ExecContext(ctx,
+		`UPDATE problems p
+         JOIN (SELECT s.problem_id, COUNT(*) AS accepted
+               FROM rejudge_items ri
+               JOIN submissions s ON s.id = ri.submission_id
+               WHERE ri.rejudge_id = ? AND ri.previous_status = ?
+               GROUP BY s.problem_id) rejudged ON rejudged.problem_id = p.id
+         SET p.accepted_submissions = p.accepted_submissions - rejudged.accepted`,
+		rejudge.ID, models.StatusAccepted,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update accepted submission counts: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE submissions
+         SET status = ?, current_judgement_id = NULL, queue_lane = ?, rejudge_id = ?, queued_at = NOW(3)
+         WHERE id IN (SELECT submission_id FROM rejudge_items WHERE rejudge_id = ?)`,
+		models.StatusPending, string(services.LaneRejudge), rejudge.ID, rejudge.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to reset rejudged submissions: %w", err)
+	}
+
+	for _, item := range items {
+		if err := insertOutboxEntry(ctx, tx, item.SubmissionID, item.UserID, services.LaneRejudge, &rejudge.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit rejudge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rejudgeRepository) RecordRejudgeResult(ctx context.Context, rejudgeID int, submissionID int, judgementID int, status string) error {
+	query := `UPDATE rejudge_items SET new_status = ?, new_judgement_id = ?, judged_at = NOW()
+              WHERE rejudge_id = ? AND submission_id = ?`
+
+	if _, err := r.db.ExecContext(ctx, query, status, judgementID, rejudgeID, submissionID); err != nil {
+		return fmt.Errorf("failed to record rejudge result: %w", err)
+	}
+
+	return nil
+}
+
+func (r *rejudgeRepository) GetRejudgeReport(ctx context.Context, rejudgeID int) (*models.RejudgeReport, error) {
+	var report models.RejudgeReport
+
+	query := `SELECT id, requested_by, scope, submission_id, problem_id, from_time, to_time, total, created_at
+              FROM rejudges WHERE id = ?`
+	if err := r.db.GetContext(ctx, &report.Rejudge, query, rejudgeID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("rejudge not found: %d", rejudgeID)
+		}
+		return nil, fmt.Errorf("failed to get rejudge: %w", err)
+	}
+
+	countsQuery := `
+        SELECT
+            COUNT(new_status) AS judged,
+            COUNT(CASE WHEN new_status IS NULL THEN 1 END) AS pending,
+            COUNT(CASE WHEN new_status <> previous_status THEN 1 END) AS changed
+        FROM rejudge_items
+        WHERE rejudge_id = ?`
+
+	var counts struct {
+		Judged  int `db:"judged"`
+		Pending int `db:"pending"`
+		Changed int `db:"changed"`
+	}
+	if err := r.db.GetContext(ctx, &counts, countsQuery, rejudgeID); err != nil {
+		return nil, fmt.Errorf("failed to count rejudge results: %w", err)
+	}
+	report.Judged = counts.Judged
+	report.Pending = counts.Pending
+	report.Changed = counts.Changed
+
+	changesQuery := `SELECT submission_id, previous_status, previous_judgement_id, new_status, new_judgement_id, judged_at
+                     FROM rejudge_items
+                     WHERE rejudge_id = ? AND new_status <> previous_status
+                     ORDER BY submission_id`
+	report.Changes = []models.RejudgeItem{}
+	if err := r.db.SelectContext(ctx, &report.Changes, changesQuery, rejudgeID); err != nil {
+		return nil, fmt.Errorf("failed to get changed verdicts: %w", err)
+	}
+
+	return &report, nil
+}
@@ -19,6 +19,8 @@ type UserRepository interface {
 	GetRefreshToken(ctx context.Context, token string) (int, error)
 	RevokeToken(ctx context.Context, token string) error
 	GetUserInfo(ctx context.Context, userID int) (*models.UserInfo, error)
+	GetUserByID(ctx context.Context, userID int) (*models.User, error)
+	SetUserRole(ctx context.Context, userID int, role string) error
 }
 
 type userRepository struct {
@@ -57,7 +59,7 @@ func (r *userRepository) CreateUser(ctx context.Context, req *models.RegisterReq
 
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, email, password_hash, created_at FROM users WHERE email = ?`
+	query := `SELECT id, username, email, password_hash, role, created_at FROM users WHERE email = ?`
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -68,6 +70,31 @@ func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 	return &user, nil
 }
 
+func (r *userRepository) GetUserByID(ctx context.Context, userID int) (*models.User, error) {
+	var user models.User
+	query := `SELECT id, username, email, password_hash, role, created_at FROM users WHERE id = ?`
+	err := r.db.GetContext(ctx, &user, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found: %d", userID)
+		}
+		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) SetUserRole(ctx context.Context, userID int, role string) error {
+	if _, err := r.GetUserByID(ctx, userID); err != nil {
+		return err
+	}
+
+	query := `UPDATE users SET role = ? WHERE id = ?`
+	if _, err := r.db.ExecContext(ctx, query, role, userID); err != nil {
+		return fmt.Errorf("failed to set user role: %w", err)
+	}
+	return nil
+}
+
 func (r *userRepository) StoreRefreshToken(ctx context.Context, userID int, token string, expiresAt time.Time) error {
 	key := fmt.Sprintf("refresh_token:%s", token)
 	ttl := time.Until(expiresAt)
@@ -105,7 +132,7 @@ func (r *userRepository) RevokeToken(ctx context.Context, token string) error {
 
 func (r *userRepository) GetUserInfo(ctx context.Context, userID int) (*models.UserInfo, error) {
 	var userInfo models.UserInfo
-	userQuery := `SELECT username, email, created_at FROM users WHERE id = ?`
+	userQuery := `SELECT username, email, role, created_at FROM users WHERE id = ?`
 	err := r.db.GetContext(ctx, &userInfo, userQuery, userID)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -114,15 +141,5 @@ func (r *userRepository) GetUserInfo(ctx context.Context, userID int) (*models.U
 		return nil, fmt.Errorf("failed to get user info: %w", err)
 	}
 
-	submissionsQuery := `
-        SELECT id, language_id, status, submitted_at 
-        FROM submissions 
-        WHERE user_id = ? 
-        ORDER BY submitted_at DESC`
-	err = r.db.SelectContext(ctx, &userInfo.Submissions, submissionsQuery, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get user submissions: %w", err)
-	}
-
 	return &userInfo, nil
 }
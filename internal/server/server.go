@@ -6,19 +6,29 @@ import (
 	"HAB/internal/handlers"
 	"HAB/internal/logger"
 	"HAB/internal/middlewares"
+	"HAB/internal/models"
 	"HAB/internal/repositories"
 	"HAB/internal/services"
 	"HAB/internal/workerpool"
 
 	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 )
 
+// shutdownTimeout is how long requests in flight get to finish on shutdown;
+// streams of live events are cut at the end of it
+const shutdownTimeout = 10 * time.Second
+
 func StartGinServer() {
 	logger.InitLogger()
 	defer logger.SyncLogger()
@@ -37,15 +47,45 @@ func StartGinServer() {
 	}
 	defer dbs.CloseRedis()
 
+	if err := services.ConfigureLanguages(config.EnabledLanguages, config.MaxSourceSize, config.MaxSourceSizeByLanguage); err != nil {
+		log.Fatalf("Invalid language configuration: %v", err)
+	}
+
 	cache := services.NewRedisCache(dbs.RedisClient)
 
+	blobStore, err := dbs.InitBlobStore(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+	blobCache, err := services.NewDiskBlobCache(blobStore, config.BlobCacheDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize blob cache: %v", err)
+	}
+
 	codeRepo := repositories.NewCodeRepository(db, cache)
-	problemRepo := repositories.NewProblemRepository(db, cache)
+	problemRepo := repositories.NewProblemRepository(db, cache, blobStore, config.BlobInlineLimit)
 	userRepo := repositories.NewUserRepository(db, cache)
+	rejudgeRepo := repositories.NewRejudgeRepository(db)
+	outboxRepo := repositories.NewOutboxRepository(db)
+
+	// Users listed in ADMIN_USER_IDS are made admins, so a fresh
+	// deployment has someone able to hand out roles
+	for _, adminID := range config.AdminUserIDs {
+		if err := userRepo.SetUserRole(ctx, adminID, models.RoleAdmin); err != nil {
+			logger.Log.Warn("Failed to promote configured admin",
+				zap.Int("user_id", adminID),
+				zap.Error(err))
+		}
+	}
 
 	tokenService := services.NewTokenService(config.JWTSecret)
 
-	workerPool, err := workerpool.NewCodeWorkerPool(config.NumberOfWorkers, dbs.RedisClient, "code_submissions", "judgers", codeRepo)
+	submissionQueue := services.NewSubmissionQueue(dbs.RedisClient, "code_submissions", "judgers")
+	submissionEvents := services.NewSubmissionEvents(dbs.RedisClient)
+
+	workerPool, err := workerpool.NewCodeWorkerPool(
+		config.NumberOfWorkers, config.MaxInFlightPerUser, config.SchedulerBufferSize,
+		dbs.RedisClient, submissionQueue, codeRepo, rejudgeRepo, submissionEvents, blobCache)
 	if err != nil {
 		logger.Log.Error("Failed initializing worker pool")
 		log.Fatalf("failed to initialize worker pool: %v", err)
@@ -57,15 +97,57 @@ func StartGinServer() {
 	}
 	defer workerPool.Stop()
 
-	submissionHandler := handlers.NewSubmissionHandler(codeRepo, dbs.RedisClient)
-	problemHandler := handlers.NewProblemHandler(problemRepo)
-	authHandler := handlers.NewAuthHandler(userRepo, tokenService)
+	outboxRelay := workerpool.NewOutboxRelay(outboxRepo, submissionQueue)
+	outboxRelay.Start(ctx)
+	defer outboxRelay.Stop()
+
+	sweeper := workerpool.NewStuckSubmissionSweeper(codeRepo, submissionQueue, submissionEvents,
+		time.Duration(config.StuckSubmissionTimeout)*time.Second, config.MaxSubmissionRequeues)
+	sweeper.Start(ctx)
+	defer sweeper.Stop()
+
+	// Test generation runs on the workers, in the same sandbox as judging
+	testGenerations := services.NewTestGenerationJobs(dbs.RedisClient)
+	generationWorker, err := workerpool.NewTestGenerationWorker(problemRepo, testGenerations, blobCache)
+	if err != nil {
+		log.Fatalf("failed to initialize test generation worker: %v", err)
+	}
+	if err := generationWorker.Start(ctx); err != nil {
+		log.Fatalf("failed to start test generation worker: %v", err)
+	}
+	defer generationWorker.Stop()
+
+	userEventHub := services.NewUserEventHub(dbs.RedisClient)
+	if err := userEventHub.Start(ctx); err != nil {
+		log.Fatalf("Failed to subscribe to live user events: %v", err)
+	}
+
+	submissionHandler := handlers.NewSubmissionHandler(codeRepo, submissionQueue, submissionEvents, userEventHub,
+		config.NumberOfWorkers, config.MaxQueueBacklog)
+	problemHandler := handlers.NewProblemHandler(problemRepo, testGenerations)
+	authHandler := handlers.NewAuthHandler(userRepo, codeRepo, tokenService)
+	rejudgeHandler := handlers.NewRejudgeHandler(rejudgeRepo)
+	statusHandler := handlers.NewStatusHandler(codeRepo, problemRepo)
+
+	allowedOrigins := []string{"http://localhost:3000"}
+	liveHandler := handlers.NewLiveHandler(submissionEvents, userEventHub, allowedOrigins)
 
 	router := gin.New()
+	// Per-IP rate limits key on the client IP, so only trust X-Forwarded-For
+	// from the configured proxies; with none, the peer address is used.
+	if err := router.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	router.Use(middlewares.ErrorHandlerMiddleware())
+	router.Use(middlewares.BodySizeLimitMiddleware(int64(config.MaxRequestBodySize), map[string]int64{
+		"/admin/problems/import":                    int64(config.MaxPackageSize),
+		"/admin/problems/:id/attachments/:name":     int64(config.MaxAttachmentSize),
+		"/admin/problems/:id/testcases":             int64(config.MaxTestCaseSize),
+		"/admin/problems/:id/testcases/:testCaseId": int64(config.MaxTestCaseSize),
+	}))
 
 	router.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
+		AllowOrigins:     allowedOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
 		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
 		AllowCredentials: true,
@@ -74,10 +156,22 @@ func StartGinServer() {
 
 	authMiddleware := middlewares.AuthMiddleware(tokenService)
 	optionalAuthMiddleware := middlewares.OptionalAuthMiddleware(tokenService)
+	adminMiddleware := middlewares.RequireRole(models.RoleAdmin)
+	authorMiddleware := middlewares.RequireRole(models.RoleAdmin, models.RoleProblemSetter)
+
+	submissionLimiter := services.NewRateLimiter(dbs.RedisClient, "submissions", config.SubmissionRatePerMinute, config.SubmissionBurst)
+	authLimiter := services.NewRateLimiter(dbs.RedisClient, "auth", config.AuthRatePerMinute, config.AuthBurst)
+	submitRateLimit := middlewares.UserRateLimitMiddleware(submissionLimiter)
+	authRateLimit := middlewares.IPRateLimitMiddleware(authLimiter)
 
-	submissionHandler.RegisterRoutes(router, authMiddleware)
+	submissionHandler.RegisterRoutes(router, authMiddleware, submitRateLimit)
 	problemHandler.RegisterRoutes(router, optionalAuthMiddleware)
-	authHandler.RegisterRoutes(router)
+	problemHandler.RegisterAdminRoutes(router, authMiddleware, authorMiddleware)
+	statusHandler.RegisterRoutes(router, optionalAuthMiddleware)
+	authHandler.RegisterRoutes(router, authRateLimit)
+	authHandler.RegisterAdminRoutes(router, authMiddleware, adminMiddleware)
+	rejudgeHandler.RegisterRoutes(router, authMiddleware, adminMiddleware)
+	liveHandler.RegisterRoutes(router, authMiddleware)
 
 	// should not be here, but i'm too lazy to organize
 	profileGroup := router.Group("/profile")
@@ -91,8 +185,24 @@ func StartGinServer() {
 	})
 
 	port := ":" + config.ServerPort
-	log.Printf("Starting server on port %s", port)
-	if err := router.Run(port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	httpServer := &http.Server{Addr: port, Handler: router}
+	go func() {
+		log.Printf("Starting server on port %s", port)
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// On SIGINT or SIGTERM, stop taking requests and return, so the workers
+	// are stopped by the deferred calls above rather than killed mid-job
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	<-stop.Done()
+
+	log.Printf("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		logger.Log.Warn("Server did not shut down cleanly", zap.Error(err))
 	}
 }
@@ -0,0 +1,226 @@
+package services
+
+import (
+	"HAB/internal/logger"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+// BlobStore keeps large test files outside MySQL. Blobs are keyed by the
+// SHA-256 of their content, so they never change once stored and storing
+// the same content twice is a no-op.
+type BlobStore interface {
+	// Put stores data and returns its key
+	Put(ctx context.Context, data []byte) (string, error)
+	// Get returns the blob stored under key
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// ErrBlobNotFound is returned for keys with no blob stored
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobKey returns the key data is stored under
+func BlobKey(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validBlobKey(key string) bool {
+	if len(key) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(key)
+	return err == nil
+}
+
+// blobPath spreads blobs over subdirectories named after the first bytes of
+// their key, keeping directories small
+func blobPath(dir, key string) string {
+	return filepath.Join(dir, key[:2], key[2:4], key)
+}
+
+// writeFileAtomic writes data to a temporary file renamed into place, so
+// readers never see a partly written blob
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LocalBlobStore stores blobs as files under a directory, for single-host
+// deployments or a directory shared between hosts
+type LocalBlobStore struct {
+	dir string
+}
+
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+func (s *LocalBlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := BlobKey(data)
+	path := blobPath(s.dir, key)
+
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return "", fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+	return key, nil
+}
+
+func (s *LocalBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	data, err := os.ReadFile(blobPath(s.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// S3BlobStore stores blobs as objects of an S3-compatible bucket, such as
+// AWS S3 or MinIO
+type S3BlobStore struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3BlobStore connects to the bucket, creating it if it does not exist
+func NewS3BlobStore(ctx context.Context, endpoint, accessKey, secretKey, bucket string, useSSL bool) (*S3BlobStore, error) {
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: useSSL,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+	}
+	if !exists {
+		if err := client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+	}
+
+	return &S3BlobStore{client: client, bucket: bucket}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := BlobKey(data)
+
+	if _, err := s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{}); err == nil {
+		return key, nil
+	} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return "", fmt.Errorf("failed to check blob %s: %w", key, err)
+	}
+
+	_, err := s.client.PutObject(ctx, s.bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	if err != nil {
+		return "", fmt.Errorf("failed to store blob %s: %w", key, err)
+	}
+	return key, nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	object, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get blob %s: %w", key, err)
+	}
+	defer object.Close()
+
+	data, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%w: %s", ErrBlobNotFound, key)
+		}
+		return nil, fmt.Errorf("failed to read blob %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// DiskBlobCache keeps the blobs a worker reads on its local disk, so each
+// test file is downloaded once per host. Blobs never change, so cached
+// files never go stale; the directory can be emptied at any time.
+type DiskBlobCache struct {
+	store BlobStore
+	dir   string
+}
+
+func NewDiskBlobCache(store BlobStore, dir string) (*DiskBlobCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create blob cache directory: %w", err)
+	}
+	return &DiskBlobCache{store: store, dir: dir}, nil
+}
+
+// Get returns a blob from the disk, fetching it from the store on a miss.
+// Fetched blobs are checked against their key before being cached.
+func (c *DiskBlobCache) Get(ctx context.Context, key string) ([]byte, error) {
+	if !validBlobKey(key) {
+		return nil, fmt.Errorf("invalid blob key: %q", key)
+	}
+
+	path := blobPath(c.dir, key)
+	if data, err := os.ReadFile(path); err == nil {
+		return data, nil
+	}
+
+	data, err := c.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if BlobKey(data) != key {
+		return nil, fmt.Errorf("blob %s is corrupted", key)
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		logger.Log.Warn("Failed to cache blob on disk",
+			zap.String("key", key),
+			zap.Error(err))
+	}
+	return data, nil
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// testBlobStore checks the behaviour every BlobStore must have
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+	ctx := context.Background()
+	data := []byte("1 2 3\n4 5 6\n")
+
+	key, err := store.Put(ctx, data)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if key != BlobKey(data) {
+		t.Errorf("Put returned key %s, want %s", key, BlobKey(data))
+	}
+
+	again, err := store.Put(ctx, data)
+	if err != nil {
+		t.Fatalf("Put of the same content: %v", err)
+	}
+	if again != key {
+		t.Errorf("same content stored under %s and %s", key, again)
+	}
+
+	got, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Get returned %q, want %q", got, data)
+	}
+
+	if _, err := store.Get(ctx, BlobKey([]byte("never stored"))); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get of a missing blob returned %v, want ErrBlobNotFound", err)
+	}
+
+	if _, err := store.Get(ctx, "../../etc/passwd"); err == nil {
+		t.Error("Get accepted an invalid key")
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+// S3 tests run against a real endpoint, such as a local MinIO, and are
+// skipped unless S3_TEST_ENDPOINT is set, e.g. to localhost:9000
+func TestS3BlobStore(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+
+	store, err := NewS3BlobStore(context.Background(), endpoint,
+		os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY"), "hab-blobs-test", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+// countingBlobStore serves blobs from memory and counts the reads
+type countingBlobStore struct {
+	blobs map[string][]byte
+	gets  int
+}
+
+func (s *countingBlobStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := BlobKey(data)
+	s.blobs[key] = data
+	return key, nil
+}
+
+func (s *countingBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.gets++
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return data, nil
+}
+
+func TestDiskBlobCache(t *testing.T) {
+	ctx := context.Background()
+	store := &countingBlobStore{blobs: make(map[string][]byte)}
+	cache, err := NewDiskBlobCache(store, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte("expected output\n")
+	key, _ := store.Put(ctx, data)
+
+	for i := 0; i < 2; i++ {
+		got, err := cache.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get: %v", err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Get returned %q, want %q", got, data)
+		}
+	}
+	if store.gets != 1 {
+		t.Errorf("store read %d times, want once", store.gets)
+	}
+
+	if _, err := cache.Get(ctx, BlobKey([]byte("never stored"))); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get of a missing blob returned %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestDiskBlobCacheRejectsCorruptedBlobs(t *testing.T) {
+	ctx := context.Background()
+	key := BlobKey([]byte("original"))
+	store := &countingBlobStore{blobs: map[string][]byte{key: []byte("tampered")}}
+	cache, err := NewDiskBlobCache(store, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cache.Get(ctx, key); err == nil {
+		t.Fatal("Get returned a blob not matching its key")
+	}
+	if _, err := cache.Get(ctx, key); err == nil {
+		t.Fatal("the corrupted blob was cached")
+	}
+	if store.gets != 2 {
+		t.Errorf("store read %d times, want twice", store.gets)
+	}
+}
@@ -12,6 +12,8 @@ type Cache interface {
 	Get(ctx context.Context, key string, dest interface{}) error
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Delete(ctx context.Context, key string) error
+	DeleteMatching(ctx context.Context, pattern string) error
+	Incr(ctx context.Context, key string) (int64, error)
 }
 
 type redisCache struct {
@@ -41,3 +43,28 @@ func (r *redisCache) Set(ctx context.Context, key string, value interface{}, exp
 func (r *redisCache) Delete(ctx context.Context, key string) error {
 	return r.client.Del(ctx, key).Err()
 }
+
+// DeleteMatching deletes every key matching a glob-style pattern. It scans the
+// keyspace incrementally, so it does not block Redis on large databases.
+func (r *redisCache) DeleteMatching(ctx context.Context, pattern string) error {
+	iter := r.client.Scan(ctx, 0, pattern, 100).Iterator()
+
+	var keys []string
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+	return r.client.Del(ctx, keys...).Err()
+}
+
+// Incr increments an integer counter, starting from 0 when it is missing.
+// Counters can be read with Get.
+func (r *redisCache) Incr(ctx context.Context, key string) (int64, error) {
+	return r.client.Incr(ctx, key).Result()
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CompareOutput reports whether the output of a test run is accepted by a
+// problem's checker. Unknown checkers fall back to exact comparison.
+func CompareOutput(checker, actual, expected string) bool {
+	if checker == models.CheckerTokens {
+		return compareTokens(actual, expected, 0)
+	}
+	if tolerance, ok := strings.CutPrefix(checker, models.CheckerFloatPrefix); ok {
+		value, err := strconv.ParseFloat(tolerance, 64)
+		if err == nil {
+			return compareTokens(actual, expected, value)
+		}
+	}
+	return strings.TrimSpace(actual) == strings.TrimSpace(expected)
+}
+
+// compareTokens compares whitespace-separated tokens. With a tolerance,
+// numeric tokens may differ by that absolute or relative error.
+func compareTokens(actual, expected string, tolerance float64) bool {
+	actualTokens := strings.Fields(actual)
+	expectedTokens := strings.Fields(expected)
+	if len(actualTokens) != len(expectedTokens) {
+		return false
+	}
+
+	for i, want := range expectedTokens {
+		got := actualTokens[i]
+		if got == want {
+			continue
+		}
+		if tolerance == 0 {
+			return false
+		}
+
+		wantValue, err := strconv.ParseFloat(want, 64)
+		if err != nil {
+			return false
+		}
+		gotValue, err := strconv.ParseFloat(got, 64)
+		if err != nil || math.IsNaN(gotValue) {
+			return false
+		}
+		diff := math.Abs(gotValue - wantValue)
+		if diff > tolerance && diff > tolerance*math.Abs(wantValue) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -18,18 +18,29 @@ import (
 
 type LanguageConfig struct {
 	ContainerImage   string
+	Toolchain        string // Base image of the runner, recorded on every judgement
 	FileExtension    string
 	BuildCommand     []string // Empty for interpreted languages
 	RunCommand       []string
 	NeedsCompilation bool
+	// Submissions can only be made in enabled languages
+	Enabled bool
+	// MaxSourceSize is the largest accepted source code, in bytes
+	MaxSourceSize int
 }
 
+// DefaultMaxSourceSize applies to languages without a configured limit
+const DefaultMaxSourceSize = 64 * 1024
+
 type TestResult struct {
 	TestCaseID     int
 	Passed         bool
 	ExpectedOutput string
 	ActualOutput   string
 	Error          string
+	Duration       time.Duration
+	// LimitExceeded is the verdict of a run stopped by the time or memory limit
+	LimitExceeded string
 }
 
 type ExecutionResult struct {
@@ -47,19 +58,40 @@ type CodeRunnerRequest struct {
 	SystemCode   string
 	ImportCode   string
 	LanguageName string
+	Settings     models.JudgeSettings
+	// OnProgress, if set, is called when compilation starts and before each test case
+	OnProgress func(stage string, test, total int)
 }
 
+func (r CodeRunnerRequest) progress(stage string, test, total int) {
+	if r.OnProgress != nil {
+		r.OnProgress(stage, test, total)
+	}
+}
+
+// TestCase is a test to judge against. Large files are in the blob store:
+// their key is set instead, and the runner loads them when needed.
 type TestCase struct {
-	ID       int
-	Input    string
-	Expected string
+	ID           int
+	Input        string
+	Expected     string
+	InputBlob    string
+	ExpectedBlob string
+}
+
+// TestSet is the published version of a problem's tests that submissions
+// are judged against
+type TestSet struct {
+	Version   int
+	TestCases []TestCase
 }
 
 type CodeRunnerService struct {
 	workDir string
+	blobs   *DiskBlobCache
 }
 
-func NewCodeRunnerService(workDir string) (*CodeRunnerService, error) {
+func NewCodeRunnerService(workDir string, blobs *DiskBlobCache) (*CodeRunnerService, error) {
 	// Create working directory if it doesn't exist
 	if err := os.MkdirAll(workDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create working directory: %w", err)
@@ -67,35 +99,43 @@ func NewCodeRunnerService(workDir string) (*CodeRunnerService, error) {
 
 	return &CodeRunnerService{
 		workDir: workDir,
+		blobs:   blobs,
 	}, nil
 }
 
 var languageConfigs = map[string]LanguageConfig{
 	"go": {
 		ContainerImage:   "go-runner",
+		Toolchain:        "golang:1.21-alpine",
 		FileExtension:    "go",
 		BuildCommand:     []string{"go", "build", "-o", "solution", "main.go"},
 		RunCommand:       []string{"./solution"},
 		NeedsCompilation: true,
+		Enabled:          true,
+		MaxSourceSize:    DefaultMaxSourceSize,
 	},
 	"python": {
 		ContainerImage:   "python-runner",
+		Toolchain:        "python:3.12-slim",
 		FileExtension:    "py",
 		BuildCommand:     []string{},
 		RunCommand:       []string{"python", "main.py"},
 		NeedsCompilation: false,
+		Enabled:          true,
+		MaxSourceSize:    DefaultMaxSourceSize,
 	},
 }
 
-func GetLanguageConfig(languageID int) (string, LanguageConfig, error) {
-	var languageName string
+// languageNames maps the language IDs used by the API and stored on
+// submissions to language names
+var languageNames = map[int]string{
+	1: "python",
+	2: "go",
+}
 
-	switch languageID {
-	case 1:
-		languageName = "python"
-	case 2:
-		languageName = "go"
-	default:
+func GetLanguageConfig(languageID int) (string, LanguageConfig, error) {
+	languageName, ok := languageNames[languageID]
+	if !ok {
 		return "", LanguageConfig{}, fmt.Errorf("unsupported language ID: %d", languageID)
 	}
 
@@ -107,6 +147,70 @@ func GetLanguageConfig(languageID int) (string, LanguageConfig, error) {
 	return languageName, config, nil
 }
 
+// GetLanguageID returns the ID of a language from its name
+func GetLanguageID(languageName string) (int, error) {
+	for id, name := range languageNames {
+		if name == languageName {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported language: %s", languageName)
+}
+
+// ConfigureLanguages sets which languages accept submissions and their source
+// size limits, by language name. An empty enabled list keeps every language
+// enabled; sizes not listed in maxSourceSizes use defaultMaxSourceSize.
+// It must be called before serving requests.
+func ConfigureLanguages(enabled []string, defaultMaxSourceSize int, maxSourceSizes map[string]int) error {
+	for _, name := range enabled {
+		if _, ok := languageConfigs[name]; !ok {
+			return fmt.Errorf("unknown language in enabled languages: %s", name)
+		}
+	}
+	for name := range maxSourceSizes {
+		if _, ok := languageConfigs[name]; !ok {
+			return fmt.Errorf("unknown language in source size limits: %s", name)
+		}
+	}
+
+	for name, config := range languageConfigs {
+		if len(enabled) > 0 {
+			config.Enabled = false
+			for _, enabledName := range enabled {
+				if enabledName == name {
+					config.Enabled = true
+				}
+			}
+		}
+
+		if defaultMaxSourceSize > 0 {
+			config.MaxSourceSize = defaultMaxSourceSize
+		}
+		if size, ok := maxSourceSizes[name]; ok && size > 0 {
+			config.MaxSourceSize = size
+		}
+
+		languageConfigs[name] = config
+	}
+
+	return nil
+}
+
+// CheckSubmissionSource checks that a new submission uses an enabled
+// language and that its source code fits the size limit of that language.
+func CheckSubmissionSource(languageID int, sourceCode string) error {
+	languageName, config, err := GetLanguageConfig(languageID)
+	if err != nil || !config.Enabled {
+		return fmt.Errorf("unsupported language ID: %d", languageID)
+	}
+
+	if len(sourceCode) > config.MaxSourceSize {
+		return fmt.Errorf("source code exceeds the %d bytes limit for %s", config.MaxSourceSize, languageName)
+	}
+
+	return nil
+}
+
 func (s *CodeRunnerService) Execute(ctx context.Context, req CodeRunnerRequest) (*ExecutionResult, error) {
 	startTime := time.Now()
 	langConfig, ok := languageConfigs[req.LanguageName]
@@ -127,8 +231,15 @@ func (s *CodeRunnerService) Execute(ctx context.Context, req CodeRunnerRequest)
 		return nil, fmt.Errorf("failed to write code file: %w", err)
 	}
 
-	containerID, err := s.startContainer(codeFilePath, req.LanguageName)
+	if langConfig.NeedsCompilation {
+		req.progress(StageCompiling, 0, 0)
+	}
+
+	containerID, err := s.startContainer(ctx, codeFilePath, req.LanguageName, req.Settings.MemoryLimitMB)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution cancelled: %w", ctx.Err())
+		}
 		// If compilation error, return immediately
 		if strings.Contains(err.Error(), "compilation error") {
 			return &ExecutionResult{
@@ -139,15 +250,41 @@ func (s *CodeRunnerService) Execute(ctx context.Context, req CodeRunnerRequest)
 		}
 		return nil, fmt.Errorf("failed to start container: %w", err)
 	}
-	defer exec.Command("docker", "stop", containerID).Run()
+	// A run stopped by the time limit may still be running in the container
+	limitExceeded := false
+	defer func() { stopContainer(ctx, containerID, limitExceeded) }()
 
 	results := make([]TestResult, 0, len(req.TestCases))
 
-	for _, tc := range req.TestCases {
-		result, err := s.executeTestCase(containerID, tc, req.LanguageName)
+	for i, tc := range req.TestCases {
+		req.progress(StageRunning, i+1, len(req.TestCases))
+
+		// Loaded one at a time, so only one large test is in memory
+		tc, err := s.loadTestCase(ctx, tc)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := s.executeTestCase(ctx, containerID, tc, req.LanguageName, req.Settings)
+
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("execution cancelled: %w", ctx.Err())
+		}
+
+		if result.LimitExceeded != "" {
+			limitExceeded = true
+			results = append(results, result)
+			return &ExecutionResult{
+				Status:        result.LimitExceeded,
+				Results:       results,
+				FailedTestID:  &tc.ID,
+				ExecutionTime: time.Since(startTime),
+			}, nil
+		}
 
 		if err != nil {
 			// Save error output and stop execution
+			results = append(results, result)
 			errorOutput := err.Error()
 			return &ExecutionResult{
 				Status:        models.StatusCompilationError,
@@ -178,7 +315,7 @@ func (s *CodeRunnerService) Execute(ctx context.Context, req CodeRunnerRequest)
 	}, nil
 }
 
-func (s *CodeRunnerService) startContainer(codePath, language string) (string, error) {
+func (s *CodeRunnerService) startContainer(ctx context.Context, codePath, language string, memoryLimitMB int) (string, error) {
 	langConfig, ok := languageConfigs[language]
 	if !ok {
 		return "", fmt.Errorf("unsupported language: %s", language)
@@ -189,9 +326,16 @@ func (s *CodeRunnerService) startContainer(codePath, language string) (string, e
 		return "", fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	// Start container with code mounted
-	cmd := exec.Command(
+	if memoryLimitMB <= 0 {
+		memoryLimitMB = models.DefaultMemoryLimitMB
+	}
+
+	// Start container with code mounted. The memory limit covers the whole
+	// container, without swap, so a run going over it is OOM-killed.
+	cmd := exec.CommandContext(ctx,
 		"docker", "run", "-d", "--rm",
+		"--memory", fmt.Sprintf("%dm", memoryLimitMB),
+		"--memory-swap", fmt.Sprintf("%dm", memoryLimitMB),
 		"-v", fmt.Sprintf("%s:/app/main.%s", absCodePath, langConfig.FileExtension),
 		"-w", "/app",
 		langConfig.ContainerImage,
@@ -208,12 +352,12 @@ func (s *CodeRunnerService) startContainer(codePath, language string) (string, e
 	// Compile if necessary (only for compiled languages)
 	if langConfig.NeedsCompilation && len(langConfig.BuildCommand) > 0 {
 		compileArgs := append([]string{"exec", containerID}, langConfig.BuildCommand...)
-		compileCmd := exec.Command("docker", compileArgs...)
+		compileCmd := exec.CommandContext(ctx, "docker", compileArgs...)
 
 		compileOutput, err := compileCmd.CombinedOutput()
 		if err != nil {
 			// Stop the container if compilation fails
-			exec.Command("docker", "stop", containerID).Run()
+			stopContainer(ctx, containerID, false)
 			return "", fmt.Errorf("compilation error: %v, output: %s", err, compileOutput)
 		}
 	}
@@ -221,16 +365,56 @@ func (s *CodeRunnerService) startContainer(codePath, language string) (string, e
 	return containerID, nil
 }
 
+// stopContainer stops a container, killing it right away if the execution
+// was cancelled or kill is set
+func stopContainer(ctx context.Context, containerID string, kill bool) {
+	if kill || ctx.Err() != nil {
+		exec.Command("docker", "kill", containerID).Run()
+		return
+	}
+	exec.Command("docker", "stop", containerID).Run()
+}
+
+// loadTestCase fills in the files of a test case kept in the blob store
+func (s *CodeRunnerService) loadTestCase(ctx context.Context, tc TestCase) (TestCase, error) {
+	files := []struct {
+		key    string
+		target *string
+	}{
+		{tc.InputBlob, &tc.Input},
+		{tc.ExpectedBlob, &tc.Expected},
+	}
+	for _, file := range files {
+		if file.key == "" {
+			continue
+		}
+		data, err := s.blobs.Get(ctx, file.key)
+		if err != nil {
+			return tc, fmt.Errorf("failed to load test case %d: %w", tc.ID, err)
+		}
+		*file.target = string(data)
+	}
+	return tc, nil
+}
+
 // executeTestCase runs a single test case in the container
-func (s *CodeRunnerService) executeTestCase(containerID string, tc TestCase, language string) (TestResult, error) {
+func (s *CodeRunnerService) executeTestCase(ctx context.Context, containerID string, tc TestCase, language string, settings models.JudgeSettings) (TestResult, error) {
 	langConfig, ok := languageConfigs[language]
 	if !ok {
 		return TestResult{}, fmt.Errorf("unsupported language: %s", language)
 	}
 
+	timeLimit := time.Duration(settings.TimeLimitMs) * time.Millisecond
+	if timeLimit <= 0 {
+		timeLimit = models.DefaultTimeLimitMs * time.Millisecond
+	}
+	runCtx, cancel := context.WithTimeout(ctx, timeLimit)
+	defer cancel()
+
 	// Construct the docker exec command with the language-specific run command
 	args := append([]string{"exec", "-i", containerID}, langConfig.RunCommand...)
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(runCtx, "docker", args...)
+	cmd.WaitDelay = time.Second
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdin = strings.NewReader(tc.Input)
@@ -243,7 +427,28 @@ func (s *CodeRunnerService) executeTestCase(containerID string, tc TestCase, lan
 		zap.Strings("command", langConfig.RunCommand),
 	)
 
+	startTime := time.Now()
 	err := cmd.Run()
+	duration := time.Since(startTime)
+
+	// The time limit is measured on the wall clock, docker exec included
+	if err != nil && ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+		return TestResult{
+			TestCaseID:    tc.ID,
+			Duration:      duration,
+			LimitExceeded: models.StatusTimeLimit,
+		}, nil
+	}
+
+	// 137 is a run killed by SIGKILL, which the OOM killer uses
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 137 {
+		return TestResult{
+			TestCaseID:    tc.ID,
+			Duration:      duration,
+			LimitExceeded: models.StatusMemoryLimit,
+		}, nil
+	}
 
 	// Check for execution errors
 	if err != nil {
@@ -253,6 +458,7 @@ func (s *CodeRunnerService) executeTestCase(containerID string, tc TestCase, lan
 			ExpectedOutput: tc.Expected,
 			ActualOutput:   stdout.String(),
 			Error:          fmt.Sprintf("execution error: %v, stderr: %s", err, stderr.String()),
+			Duration:       duration,
 		}, errors.New(stderr.String())
 	}
 
@@ -262,9 +468,10 @@ func (s *CodeRunnerService) executeTestCase(containerID string, tc TestCase, lan
 
 	return TestResult{
 		TestCaseID:     tc.ID,
-		Passed:         actualOutput == expectedOutput,
+		Passed:         CompareOutput(settings.Checker, actualOutput, expectedOutput),
 		ExpectedOutput: expectedOutput,
 		ActualOutput:   actualOutput,
+		Duration:       duration,
 	}, nil
 }
 
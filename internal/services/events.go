@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Stages a submission goes through while being judged
+const (
+	StageQueued    = "queued"
+	StageCompiling = "compiling"
+	StageRunning   = "running"
+	StageFinished  = "finished"
+)
+
+// SubmissionEvent is a status transition of a submission, published by the
+// API and workers and streamed to clients.
+type SubmissionEvent struct {
+	SubmissionID int       `json:"submission_id"`
+	UserID       int       `json:"user_id"`
+	Stage        string    `json:"stage"`
+	Status       string    `json:"status,omitempty"`
+	Test         int       `json:"test,omitempty"`  // 1-based index of the running test case
+	Total        int       `json:"total,omitempty"` // number of test cases
+	Time         time.Time `json:"time"`
+}
+
+// userEventsMaxLen bounds the per-user event history kept for resuming connections
+const userEventsMaxLen = 1000
+
+// UserEvent is a submission event read from a user's event history
+type UserEvent struct {
+	ID    string          `json:"id"`
+	Event SubmissionEvent `json:"event"`
+}
+
+// SubmissionEvents publishes submission events over Redis pub/sub so that
+// any API instance can stream them, whichever worker judges the submission.
+// Events go to their user's channel, and are also appended to a capped
+// per-user stream, so a client can resume from the last event ID it saw.
+type SubmissionEvents struct {
+	rdb *redis.Client
+}
+
+func NewSubmissionEvents(rdb *redis.Client) *SubmissionEvents {
+	return &SubmissionEvents{rdb: rdb}
+}
+
+func (e *SubmissionEvents) Publish(ctx context.Context, event SubmissionEvent) error {
+	if event.UserID == 0 {
+		return fmt.Errorf("submission event of submission %d has no user", event.SubmissionID)
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode submission event: %w", err)
+	}
+
+	// The user's live channel carries the stream ID, so it is only known
+	// once the event is in the stream
+	id, err := e.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: userEventsStream(event.UserID),
+		MaxLen: userEventsMaxLen,
+		Approx: true,
+		ID:     "*",
+		Values: map[string]interface{}{"event": data},
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to publish submission event: %w", err)
+	}
+	userEvent, err := json.Marshal(UserEvent{ID: id, Event: event})
+	if err != nil {
+		return fmt.Errorf("failed to encode submission event: %w", err)
+	}
+	if err := e.rdb.Publish(ctx, userLiveChannel(event.UserID), userEvent).Err(); err != nil {
+		return fmt.Errorf("failed to publish submission event: %w", err)
+	}
+
+	return nil
+}
+
+// LastUserEventID returns the ID of the newest event of a user, to start
+// following from when the client has nothing to resume from.
+func (e *SubmissionEvents) LastUserEventID(ctx context.Context, userID int) (string, error) {
+	messages, err := e.rdb.XRevRangeN(ctx, userEventsStream(userID), "+", "-", 1).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to get last user event: %w", err)
+	}
+	if len(messages) == 0 {
+		return "0-0", nil
+	}
+	return messages[0].ID, nil
+}
+
+// UserEventsAfter returns up to count events of a user published after
+// lastID, without waiting for new ones
+func (e *SubmissionEvents) UserEventsAfter(ctx context.Context, userID int, lastID string, count int64) ([]UserEvent, error) {
+	messages, err := e.rdb.XRangeN(ctx, userEventsStream(userID), "("+lastID, "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read user events: %w", err)
+	}
+
+	events := make([]UserEvent, 0, len(messages))
+	for _, msg := range messages {
+		data, ok := msg.Values["event"].(string)
+		if !ok {
+			continue
+		}
+		var event SubmissionEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		events = append(events, UserEvent{ID: msg.ID, Event: event})
+	}
+
+	return events, nil
+}
+
+// userLiveChannelPattern matches the live channel of every user
+const userLiveChannelPattern = "user:*:live"
+
+// userLiveChannel carries the events of a user as they are added to the
+// user's stream, with their stream IDs
+func userLiveChannel(userID int) string {
+	return fmt.Sprintf("user:%d:live", userID)
+}
+
+func userEventsStream(userID int) string {
+	return fmt.Sprintf("user:%d:events", userID)
+}
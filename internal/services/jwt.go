@@ -11,10 +11,19 @@ type TokenService struct {
 	jwtSecret string
 }
 
+// Token types, kept in the typ claim so a refresh token can't be used as an access token
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
+	// Role is only in access tokens; a refresh reads it again from the database
+	Role string `json:"role,omitempty"`
+	Type string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
@@ -22,12 +31,14 @@ func NewTokenService(secret string) *TokenService {
 	return &TokenService{jwtSecret: secret}
 }
 
-func (s *TokenService) GenerateTokens(userID int, username string, email string) (accessToken string, refreshToken string, err error) {
+func (s *TokenService) GenerateTokens(userID int, username string, email string, role string) (accessToken string, refreshToken string, err error) {
 	accessExpiresAt := time.Now().Add(time.Hour * 1)
 	accessClaims := &Claims{
 		UserID:   userID,
 		Username: username,
 		Email:    email,
+		Role:     role,
+		Type:     TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(accessExpiresAt),
 		},
@@ -43,6 +54,7 @@ func (s *TokenService) GenerateTokens(userID int, username string, email string)
 		UserID:   userID,
 		Username: username,
 		Email:    email,
+		Type:     TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(refreshExpiresAt),
 		},
@@ -55,7 +67,9 @@ func (s *TokenService) GenerateTokens(userID int, username string, email string)
 	return accessToken, refreshToken, nil
 }
 
-func (s *TokenService) ValidateToken(tokenString string) (*Claims, error) {
+// ValidateToken checks the signature and expiry of a token and that it is of
+// the given type, TokenTypeAccess or TokenTypeRefresh.
+func (s *TokenService) ValidateToken(tokenString string, tokenType string) (*Claims, error) {
 	claims := &Claims{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
 		return []byte(s.jwtSecret), nil
@@ -69,5 +83,9 @@ func (s *TokenService) ValidateToken(tokenString string) (*Claims, error) {
 		return nil, fmt.Errorf("invalid token")
 	}
 
+	if claims.Type != tokenType {
+		return nil, fmt.Errorf("expected %s token, got %q", tokenType, claims.Type)
+	}
+
 	return claims, nil
 }
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// kattisProblem is the part of a Kattis problem.yaml the importer reads,
+// in both the legacy and the 2023-07 problem package format
+type kattisProblem struct {
+	Name           interface{} `yaml:"name"` // a string, or names by language
+	Type           interface{} `yaml:"type"` // 2023-07: a string or a list
+	Validation     interface{} `yaml:"validation"`
+	ValidatorFlags interface{} `yaml:"validator_flags"`
+	Limits         struct {
+		TimeLimit float64 `yaml:"time_limit"` // seconds, 2023-07 only
+		Memory    int     `yaml:"memory"`     // MiB
+	} `yaml:"limits"`
+}
+
+// kattisStatements are the statement files tried in order
+var kattisStatements = []string{
+	"statement/problem.en.md",
+	"problem_statement/problem.en.md",
+	"statement/problem.en.tex",
+	"problem_statement/problem.en.tex",
+	"problem_statement/problem.tex",
+}
+
+// kattisIgnoredDirs are package parts the judge has no use for, reported
+// when present
+var kattisIgnoredDirs = map[string]string{
+	"input_validators":        "input validators are not imported",
+	"input_format_validators": "input validators are not imported",
+	"submissions":             "submissions are not imported",
+	"generators":              "generators are not imported",
+	"attachments":             "attachments are not imported",
+	"include":                 "include files are not imported",
+}
+
+var (
+	kattisProblemName = regexp.MustCompile(`\\problemname\{([^}]*)\}`)
+	kattisSection     = regexp.MustCompile(`(?m)^\\section\*?\{([^}]*)\}`)
+)
+
+// ReadKattisPackage converts a Kattis problem package into a problem.
+// Features the judge has no equivalent for are an error when they change
+// verdicts, and a warning otherwise.
+func ReadKattisPackage(archive *packageArchive) (*models.ProblemPackage, []string, error) {
+	content, err := archive.read("problem.yaml")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problem kattisProblem
+	if err := yaml.Unmarshal([]byte(content), &problem); err != nil {
+		return nil, nil, fmt.Errorf("invalid problem.yaml: %w", err)
+	}
+
+	var warnings []string
+
+	for _, kind := range append(yamlStrings(problem.Validation), yamlStrings(problem.Type)...) {
+		switch kind {
+		case "interactive", "multi-pass":
+			return nil, nil, fmt.Errorf("%s problems are not supported", kind)
+		case "custom":
+			return nil, nil, fmt.Errorf("custom output validators are not supported")
+		case "score", "scoring":
+			warnings = append(warnings, "scoring is not supported, submissions must pass every test")
+		}
+	}
+	for _, name := range archive.names {
+		dir, _, _ := strings.Cut(name, "/")
+		if dir == "output_validators" || dir == "output_validator" {
+			return nil, nil, fmt.Errorf("custom output validators are not supported")
+		}
+	}
+
+	checker, checkerWarnings, err := kattisChecker(yamlStrings(problem.ValidatorFlags))
+	if err != nil {
+		return nil, nil, err
+	}
+	warnings = append(warnings, checkerWarnings...)
+
+	pkg := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Difficulty:    models.DifficultyMedium,
+			MemoryLimitMB: problem.Limits.Memory,
+			Checker:       checker,
+		},
+	}
+	warnings = append(warnings, "Kattis packages have no difficulty, it is set to "+models.DifficultyMedium)
+
+	if problem.Limits.Memory == 0 {
+		warnings = append(warnings, fmt.Sprintf("the package has no memory limit, it is set to %d MB", models.DefaultMemoryLimitMB))
+	}
+	if problem.Limits.TimeLimit > 0 {
+		pkg.Problem.TimeLimitMs = int(math.Round(problem.Limits.TimeLimit * 1000))
+	} else {
+		warnings = append(warnings, fmt.Sprintf("the package has no time limit, it is set to %d ms", models.DefaultTimeLimitMs))
+	}
+
+	title, description, err := kattisStatement(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg.Problem.Description = description
+	warnings = append(warnings, latexMacroWarnings(description)...)
+	pkg.Problem.Title = kattisTitle(problem.Name)
+	if pkg.Problem.Title == "" {
+		pkg.Problem.Title = title
+	}
+
+	testCases, samples, err := kattisTests(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg.TestCases = testCases
+	if samples > 0 {
+		pkg.Problem.SampleInput = testCases[0].Input
+		pkg.Problem.SampleOutput = testCases[0].ExpectedOutput
+	}
+
+	reported := make(map[string]bool)
+	images := make(map[string]bool)
+	for _, name := range archive.names {
+		dir, _, _ := strings.Cut(name, "/")
+		warning, ok := kattisIgnoredDirs[dir]
+		if ok && !reported[warning] {
+			warnings = append(warnings, warning)
+			reported[warning] = true
+		}
+		if (dir == "statement" || dir == "problem_statement") && !isKattisStatement(name) {
+			var image *models.AttachmentFile
+			if strings.Count(name, "/") == 1 {
+				image, err = statementImage(archive, name)
+				if err != nil {
+					return nil, nil, err
+				}
+			}
+			if image == nil || images[image.Name] {
+				warnings = append(warnings, "statement file is not imported: "+name)
+				continue
+			}
+			images[image.Name] = true
+			pkg.Attachments = append(pkg.Attachments, *image)
+		}
+		if path.Base(name) == "testdata.yaml" && !reported[name] {
+			warnings = append(warnings, "test data settings are not supported: "+name)
+			reported[name] = true
+		}
+	}
+
+	return pkg, warnings, nil
+}
+
+// kattisChecker maps the flags of the default output validator to a checker
+func kattisChecker(flags []string) (string, []string, error) {
+	var warnings []string
+	checker := models.CheckerTokens
+	caseSensitive := false
+	tolerance := ""
+
+	for i := 0; i < len(flags); i++ {
+		switch flag := flags[i]; flag {
+		case "case_sensitive":
+			caseSensitive = true
+		case "space_change_sensitive":
+			checker = models.CheckerExact
+		case "float_tolerance", "float_absolute_tolerance", "float_relative_tolerance":
+			if i+1 >= len(flags) {
+				return "", nil, fmt.Errorf("validator flag %s has no value", flag)
+			}
+			i++
+			if _, err := strconv.ParseFloat(flags[i], 64); err != nil {
+				return "", nil, fmt.Errorf("invalid %s: %s", flag, flags[i])
+			}
+			if tolerance != "" && tolerance != flags[i] {
+				warnings = append(warnings, "different absolute and relative tolerances are not supported, the last one is used for both")
+			} else if flag != "float_tolerance" {
+				warnings = append(warnings, flag+" is used as both absolute and relative tolerance")
+			}
+			tolerance = flags[i]
+		default:
+			return "", nil, fmt.Errorf("unsupported validator flag: %s", flag)
+		}
+	}
+
+	if tolerance != "" {
+		checker = models.CheckerFloatPrefix + tolerance
+	}
+	if !caseSensitive {
+		warnings = append(warnings, "outputs are compared case-sensitively, unlike the default Kattis validator")
+	}
+	return checker, warnings, nil
+}
+
+// kattisTitle returns the name of a problem, in English if it has several
+func kattisTitle(name interface{}) string {
+	switch name := name.(type) {
+	case string:
+		return name
+	case map[string]interface{}:
+		if english, ok := name["en"].(string); ok {
+			return english
+		}
+		for _, value := range name {
+			if value, ok := value.(string); ok {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// kattisStatement returns the title and description from the statement,
+// with LaTeX section headings turned into Markdown ones
+func kattisStatement(archive *packageArchive) (string, string, error) {
+	for _, name := range kattisStatements {
+		if !archive.has(name) {
+			continue
+		}
+		text, err := archive.read(name)
+		if err != nil {
+			return "", "", err
+		}
+		if path.Ext(name) == ".md" {
+			return "", text, nil
+		}
+
+		title := ""
+		if match := kattisProblemName.FindStringSubmatch(text); match != nil {
+			title = strings.TrimSpace(match[1])
+			text = kattisProblemName.ReplaceAllString(text, "")
+		}
+		text = kattisSection.ReplaceAllString(text, "## $1")
+		return title, strings.TrimSpace(text) + "\n", nil
+	}
+
+	return "", "", fmt.Errorf("package has no English statement")
+}
+
+func isKattisStatement(name string) bool {
+	for _, statement := range kattisStatements {
+		if name == statement {
+			return true
+		}
+	}
+	return false
+}
+
+// kattisTests reads the sample tests, then the secret ones, each in path
+// order. It also returns how many of them are samples, which are visible.
+func kattisTests(archive *packageArchive) ([]models.TestCaseRequest, int, error) {
+	var testCases []models.TestCaseRequest
+	samples := 0
+
+	for _, group := range []string{"data/sample/", "data/secret/"} {
+		var inputs []string
+		for _, name := range archive.names {
+			if strings.HasPrefix(name, group) && path.Ext(name) == ".in" {
+				inputs = append(inputs, name)
+			}
+		}
+		sort.Strings(inputs)
+
+		for _, inputName := range inputs {
+			answerName := strings.TrimSuffix(inputName, ".in") + ".ans"
+			if !archive.has(answerName) {
+				return nil, 0, fmt.Errorf("test %s has no .ans file", inputName)
+			}
+			input, err := archive.read(inputName)
+			if err != nil {
+				return nil, 0, err
+			}
+			answer, err := archive.read(answerName)
+			if err != nil {
+				return nil, 0, err
+			}
+			testCases = append(testCases, models.TestCaseRequest{
+				Input:          input,
+				ExpectedOutput: answer,
+				Visible:        group == "data/sample/",
+			})
+		}
+
+		if group == "data/sample/" {
+			samples = len(testCases)
+		}
+	}
+
+	return testCases, samples, nil
+}
+
+// yamlStrings reads a YAML value that is either a space-separated string
+// or a list of strings
+func yamlStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			values = append(values, strings.Fields(fmt.Sprint(item))...)
+		}
+		return values
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const kattisYAML = `name: Sum of Two
+limits:
+  time_limit: 1.5
+  memory: 512
+validator_flags: case_sensitive
+`
+
+// kattisFiles is a package with the given problem.yaml, a sample and a
+// secret test, and the statement files, or a Markdown one without any
+func kattisFiles(yaml string, statement ...[2]string) [][2]string {
+	if len(statement) == 0 {
+		statement = [][2]string{{"statement/problem.en.md", "Add two numbers."}}
+	}
+	files := [][2]string{
+		{"problem.yaml", yaml},
+		{"data/sample/1.in", "1 2\n"},
+		{"data/sample/1.ans", "3\n"},
+		{"data/secret/big.in", "10 20\n"},
+		{"data/secret/big.ans", "30\n"},
+	}
+	return append(files, statement...)
+}
+
+func TestReadKattisPackage(t *testing.T) {
+	archive := openTestArchive(t, kattisFiles(kattisYAML,
+		[2]string{"statement/problem.en.md", "Add two numbers.\n\n![graph](graph.png)\n"},
+		[2]string{"statement/graph.png", string(pngData)},
+	))
+
+	got, warnings, err := ReadKattisPackage(archive)
+	if err != nil {
+		t.Fatalf("ReadKattisPackage: %v", err)
+	}
+
+	want := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title:         "Sum of Two",
+			Description:   "Add two numbers.\n\n![graph](graph.png)\n",
+			Difficulty:    models.DifficultyMedium,
+			SampleInput:   "1 2\n",
+			SampleOutput:  "3\n",
+			TimeLimitMs:   1500,
+			MemoryLimitMB: 512,
+			Checker:       models.CheckerTokens,
+		},
+		TestCases: []models.TestCaseRequest{
+			{Input: "1 2\n", ExpectedOutput: "3\n", Visible: true},
+			{Input: "10 20\n", ExpectedOutput: "30\n"},
+		},
+		Attachments: []models.AttachmentFile{
+			{Name: "graph.png", Data: pngData},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got package %+v\nwant %+v", got, want)
+	}
+
+	wantWarnings := []string{"Kattis packages have no difficulty, it is set to Medium"}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestReadKattisPackageLaTeXStatement(t *testing.T) {
+	archive := openTestArchive(t, kattisFiles("limits:\n  memory: 256\n",
+		[2]string{"problem_statement/problem.en.tex",
+			"\\problemname{Sum of Two}\n\nAdd $a$ and $b$.\n\n\\section*{Input}\n\nTwo integers.\n"},
+	))
+
+	got, _, err := ReadKattisPackage(archive)
+	if err != nil {
+		t.Fatalf("ReadKattisPackage: %v", err)
+	}
+	if got.Problem.Title != "Sum of Two" {
+		t.Errorf("got title %q, want it from \\problemname", got.Problem.Title)
+	}
+	want := "Add $a$ and $b$.\n\n## Input\n\nTwo integers.\n"
+	if got.Problem.Description != want {
+		t.Errorf("got description %q, want %q", got.Problem.Description, want)
+	}
+}
+
+func TestReadKattisPackageWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  string
+	}{
+		{
+			name:  "case-insensitive default validator",
+			files: kattisFiles(strings.Replace(kattisYAML, "validator_flags: case_sensitive", "", 1)),
+			want:  "outputs are compared case-sensitively, unlike the default Kattis validator",
+		},
+		{
+			name:  "no time limit",
+			files: kattisFiles(strings.Replace(kattisYAML, "time_limit: 1.5", "", 1)),
+			want:  "the package has no time limit, it is set to 2000 ms",
+		},
+		{
+			name:  "scoring",
+			files: kattisFiles(kattisYAML + "type: scoring\n"),
+			want:  "scoring is not supported, submissions must pass every test",
+		},
+		{
+			name:  "relative tolerance",
+			files: kattisFiles(strings.Replace(kattisYAML, "case_sensitive", "case_sensitive float_relative_tolerance 1e-6", 1)),
+			want:  "float_relative_tolerance is used as both absolute and relative tolerance",
+		},
+		{
+			name:  "submissions",
+			files: kattisFiles(kattisYAML, [2]string{"statement/problem.en.md", "Add."}, [2]string{"submissions/accepted/a.py", "print(3)"}),
+			want:  "submissions are not imported",
+		},
+		{
+			name:  "statement file other than an image",
+			files: kattisFiles(kattisYAML, [2]string{"statement/problem.en.md", "Add."}, [2]string{"statement/notes.txt", "hi"}),
+			want:  "statement file is not imported: statement/notes.txt",
+		},
+		{
+			name:  "test data settings",
+			files: kattisFiles(kattisYAML, [2]string{"statement/problem.en.md", "Add."}, [2]string{"data/secret/testdata.yaml", "on_reject: continue"}),
+			want:  "test data settings are not supported: data/secret/testdata.yaml",
+		},
+		{
+			name: "LaTeX commands outside formulas",
+			files: kattisFiles(kattisYAML, [2]string{"problem_statement/problem.en.tex",
+				"Add $\\frac{a}{1}$ and $b$.\n\n\\begin{figure}\\includegraphics{graph.png}\\end{figure}\n"}),
+			want: "the statement uses LaTeX commands outside formulas, which are kept as is: \\begin, \\includegraphics, \\end",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := ReadKattisPackage(openTestArchive(t, tt.files))
+			if err != nil {
+				t.Fatalf("ReadKattisPackage: %v", err)
+			}
+			for _, warning := range warnings {
+				if warning == tt.want {
+					return
+				}
+			}
+			t.Errorf("got warnings %q, want one being %q", warnings, tt.want)
+		})
+	}
+}
+
+func TestReadKattisPackageRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  string
+	}{
+		{
+			name:  "custom validation",
+			files: kattisFiles(kattisYAML + "validation: custom interactive\n"),
+			want:  "custom output validators are not supported",
+		},
+		{
+			name:  "interactive type",
+			files: kattisFiles(kattisYAML + "type: [pass-fail, interactive]\n"),
+			want:  "interactive problems are not supported",
+		},
+		{
+			name:  "output validator",
+			files: kattisFiles(kattisYAML, [2]string{"statement/problem.en.md", "Add."}, [2]string{"output_validators/check/check.cpp", "int main() {}"}),
+			want:  "custom output validators are not supported",
+		},
+		{
+			name:  "unsupported validator flag",
+			files: kattisFiles(strings.Replace(kattisYAML, "case_sensitive", "case_sensitive ignore_order", 1)),
+			want:  "unsupported validator flag: ignore_order",
+		},
+		{
+			name:  "tolerance without a value",
+			files: kattisFiles(strings.Replace(kattisYAML, "case_sensitive", "float_tolerance", 1)),
+			want:  "validator flag float_tolerance has no value",
+		},
+		{
+			name:  "test without an answer",
+			files: append(kattisFiles(kattisYAML), [2]string{"data/secret/extra.in", "5 5\n"}),
+			want:  "test data/secret/extra.in has no .ans file",
+		},
+		{
+			name:  "no English statement",
+			files: kattisFiles(kattisYAML, [2]string{"statement/problem.sv.md", "Addera."}),
+			want:  "package has no English statement",
+		},
+		{
+			name:  "invalid problem.yaml",
+			files: kattisFiles("name: [unclosed\n"),
+			want:  "invalid problem.yaml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ReadKattisPackage(openTestArchive(t, tt.files))
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
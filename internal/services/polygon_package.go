@@ -0,0 +1,307 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"encoding/xml"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// polygonProblem is the part of a Codeforces Polygon problem.xml the
+// importer reads
+type polygonProblem struct {
+	ShortName string `xml:"short-name,attr"`
+	Names     []struct {
+		Language string `xml:"language,attr"`
+		Value    string `xml:"value,attr"`
+	} `xml:"names>name"`
+	Judging struct {
+		InputFile  string           `xml:"input-file,attr"`
+		OutputFile string           `xml:"output-file,attr"`
+		Testsets   []polygonTestset `xml:"testset"`
+	} `xml:"judging"`
+	Assets struct {
+		Checker *struct {
+			Name string `xml:"name,attr"`
+		} `xml:"checker"`
+		Interactor *struct{}  `xml:"interactor"`
+		Validators []struct{} `xml:"validators>validator"`
+		Solutions  []struct{} `xml:"solutions>solution"`
+	} `xml:"assets"`
+}
+
+type polygonTestset struct {
+	Name          string `xml:"name,attr"`
+	TimeLimit     int    `xml:"time-limit"`
+	MemoryLimit   int64  `xml:"memory-limit"`
+	InputPattern  string `xml:"input-path-pattern"`
+	AnswerPattern string `xml:"answer-path-pattern"`
+	Tests         []struct {
+		Method string `xml:"method,attr"`
+		Sample bool   `xml:"sample,attr"`
+		Group  string `xml:"group,attr"`
+		Points string `xml:"points,attr"`
+	} `xml:"tests>test"`
+}
+
+// polygonCheckers maps the standard testlib checkers to the closest checker
+// of the judge. Their notes are reported when the match is not exact.
+var polygonCheckers = map[string]struct {
+	checker string
+	note    string
+}{
+	"std::wcmp.cpp":   {models.CheckerTokens, ""},
+	"std::ncmp.cpp":   {models.CheckerTokens, ""},
+	"std::hcmp.cpp":   {models.CheckerTokens, ""},
+	"std::fcmp.cpp":   {models.CheckerExact, ""},
+	"std::lcmp.cpp":   {models.CheckerTokens, "line breaks are no longer checked"},
+	"std::yesno.cpp":  {models.CheckerTokens, "the answer is now case-sensitive"},
+	"std::nyesno.cpp": {models.CheckerTokens, "the answers are now case-sensitive"},
+	"std::rcmp.cpp":   {models.CheckerFloatPrefix + "1.5e-6", ""},
+	"std::rcmp4.cpp":  {models.CheckerFloatPrefix + "1e-4", ""},
+	"std::rcmp6.cpp":  {models.CheckerFloatPrefix + "1e-6", ""},
+	"std::rcmp9.cpp":  {models.CheckerFloatPrefix + "1e-9", ""},
+}
+
+// polygonStatementSections are the statement parts put together into the
+// description, with the heading each gets
+var polygonStatementSections = []struct {
+	file    string
+	heading string
+}{
+	{"legend.tex", ""},
+	{"input.tex", "Input"},
+	{"output.tex", "Output"},
+	{"notes.tex", "Notes"},
+}
+
+// polygonImage matches an image included in a statement section
+var polygonImage = regexp.MustCompile(`\\includegraphics(?:\[[^\]]*\])?\{([^}]*)\}`)
+
+// ReadPolygonPackage converts a full Polygon package, with its tests
+// generated, into a problem. Features the judge has no equivalent for are
+// an error when they change verdicts, and a warning otherwise.
+func ReadPolygonPackage(archive *packageArchive) (*models.ProblemPackage, []string, error) {
+	content, err := archive.read("problem.xml")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var problem polygonProblem
+	if err := xml.Unmarshal([]byte(content), &problem); err != nil {
+		return nil, nil, fmt.Errorf("invalid problem.xml: %w", err)
+	}
+
+	var warnings []string
+
+	if problem.Assets.Interactor != nil {
+		return nil, nil, fmt.Errorf("interactive problems are not supported")
+	}
+	for _, file := range []string{problem.Judging.InputFile, problem.Judging.OutputFile} {
+		if file != "" && file != "stdin" && file != "stdout" {
+			return nil, nil, fmt.Errorf("file input and output is not supported: %s", file)
+		}
+	}
+
+	checker := models.CheckerExact
+	if problem.Assets.Checker != nil {
+		mapped, ok := polygonCheckers[problem.Assets.Checker.Name]
+		if !ok {
+			name := problem.Assets.Checker.Name
+			if name == "" {
+				name = "custom checker"
+			}
+			return nil, nil, fmt.Errorf("checker %s is not supported, only the standard testlib checkers are", name)
+		}
+		checker = mapped.checker
+		if mapped.note != "" {
+			warnings = append(warnings, fmt.Sprintf("checker %s is replaced by %s: %s",
+				problem.Assets.Checker.Name, checker, mapped.note))
+		}
+	}
+
+	var testset *polygonTestset
+	for i := range problem.Judging.Testsets {
+		if problem.Judging.Testsets[i].Name == "tests" {
+			testset = &problem.Judging.Testsets[i]
+		} else {
+			warnings = append(warnings, fmt.Sprintf("testset %s is not imported, only tests is", problem.Judging.Testsets[i].Name))
+		}
+	}
+	if testset == nil {
+		return nil, nil, fmt.Errorf("problem.xml has no testset named tests")
+	}
+
+	pkg := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title:         polygonTitle(&problem),
+			Difficulty:    models.DifficultyMedium,
+			TimeLimitMs:   testset.TimeLimit,
+			MemoryLimitMB: int(testset.MemoryLimit >> 20),
+			Checker:       checker,
+		},
+	}
+	warnings = append(warnings, "Polygon packages have no difficulty, it is set to "+models.DifficultyMedium)
+
+	description, attachments, statementWarnings, err := polygonStatement(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+	pkg.Problem.Description = description
+	pkg.Attachments = attachments
+	warnings = append(warnings, statementWarnings...)
+
+	scored := false
+	for i, test := range testset.Tests {
+		number := i + 1
+		inputName := fmt.Sprintf(testset.InputPattern, number)
+		answerName := fmt.Sprintf(testset.AnswerPattern, number)
+		if !archive.has(inputName) || !archive.has(answerName) {
+			return nil, nil, fmt.Errorf("test %d (%s) is missing, export a full package with generated tests", number, test.Method)
+		}
+
+		input, err := archive.read(inputName)
+		if err != nil {
+			return nil, nil, err
+		}
+		answer, err := archive.read(answerName)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pkg.TestCases = append(pkg.TestCases, models.TestCaseRequest{Input: input, ExpectedOutput: answer, Visible: test.Sample})
+		if test.Sample && pkg.Problem.SampleInput == "" {
+			pkg.Problem.SampleInput = input
+			pkg.Problem.SampleOutput = answer
+		}
+		if test.Group != "" || test.Points != "" {
+			scored = true
+		}
+	}
+
+	if scored {
+		warnings = append(warnings, "test groups and points are not supported, submissions must pass every test")
+	}
+	if len(problem.Assets.Validators) > 0 {
+		warnings = append(warnings, "input validators are not imported")
+	}
+	if len(problem.Assets.Solutions) > 0 {
+		warnings = append(warnings, "solutions are not imported")
+	}
+
+	return pkg, warnings, nil
+}
+
+// polygonTitle returns the English name of a problem, or any other if it has none
+func polygonTitle(problem *polygonProblem) string {
+	for _, name := range problem.Names {
+		if name.Language == "english" {
+			return name.Value
+		}
+	}
+	if len(problem.Names) > 0 {
+		return problem.Names[0].Value
+	}
+	return problem.ShortName
+}
+
+// polygonStatement builds a Markdown description from the statement sections
+// of one language, English if there is one. Images next to the sections
+// become attachments, and \includegraphics of one an image linking to it.
+// Other LaTeX inside the sections is kept as is, and reported.
+func polygonStatement(archive *packageArchive) (string, []models.AttachmentFile, []string, error) {
+	language := ""
+	for _, name := range archive.names {
+		if !strings.HasPrefix(name, "statement-sections/") || path.Base(name) != "legend.tex" {
+			continue
+		}
+		dir := path.Base(path.Dir(name))
+		if language == "" || dir == "english" {
+			language = dir
+		}
+	}
+	if language == "" {
+		return "", nil, nil, fmt.Errorf("package has no statement-sections, export it with statements")
+	}
+	dir := path.Join("statement-sections", language)
+
+	var attachments []models.AttachmentFile
+	var warnings []string
+	images := make(map[string]bool)
+	otherLanguages := make(map[string]bool)
+	for _, name := range archive.names {
+		rest, ok := strings.CutPrefix(name, "statement-sections/")
+		if !ok {
+			continue
+		}
+		if other, _, _ := strings.Cut(rest, "/"); other != language {
+			if !otherLanguages[other] {
+				otherLanguages[other] = true
+				warnings = append(warnings, "statement in "+other+" is not imported")
+			}
+			continue
+		}
+		if path.Dir(name) != dir {
+			warnings = append(warnings, "statement file is not imported: "+name)
+			continue
+		}
+
+		base := path.Base(name)
+		// The title comes from problem.xml, and the examples from the tests
+		if isPolygonStatementSection(base) || base == "name.tex" || strings.HasPrefix(base, "example.") {
+			continue
+		}
+		image, err := statementImage(archive, name)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		if image == nil || images[image.Name] {
+			warnings = append(warnings, "statement file is not imported: "+name)
+			continue
+		}
+		images[image.Name] = true
+		attachments = append(attachments, *image)
+	}
+
+	var sections []string
+	for _, section := range polygonStatementSections {
+		name := path.Join(dir, section.file)
+		if !archive.has(name) {
+			continue
+		}
+		text, err := archive.read(name)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		text = polygonImage.ReplaceAllStringFunc(text, func(match string) string {
+			image := polygonImage.FindStringSubmatch(match)[1]
+			if !images[image] {
+				return match
+			}
+			return "![" + image + "](" + image + ")"
+		})
+		if section.heading != "" {
+			text = "## " + section.heading + "\n\n" + text
+		}
+		sections = append(sections, text)
+	}
+
+	description := strings.Join(sections, "\n\n") + "\n"
+	warnings = append(warnings, latexMacroWarnings(description)...)
+	return description, attachments, warnings, nil
+}
+
+func isPolygonStatementSection(file string) bool {
+	for _, section := range polygonStatementSections {
+		if section.file == file {
+			return true
+		}
+	}
+	return false
+}
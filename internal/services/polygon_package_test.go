@@ -0,0 +1,227 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// openTestArchive opens a zip archive holding the given files, in order
+func openTestArchive(t *testing.T, files [][2]string) *packageArchive {
+	t.Helper()
+	data := zipFiles(t, files)
+	archive, err := openPackageArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return archive
+}
+
+const polygonXML = `<problem short-name="a-plus-b">
+  <names><name language="english" value="A plus B"/></names>
+  <judging input-file="" output-file="">
+    <testset name="tests">
+      <time-limit>1000</time-limit>
+      <memory-limit>268435456</memory-limit>
+      <input-path-pattern>tests/%02d</input-path-pattern>
+      <answer-path-pattern>tests/%02d.a</answer-path-pattern>
+      <tests>
+        <test method="manual" sample="true"/>
+        <test method="generated"/>
+      </tests>
+    </testset>
+  </judging>
+  <assets>
+    <checker name="std::ncmp.cpp"/>
+  </assets>
+</problem>`
+
+// polygonFiles is a package with the given problem.xml, two tests and the
+// statement files, or a one-line legend without any
+func polygonFiles(xml string, statement ...[2]string) [][2]string {
+	if len(statement) == 0 {
+		statement = [][2]string{{"statement-sections/english/legend.tex", "Add $a$ and $b$."}}
+	}
+	files := [][2]string{
+		{"problem.xml", xml},
+		{"tests/01", "1 2\n"},
+		{"tests/01.a", "3\n"},
+		{"tests/02", "10 20\n"},
+		{"tests/02.a", "30\n"},
+	}
+	return append(files, statement...)
+}
+
+func TestReadPolygonPackage(t *testing.T) {
+	archive := openTestArchive(t, polygonFiles(polygonXML,
+		[2]string{"statement-sections/english/legend.tex", "Add $a$ and $b$.\n\n\\includegraphics[width=5cm]{sum.png}\n"},
+		[2]string{"statement-sections/english/input.tex", "Two integers $a$ and $b$."},
+		[2]string{"statement-sections/english/output.tex", "Their sum."},
+		[2]string{"statement-sections/english/name.tex", "A plus B"},
+		[2]string{"statement-sections/english/example.01", "1 2\n"},
+		[2]string{"statement-sections/english/sum.png", string(pngData)},
+	))
+
+	got, warnings, err := ReadPolygonPackage(archive)
+	if err != nil {
+		t.Fatalf("ReadPolygonPackage: %v", err)
+	}
+
+	want := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title: "A plus B",
+			Description: "Add $a$ and $b$.\n\n![sum.png](sum.png)\n\n" +
+				"## Input\n\nTwo integers $a$ and $b$.\n\n## Output\n\nTheir sum.\n",
+			Difficulty:    models.DifficultyMedium,
+			SampleInput:   "1 2\n",
+			SampleOutput:  "3\n",
+			TimeLimitMs:   1000,
+			MemoryLimitMB: 256,
+			Checker:       models.CheckerTokens,
+		},
+		TestCases: []models.TestCaseRequest{
+			{Input: "1 2\n", ExpectedOutput: "3\n", Visible: true},
+			{Input: "10 20\n", ExpectedOutput: "30\n"},
+		},
+		Attachments: []models.AttachmentFile{
+			{Name: "sum.png", Data: pngData},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got package %+v\nwant %+v", got, want)
+	}
+
+	wantWarnings := []string{"Polygon packages have no difficulty, it is set to Medium"}
+	if !reflect.DeepEqual(warnings, wantWarnings) {
+		t.Errorf("got warnings %q, want %q", warnings, wantWarnings)
+	}
+}
+
+func TestReadPolygonPackageWarnings(t *testing.T) {
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  string
+	}{
+		{
+			name:  "checker differing slightly",
+			files: polygonFiles(strings.Replace(polygonXML, "std::ncmp.cpp", "std::yesno.cpp", 1)),
+			want:  "checker std::yesno.cpp is replaced by tokens: the answer is now case-sensitive",
+		},
+		{
+			name: "other testset",
+			files: polygonFiles(strings.Replace(polygonXML, "</judging>",
+				`<testset name="pretests"><tests/></testset></judging>`, 1)),
+			want: "testset pretests is not imported, only tests is",
+		},
+		{
+			name:  "scored tests",
+			files: polygonFiles(strings.Replace(polygonXML, `method="generated"`, `method="generated" points="10"`, 1)),
+			want:  "test groups and points are not supported, submissions must pass every test",
+		},
+		{
+			name:  "validators",
+			files: polygonFiles(strings.Replace(polygonXML, "</assets>", `<validators><validator/></validators></assets>`, 1)),
+			want:  "input validators are not imported",
+		},
+		{
+			name: "statement file other than an image",
+			files: polygonFiles(polygonXML,
+				[2]string{"statement-sections/english/legend.tex", "Add $a$ and $b$."},
+				[2]string{"statement-sections/english/tutorial.tex", "Use +."}),
+			want: "statement file is not imported: statement-sections/english/tutorial.tex",
+		},
+		{
+			name: "statement in another language",
+			files: polygonFiles(polygonXML,
+				[2]string{"statement-sections/english/legend.tex", "Add $a$ and $b$."},
+				[2]string{"statement-sections/russian/legend.tex", "Сложите $a$ и $b$."}),
+			want: "statement in russian is not imported",
+		},
+		{
+			name: "LaTeX commands outside formulas",
+			files: polygonFiles(polygonXML,
+				[2]string{"statement-sections/english/legend.tex", "Add \\textbf{two} numbers $\\frac{a}{1}$ and \\(b\\).\n\n\\begin{itemize}\\item Fast.\\end{itemize}"}),
+			want: "the statement uses LaTeX commands outside formulas, which are kept as is: \\textbf, \\begin, \\item, \\end",
+		},
+		{
+			name: "image that is not included",
+			files: polygonFiles(polygonXML,
+				[2]string{"statement-sections/english/legend.tex", "Add $a$ and $b$.\n\n\\includegraphics{graph.png}"}),
+			want: "the statement uses LaTeX commands outside formulas, which are kept as is: \\includegraphics",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, warnings, err := ReadPolygonPackage(openTestArchive(t, tt.files))
+			if err != nil {
+				t.Fatalf("ReadPolygonPackage: %v", err)
+			}
+			for _, warning := range warnings {
+				if warning == tt.want {
+					return
+				}
+			}
+			t.Errorf("got warnings %q, want one being %q", warnings, tt.want)
+		})
+	}
+}
+
+func TestReadPolygonPackageRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  string
+	}{
+		{
+			name:  "interactive problem",
+			files: polygonFiles(strings.Replace(polygonXML, "</assets>", "<interactor/></assets>", 1)),
+			want:  "interactive problems are not supported",
+		},
+		{
+			name:  "file input",
+			files: polygonFiles(strings.Replace(polygonXML, `input-file=""`, `input-file="input.txt"`, 1)),
+			want:  "file input and output is not supported: input.txt",
+		},
+		{
+			name:  "custom checker",
+			files: polygonFiles(strings.Replace(polygonXML, "std::ncmp.cpp", "check.cpp", 1)),
+			want:  "checker check.cpp is not supported",
+		},
+		{
+			name:  "no tests testset",
+			files: polygonFiles(strings.Replace(polygonXML, `name="tests"`, `name="pretests"`, 1)),
+			want:  "problem.xml has no testset named tests",
+		},
+		{
+			name:  "tests not generated",
+			files: append(polygonFiles(polygonXML)[:3], [2]string{"statement-sections/english/legend.tex", "Add."}),
+			want:  "test 2 (generated) is missing",
+		},
+		{
+			name:  "no statement",
+			files: polygonFiles(polygonXML, [2]string{"statements/english/problem.tex", "Add."}),
+			want:  "package has no statement-sections",
+		},
+		{
+			name:  "invalid problem.xml",
+			files: polygonFiles("<problem"),
+			want:  "invalid problem.xml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ReadPolygonPackage(openTestArchive(t, tt.files))
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
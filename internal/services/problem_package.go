@@ -0,0 +1,536 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A problem package is a zip file laid out as:
+//
+//	problem.yaml                     metadata, see problemManifest
+//	statement.md                     the problem description
+//	tests/01.in, tests/01.out, ...   test cases, numbered from 1
+//	attachments/<name>               images of the statement (version 2)
+//	languages/<name>/starter.<ext>   per-language code, each file optional
+//	languages/<name>/system.<ext>
+//	languages/<name>/imports.<ext>
+//
+// Languages are referred to by name, so packages stay valid between
+// deployments whatever the language IDs.
+
+// ProblemPackageFormatVersion is the version of the package layout written
+// by WriteProblemPackage. Packages of a newer version are rejected.
+// Version 2 added attachments.
+const ProblemPackageFormatVersion = 2
+
+// MaxProblemPackageContentSize bounds the uncompressed size of a package
+const MaxProblemPackageContentSize = 256 << 20
+
+const (
+	packageManifestFile   = "problem.yaml"
+	packageStatementFile  = "statement.md"
+	packageTestsDir       = "tests"
+	packageAttachmentsDir = "attachments"
+	packageLanguagesDir   = "languages"
+)
+
+// packageCodeFiles maps each kind of per-language code to its file name
+var packageCodeFiles = map[string]string{
+	models.ProblemCodeStarter: "starter",
+	models.ProblemCodeSystem:  "system",
+	models.ProblemCodeImports: "imports",
+}
+
+type problemManifest struct {
+	FormatVersion int      `yaml:"format_version"`
+	Title         string   `yaml:"title"`
+	Difficulty    string   `yaml:"difficulty"`
+	TimeLimitMs   int      `yaml:"time_limit_ms,omitempty"`
+	MemoryLimitMB int      `yaml:"memory_limit_mb,omitempty"`
+	Checker       string   `yaml:"checker"`
+	Tags          []string `yaml:"tags,omitempty"`
+	SampleInput   string   `yaml:"sample_input,omitempty"`
+	SampleOutput  string   `yaml:"sample_output,omitempty"`
+	// VisibleTests are the numbers of the tests shown to users failing them
+	VisibleTests []int `yaml:"visible_tests,omitempty"`
+}
+
+// WriteProblemPackage writes a problem as a zip package
+func WriteProblemPackage(w io.Writer, pkg *models.ProblemPackage) error {
+	zw := zip.NewWriter(w)
+
+	var visibleTests []int
+	for i, tc := range pkg.TestCases {
+		if tc.Visible {
+			visibleTests = append(visibleTests, i+1)
+		}
+	}
+
+	manifest, err := yaml.Marshal(problemManifest{
+		FormatVersion: ProblemPackageFormatVersion,
+		Title:         pkg.Problem.Title,
+		Difficulty:    pkg.Problem.Difficulty,
+		TimeLimitMs:   pkg.Problem.TimeLimitMs,
+		MemoryLimitMB: pkg.Problem.MemoryLimitMB,
+		Checker:       pkg.Problem.Checker,
+		Tags:          pkg.Tags,
+		SampleInput:   pkg.Problem.SampleInput,
+		SampleOutput:  pkg.Problem.SampleOutput,
+		VisibleTests:  visibleTests,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", packageManifestFile, err)
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{packageManifestFile, string(manifest)},
+		{packageStatementFile, pkg.Problem.Description},
+	}
+
+	// Tests are zero-padded so they sort in order in any archive tool
+	width := max(2, len(strconv.Itoa(len(pkg.TestCases))))
+	for i, tc := range pkg.TestCases {
+		base := fmt.Sprintf("%s/%0*d", packageTestsDir, width, i+1)
+		files = append(files,
+			struct{ name, content string }{base + ".in", tc.Input},
+			struct{ name, content string }{base + ".out", tc.ExpectedOutput})
+	}
+
+	for _, attachment := range pkg.Attachments {
+		files = append(files, struct{ name, content string }{
+			packageAttachmentsDir + "/" + attachment.Name, string(attachment.Data)})
+	}
+
+	code := append([]models.ProblemLanguageCode(nil), pkg.Code...)
+	sort.Slice(code, func(i, j int) bool { return code[i].LanguageID < code[j].LanguageID })
+	for _, languageCode := range code {
+		languageName, config, err := GetLanguageConfig(languageCode.LanguageID)
+		if err != nil {
+			return err
+		}
+		for _, kind := range []string{models.ProblemCodeStarter, models.ProblemCodeSystem, models.ProblemCodeImports} {
+			content := *problemCodeField(&languageCode, kind)
+			if content == nil {
+				continue
+			}
+			name := fmt.Sprintf("%s/%s/%s.%s", packageLanguagesDir, languageName, packageCodeFiles[kind], config.FileExtension)
+			files = append(files, struct{ name, content string }{name, *content})
+		}
+	}
+
+	for _, file := range files {
+		fw, err := zw.Create(file.name)
+		if err != nil {
+			return fmt.Errorf("failed to add %s to package: %w", file.name, err)
+		}
+		if _, err := io.WriteString(fw, file.content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish package: %w", err)
+	}
+	return nil
+}
+
+// Formats of the problem packages that can be imported
+const (
+	PackageFormatHAB     = "hab"
+	PackageFormatPolygon = "polygon"
+	PackageFormatKattis  = "kattis"
+)
+
+// ImportProblemPackage reads a zip package of any supported format. The
+// warnings list what of a Polygon or Kattis package could not be carried
+// over as is.
+func ImportProblemPackage(format string, r io.ReaderAt, size int64) (*models.ProblemPackage, []string, error) {
+	var read func(*packageArchive) (*models.ProblemPackage, []string, error)
+	switch format {
+	case "", PackageFormatHAB:
+		pkg, err := ReadProblemPackage(r, size)
+		return pkg, nil, err
+	case PackageFormatPolygon:
+		read = ReadPolygonPackage
+	case PackageFormatKattis:
+		read = ReadKattisPackage
+	default:
+		return nil, nil, fmt.Errorf("unknown package format: %s", format)
+	}
+
+	archive, err := openPackageArchive(r, size)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkg, warnings, err := read(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := pkg.Problem.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if len(pkg.TestCases) == 0 {
+		return nil, nil, errors.New("package has no tests")
+	}
+	for i := range pkg.TestCases {
+		if err := pkg.TestCases[i].Validate(); err != nil {
+			return nil, nil, fmt.Errorf("test %d: %w", i+1, err)
+		}
+	}
+
+	return pkg, warnings, nil
+}
+
+// ReadProblemPackage reads and validates a zip package in the format of
+// this judge, the one WriteProblemPackage writes. Unknown files are
+// an error rather than being skipped, so nothing of a package is dropped
+// without notice.
+func ReadProblemPackage(r io.ReaderAt, size int64) (*models.ProblemPackage, error) {
+	archive, err := openPackageArchive(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		manifest    *problemManifest
+		statement   *string
+		inputs      = make(map[int]string)
+		outputs     = make(map[int]string)
+		code        = make(map[int]*models.ProblemLanguageCode)
+		attached    = make(map[string]bool)
+		attachments []models.AttachmentFile
+	)
+
+	for _, name := range archive.names {
+		content, err := archive.read(name)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case name == packageManifestFile:
+			manifest = &problemManifest{}
+			if err := yaml.Unmarshal([]byte(content), manifest); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", packageManifestFile, err)
+			}
+
+		case name == packageStatementFile:
+			statement = &content
+
+		case path.Dir(name) == packageTestsDir:
+			number, ext, err := parseTestFileName(path.Base(name))
+			if err != nil {
+				return nil, err
+			}
+			target := inputs
+			if ext == "out" {
+				target = outputs
+			}
+			if _, exists := target[number]; exists {
+				return nil, fmt.Errorf("duplicate test file: %s", name)
+			}
+			target[number] = content
+
+		case path.Dir(name) == packageAttachmentsDir:
+			attachment := path.Base(name)
+			if err := models.ValidateAttachmentName(attachment); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if _, err := models.AttachmentContentType([]byte(content)); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+			if attached[attachment] {
+				return nil, fmt.Errorf("duplicate attachment: %s", name)
+			}
+			attached[attachment] = true
+			attachments = append(attachments, models.AttachmentFile{Name: attachment, Data: []byte(content)})
+
+		case path.Dir(path.Dir(name)) == packageLanguagesDir:
+			languageID, kind, err := parseCodeFileName(name)
+			if err != nil {
+				return nil, err
+			}
+			if code[languageID] == nil {
+				code[languageID] = &models.ProblemLanguageCode{LanguageID: languageID}
+			}
+			field := problemCodeField(code[languageID], kind)
+			if *field != nil {
+				return nil, fmt.Errorf("duplicate code file: %s", name)
+			}
+			*field = &content
+
+		default:
+			return nil, fmt.Errorf("unexpected file in package: %s", name)
+		}
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("package has no %s", packageManifestFile)
+	}
+	if statement == nil {
+		return nil, fmt.Errorf("package has no %s", packageStatementFile)
+	}
+	if manifest.FormatVersion <= 0 {
+		return nil, errors.New("format_version is missing from " + packageManifestFile)
+	}
+	if manifest.FormatVersion > ProblemPackageFormatVersion {
+		return nil, fmt.Errorf("unsupported package format version %d, at most %d is supported",
+			manifest.FormatVersion, ProblemPackageFormatVersion)
+	}
+
+	pkg := &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title:         manifest.Title,
+			Description:   *statement,
+			Difficulty:    manifest.Difficulty,
+			SampleInput:   manifest.SampleInput,
+			SampleOutput:  manifest.SampleOutput,
+			TimeLimitMs:   manifest.TimeLimitMs,
+			MemoryLimitMB: manifest.MemoryLimitMB,
+			Checker:       manifest.Checker,
+		},
+	}
+	if err := pkg.Problem.Validate(); err != nil {
+		return nil, err
+	}
+	tags, err := models.NormalizeTags(manifest.Tags)
+	if err != nil {
+		return nil, err
+	}
+	pkg.Tags = tags
+
+	testCases, err := pairTestFiles(inputs, outputs, manifest.VisibleTests)
+	if err != nil {
+		return nil, err
+	}
+	pkg.TestCases = testCases
+	pkg.Attachments = attachments
+
+	for _, languageCode := range code {
+		pkg.Code = append(pkg.Code, *languageCode)
+	}
+	sort.Slice(pkg.Code, func(i, j int) bool { return pkg.Code[i].LanguageID < pkg.Code[j].LanguageID })
+
+	return pkg, nil
+}
+
+// packageArchive reads the files of a zip package, bounding the total
+// uncompressed bytes read. Packages zipped with a single top-level
+// directory are read as if the directory was the root.
+type packageArchive struct {
+	names     []string
+	files     map[string]*zip.File
+	remaining int64
+}
+
+func openPackageArchive(r io.ReaderAt, size int64) (*packageArchive, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip file: %w", err)
+	}
+
+	archive := &packageArchive{
+		files:     make(map[string]*zip.File),
+		remaining: MaxProblemPackageContentSize,
+	}
+
+	topDir := ""
+	for i, file := range zr.File {
+		dir, _, nested := strings.Cut(file.Name, "/")
+		if !nested || (i > 0 && dir != topDir) {
+			topDir = ""
+			break
+		}
+		topDir = dir
+	}
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		name := file.Name
+		if topDir != "" {
+			name = strings.TrimPrefix(name, topDir+"/")
+		}
+		if _, exists := archive.files[name]; exists {
+			return nil, fmt.Errorf("duplicate file in package: %s", name)
+		}
+		archive.names = append(archive.names, name)
+		archive.files[name] = file
+	}
+
+	return archive, nil
+}
+
+// has reports whether the package contains a file
+func (a *packageArchive) has(name string) bool {
+	_, ok := a.files[name]
+	return ok
+}
+
+// read reads one file of the package, counting its size against the
+// uncompressed bytes the package may still hold
+func (a *packageArchive) read(name string) (string, error) {
+	file, ok := a.files[name]
+	if !ok {
+		return "", fmt.Errorf("package has no %s", name)
+	}
+
+	rc, err := file.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(io.LimitReader(rc, a.remaining+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if int64(len(data)) > a.remaining {
+		return "", fmt.Errorf("package content exceeds %d bytes", MaxProblemPackageContentSize)
+	}
+	a.remaining -= int64(len(data))
+
+	return string(data), nil
+}
+
+// statementImage reads an image of an imported statement as an attachment,
+// or returns nil for any other file
+func statementImage(archive *packageArchive, name string) (*models.AttachmentFile, error) {
+	base := path.Base(name)
+	if models.ValidateAttachmentName(base) != nil {
+		return nil, nil
+	}
+	content, err := archive.read(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := models.AttachmentContentType([]byte(content)); err != nil {
+		return nil, nil
+	}
+	return &models.AttachmentFile{Name: base, Data: []byte(content)}, nil
+}
+
+var (
+	// statementFormula matches the formulas of a statement, whose LaTeX
+	// is rendered
+	statementFormula = regexp.MustCompile(`(?s)\$\$.*?\$\$|\\\[.*?\\\]|\\\(.*?\\\)|\$[^$]*\$`)
+	latexCommand     = regexp.MustCompile(`\\[A-Za-z]+`)
+)
+
+// latexMacroWarnings reports the LaTeX commands of an imported statement
+// outside its formulas, which Markdown shows as text
+func latexMacroWarnings(statement string) []string {
+	seen := make(map[string]bool)
+	var macros []string
+	for _, macro := range latexCommand.FindAllString(statementFormula.ReplaceAllString(statement, ""), -1) {
+		if !seen[macro] {
+			seen[macro] = true
+			macros = append(macros, macro)
+		}
+	}
+	if len(macros) == 0 {
+		return nil
+	}
+	return []string{"the statement uses LaTeX commands outside formulas, which are kept as is: " + strings.Join(macros, ", ")}
+}
+
+// parseTestFileName parses a test file name such as 07.in into 7 and "in"
+func parseTestFileName(name string) (int, string, error) {
+	base, ext, ok := strings.Cut(name, ".")
+	if !ok || (ext != "in" && ext != "out") {
+		return 0, "", fmt.Errorf("test files must be named NN.in or NN.out: %s", name)
+	}
+	number, err := strconv.Atoi(base)
+	if err != nil || number <= 0 {
+		return 0, "", fmt.Errorf("test files must be named NN.in or NN.out: %s", name)
+	}
+	return number, ext, nil
+}
+
+// parseCodeFileName parses a path such as languages/go/starter.go into the
+// language ID and the kind of code
+func parseCodeFileName(name string) (int, string, error) {
+	languageName := path.Base(path.Dir(name))
+	languageID, err := GetLanguageID(languageName)
+	if err != nil {
+		return 0, "", fmt.Errorf("unsupported language in package: %s", languageName)
+	}
+	_, config, err := GetLanguageConfig(languageID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for kind, fileName := range packageCodeFiles {
+		if path.Base(name) == fileName+"."+config.FileExtension {
+			return languageID, kind, nil
+		}
+	}
+	return 0, "", fmt.Errorf("unexpected code file in package: %s", name)
+}
+
+// pairTestFiles joins test inputs and outputs by number, in order. Every
+// input needs its output and the other way around. The tests numbered in
+// visible are made visible.
+func pairTestFiles(inputs, outputs map[int]string, visible []int) ([]models.TestCaseRequest, error) {
+	numbers := make([]int, 0, len(inputs))
+	for number := range inputs {
+		if _, ok := outputs[number]; !ok {
+			return nil, fmt.Errorf("test %d has no .out file", number)
+		}
+		numbers = append(numbers, number)
+	}
+	for number := range outputs {
+		if _, ok := inputs[number]; !ok {
+			return nil, fmt.Errorf("test %d has no .in file", number)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil, errors.New("package has no tests")
+	}
+	sort.Ints(numbers)
+
+	visibleSet := make(map[int]bool, len(visible))
+	for _, number := range visible {
+		if _, ok := inputs[number]; !ok {
+			return nil, fmt.Errorf("visible_tests: there is no test %d", number)
+		}
+		visibleSet[number] = true
+	}
+
+	testCases := make([]models.TestCaseRequest, 0, len(numbers))
+	for _, number := range numbers {
+		tc := models.TestCaseRequest{Input: inputs[number], ExpectedOutput: outputs[number], Visible: visibleSet[number]}
+		if err := tc.Validate(); err != nil {
+			return nil, fmt.Errorf("test %d: %w", number, err)
+		}
+		testCases = append(testCases, tc)
+	}
+	return testCases, nil
+}
+
+func problemCodeField(code *models.ProblemLanguageCode, kind string) **string {
+	switch kind {
+	case models.ProblemCodeStarter:
+		return &code.StarterCode
+	case models.ProblemCodeSystem:
+		return &code.SystemCode
+	default:
+		return &code.Imports
+	}
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"archive/zip"
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pngData starts with the PNG signature, which is all content sniffing looks at
+var pngData = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func samplePackage() *models.ProblemPackage {
+	return &models.ProblemPackage{
+		Problem: models.ProblemRequest{
+			Title:         "Sum of Two",
+			Description:   "Add two numbers.\n\n![graph](graph.png)\n",
+			Difficulty:    models.DifficultyEasy,
+			SampleInput:   "1 2\n",
+			SampleOutput:  "3\n",
+			TimeLimitMs:   2000,
+			MemoryLimitMB: 128,
+			Checker:       "float:1e-6",
+		},
+		Tags: []string{"math"},
+		TestCases: []models.TestCaseRequest{
+			{Input: "1 2\n", ExpectedOutput: "3\n", Visible: true},
+			{Input: "10 20\n", ExpectedOutput: "30\n"},
+			{Input: "-1 1\n", ExpectedOutput: "0\n"},
+		},
+		Code: []models.ProblemLanguageCode{
+			{LanguageID: 1, StarterCode: stringPtr("def solve(a, b):\n    pass\n")},
+			{LanguageID: 2, SystemCode: stringPtr("package main\n"), Imports: stringPtr("import \"fmt\"\n")},
+		},
+		Attachments: []models.AttachmentFile{
+			{Name: "graph.png", Data: pngData},
+		},
+	}
+}
+
+// zipFiles builds a zip archive holding the given files, in order
+func zipFiles(t *testing.T, files [][2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range files {
+		fw, err := zw.Create(file[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(fw, file[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestProblemPackageRoundTrip(t *testing.T) {
+	want := samplePackage()
+
+	var buf bytes.Buffer
+	if err := WriteProblemPackage(&buf, want); err != nil {
+		t.Fatalf("WriteProblemPackage: %v", err)
+	}
+
+	got, err := ReadProblemPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("ReadProblemPackage: %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("package changed in the round trip\ngot:  %+v\nwant: %+v", got, want)
+	}
+}
+
+func TestReadProblemPackageRejects(t *testing.T) {
+	manifest := [2]string{packageManifestFile, "format_version: 2\ntitle: Sum\ndifficulty: Easy\n"}
+	statement := [2]string{packageStatementFile, "Add two numbers."}
+
+	tests := []struct {
+		name  string
+		files [][2]string
+		want  string
+	}{
+		{
+			name:  "unknown file",
+			files: [][2]string{manifest, statement, {"tests/01.in", "1"}, {"tests/01.out", "1"}, {"notes.txt", "hi"}},
+			want:  "unexpected file in package: notes.txt",
+		},
+		{
+			name:  "input without output",
+			files: [][2]string{manifest, statement, {"tests/01.in", "1"}, {"tests/01.out", "1"}, {"tests/02.in", "2"}},
+			want:  "test 2 has no .out file",
+		},
+		{
+			name:  "output without input",
+			files: [][2]string{manifest, statement, {"tests/01.out", "1"}},
+			want:  "test 1 has no .in file",
+		},
+		{
+			name:  "badly named test",
+			files: [][2]string{manifest, statement, {"tests/first.in", "1"}},
+			want:  "test files must be named NN.in or NN.out",
+		},
+		{
+			name:  "attachment that is not an image",
+			files: [][2]string{manifest, statement, {"tests/01.in", "1"}, {"tests/01.out", "1"}, {"attachments/graph.png", "not an image"}},
+			want:  "attachments must be PNG, JPEG, GIF or WebP images",
+		},
+		{
+			name:  "newer format version",
+			files: [][2]string{{packageManifestFile, "format_version: 99\ntitle: Sum\ndifficulty: Easy\n"}, statement},
+			want:  "unsupported package format version 99",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := zipFiles(t, tt.files)
+			_, err := ReadProblemPackage(bytes.NewReader(data), int64(len(data)))
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.want)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %q, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadProblemPackageRejectsOversizedContent(t *testing.T) {
+	// Zeros compress well, so the archive stays small while its content is too large
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	fw, err := zw.Create("tests/01.in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeros := io.LimitReader(zeroReader{}, MaxProblemPackageContentSize+1)
+	if _, err := io.Copy(fw, zeros); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ReadProblemPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err == nil || !strings.Contains(err.Error(), "package content exceeds") {
+		t.Fatalf("got error %v, want the content size to be rejected", err)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
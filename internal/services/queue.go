@@ -0,0 +1,434 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cancellationChannel is the pub/sub channel workers listen on for cancelled submissions
+const cancellationChannel = "submission_cancellations"
+
+// queueEntryTTL bounds how long the stream entry of a submission is remembered
+const queueEntryTTL = 24 * time.Hour
+
+const (
+	// judgeDurationsKey holds the most recent judge durations, newest first
+	judgeDurationsKey = "judge:durations"
+	judgeDurationsMax = 100
+	// positionScanLimit bounds how many entries of its own lane are counted
+	// to find a queue position; past it the position is a lower bound
+	positionScanLimit = 500
+)
+
+// Lane is a priority class of the submission queue. Each lane is backed by
+// its own Redis stream and workers always drain higher-priority lanes first.
+type Lane string
+
+const (
+	LaneContest     Lane = "contest"
+	LaneInteractive Lane = "interactive"
+	LaneNormal      Lane = "normal"
+	LaneRejudge     Lane = "rejudge"
+)
+
+// Lanes lists every lane from highest to lowest priority.
+var Lanes = []Lane{LaneContest, LaneInteractive, LaneNormal, LaneRejudge}
+
+func ParseLane(name string) (Lane, error) {
+	for _, lane := range Lanes {
+		if string(lane) == name {
+			return lane, nil
+		}
+	}
+	return "", fmt.Errorf("unknown queue lane: %s", name)
+}
+
+// UserSelectable reports whether a regular user may put a submission on this
+// lane. Contest and rejudge lanes are only assigned by the server.
+func (l Lane) UserSelectable() bool {
+	return l == LaneNormal || l == LaneInteractive
+}
+
+type SubmissionQueue struct {
+	rdb        *redis.Client
+	baseStream string
+	group      string
+}
+
+// NewSubmissionQueue creates a queue whose lanes are streams named after
+// baseStream, consumed by the given consumer group.
+func NewSubmissionQueue(rdb *redis.Client, baseStream, group string) *SubmissionQueue {
+	return &SubmissionQueue{
+		rdb:        rdb,
+		baseStream: baseStream,
+		group:      group,
+	}
+}
+
+// Group returns the consumer group workers read the lanes with
+func (q *SubmissionQueue) Group() string {
+	return q.group
+}
+
+// Stream returns the name of the Redis stream backing a lane. The normal lane
+// keeps the base stream name so jobs queued before lanes existed still run.
+func (q *SubmissionQueue) Stream(lane Lane) string {
+	if lane == LaneNormal {
+		return q.baseStream
+	}
+	return fmt.Sprintf("%s:%s", q.baseStream, lane)
+}
+
+// Streams returns the stream of every lane, ordered from highest to lowest priority.
+func (q *SubmissionQueue) Streams() []string {
+	streams := make([]string, len(Lanes))
+	for i, lane := range Lanes {
+		streams[i] = q.Stream(lane)
+	}
+	return streams
+}
+
+// LaneOf maps a stream name back to its lane.
+func (q *SubmissionQueue) LaneOf(stream string) Lane {
+	for _, lane := range Lanes {
+		if q.Stream(lane) == stream {
+			return lane
+		}
+	}
+	return LaneNormal
+}
+
+// Enqueue publishes a submission ID to the stream of the given lane and
+// returns the ID of the stream entry. The owner's user ID travels with the
+// job so workers can schedule fairly between users.
+func (q *SubmissionQueue) Enqueue(ctx context.Context, submissionID int, userID int, lane Lane) (string, error) {
+	return q.enqueue(ctx, submissionID, lane, map[string]interface{}{
+		"submission_id": submissionID,
+		"user_id":       userID,
+		"lane":          string(lane),
+	})
+}
+
+// EnqueueRejudge queues a submission again on the rejudge lane as part of a
+// rejudge batch, so the worker can record the new verdict against it.
+func (q *SubmissionQueue) EnqueueRejudge(ctx context.Context, submissionID int, userID int, rejudgeID int) (string, error) {
+	return q.enqueue(ctx, submissionID, LaneRejudge, map[string]interface{}{
+		"submission_id": submissionID,
+		"user_id":       userID,
+		"lane":          string(LaneRejudge),
+		"rejudge_id":    rejudgeID,
+	})
+}
+
+func (q *SubmissionQueue) enqueue(ctx context.Context, submissionID int, lane Lane, values map[string]interface{}) (string, error) {
+	stream := q.Stream(lane)
+	messageID, err := q.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		ID:     "*", // Auto-generate ID
+		Values: values,
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to enqueue submission %d on lane %s: %w", submissionID, lane, err)
+	}
+
+	// Remember where the job sits so it can be removed if the submission is cancelled
+	entry := stream + " " + messageID
+	if err := q.rdb.Set(ctx, queueEntryKey(submissionID), entry, queueEntryTTL).Err(); err != nil {
+		return "", fmt.Errorf("failed to record queue entry of submission %d: %w", submissionID, err)
+	}
+
+	return messageID, nil
+}
+
+// Remove deletes the job of a submission from its stream and reports whether
+// the entry still existed. A job that a worker already read keeps running
+// until the worker is told through PublishCancellation.
+func (q *SubmissionQueue) Remove(ctx context.Context, submissionID int) (bool, error) {
+	entry, err := q.rdb.Get(ctx, queueEntryKey(submissionID)).Result()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get queue entry of submission %d: %w", submissionID, err)
+	}
+
+	stream, messageID, ok := strings.Cut(entry, " ")
+	if !ok {
+		return false, fmt.Errorf("malformed queue entry of submission %d: %q", submissionID, entry)
+	}
+
+	deleted, err := q.rdb.XDel(ctx, stream, messageID).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove submission %d from queue: %w", submissionID, err)
+	}
+	_ = q.rdb.Del(ctx, queueEntryKey(submissionID)).Err()
+
+	return deleted > 0, nil
+}
+
+// PublishCancellation tells every worker pool that a submission was cancelled
+func (q *SubmissionQueue) PublishCancellation(ctx context.Context, submissionID int) error {
+	if err := q.rdb.Publish(ctx, cancellationChannel, submissionID).Err(); err != nil {
+		return fmt.Errorf("failed to publish cancellation of submission %d: %w", submissionID, err)
+	}
+	return nil
+}
+
+// SubscribeCancellations delivers the ID of every cancelled submission until
+// ctx is done.
+func (q *SubmissionQueue) SubscribeCancellations(ctx context.Context) <-chan int {
+	pubsub := q.rdb.Subscribe(ctx, cancellationChannel)
+	messages := pubsub.Channel()
+	ids := make(chan int)
+
+	go func() {
+		defer close(ids)
+		defer pubsub.Close()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				id, err := strconv.Atoi(msg.Payload)
+				if err != nil {
+					continue
+				}
+				select {
+				case ids <- id:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ids
+}
+
+// QueuePosition is where a queued submission waits
+type QueuePosition struct {
+	// Position counts the jobs picked up before the submission, itself included
+	Position int
+	// Approximate is set when more than positionScanLimit jobs are ahead in
+	// the submission's own lane, so Position is only a lower bound
+	Approximate bool
+}
+
+// Position returns how many jobs will be picked up before a queued
+// submission, including itself: every job of higher-priority lanes plus the
+// jobs ahead of it in its own lane. Finished jobs are deleted from their
+// stream, so a lane's length is its backlog. It reports false when the
+// submission is not waiting in the queue anymore.
+func (q *SubmissionQueue) Position(ctx context.Context, submissionID int) (QueuePosition, bool, error) {
+	stream, messageID, ok, err := q.entry(ctx, submissionID)
+	if err != nil || !ok {
+		return QueuePosition{}, false, err
+	}
+
+	pipe := q.rdb.Pipeline()
+	var higher []*redis.IntCmd
+	for _, laneStream := range q.Streams() {
+		if laneStream == stream {
+			break
+		}
+		higher = append(higher, pipe.XLen(ctx, laneStream))
+	}
+	own := pipe.XRangeN(ctx, stream, messageID, messageID, 1)
+	ahead := pipe.XRangeN(ctx, stream, "-", "("+messageID, positionScanLimit)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return QueuePosition{}, false, fmt.Errorf("failed to get queue position of submission %d: %w", submissionID, err)
+	}
+
+	if len(own.Val()) == 0 {
+		// Finished or removed
+		return QueuePosition{}, false, nil
+	}
+
+	position := QueuePosition{
+		Position:    len(ahead.Val()) + 1,
+		Approximate: len(ahead.Val()) == positionScanLimit,
+	}
+	for _, n := range higher {
+		position.Position += int(n.Val())
+	}
+	return position, true, nil
+}
+
+// Queued reports whether the job of a submission is still in its stream,
+// waiting for a worker or read ahead by a worker pool.
+func (q *SubmissionQueue) Queued(ctx context.Context, submissionID int) (bool, error) {
+	stream, messageID, ok, err := q.entry(ctx, submissionID)
+	if err != nil || !ok {
+		return false, err
+	}
+
+	entries, err := q.rdb.XRangeN(ctx, stream, messageID, messageID, 1).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to read queue entry of submission %d: %w", submissionID, err)
+	}
+	return len(entries) > 0, nil
+}
+
+// entry returns the stream and message ID of the last job queued for a
+// submission, and false when none is remembered.
+func (q *SubmissionQueue) entry(ctx context.Context, submissionID int) (string, string, bool, error) {
+	entry, err := q.rdb.Get(ctx, queueEntryKey(submissionID)).Result()
+	if err == redis.Nil {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to get queue entry of submission %d: %w", submissionID, err)
+	}
+
+	stream, messageID, ok := strings.Cut(entry, " ")
+	if !ok {
+		return "", "", false, fmt.Errorf("malformed queue entry of submission %d: %q", submissionID, entry)
+	}
+	return stream, messageID, true, nil
+}
+
+// RecordJudgeDuration remembers how long judging a submission took, to estimate waiting times
+func (q *SubmissionQueue) RecordJudgeDuration(ctx context.Context, duration time.Duration) error {
+	pipe := q.rdb.Pipeline()
+	pipe.LPush(ctx, judgeDurationsKey, duration.Milliseconds())
+	pipe.LTrim(ctx, judgeDurationsKey, 0, judgeDurationsMax-1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record judge duration: %w", err)
+	}
+	return nil
+}
+
+// AverageJudgeDuration returns the mean of the recently recorded judge
+// durations, or zero when none were recorded yet.
+func (q *SubmissionQueue) AverageJudgeDuration(ctx context.Context) (time.Duration, error) {
+	values, err := q.rdb.LRange(ctx, judgeDurationsKey, 0, -1).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get judge durations: %w", err)
+	}
+
+	var total, count int64
+	for _, value := range values {
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		total += ms
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	return time.Duration(total/count) * time.Millisecond, nil
+}
+
+// Backlog returns how many jobs are waiting across all lanes: the ones no
+// worker pool has read yet plus the ones read but not picked up by a worker.
+// Finished jobs are deleted from their stream, so this is the lanes' length.
+func (q *SubmissionQueue) Backlog(ctx context.Context) (int, error) {
+	pipe := q.rdb.Pipeline()
+	lengths := make([]*redis.IntCmd, 0, len(Lanes))
+	for _, stream := range q.Streams() {
+		lengths = append(lengths, pipe.XLen(ctx, stream))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to get queue backlog: %w", err)
+	}
+
+	backlog := 0
+	for _, n := range lengths {
+		backlog += int(n.Val())
+	}
+	return backlog, nil
+}
+
+// Ack marks a job as picked up by a worker and deletes it from its stream,
+// so lanes only hold jobs that are still waiting.
+func (q *SubmissionQueue) Ack(ctx context.Context, stream, messageID string) error {
+	pipe := q.rdb.Pipeline()
+	pipe.XAck(ctx, stream, q.group, messageID)
+	pipe.XDel(ctx, stream, messageID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge job %s on %s: %w", messageID, stream, err)
+	}
+	return nil
+}
+
+// TrimAcked deletes the jobs of a lane that were acknowledged without being
+// deleted, as they were before Ack deleted them: every entry older than
+// both the oldest pending job and the last one delivered to the group.
+func (q *SubmissionQueue) TrimAcked(ctx context.Context, stream string) error {
+	groups, err := q.rdb.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		if strings.Contains(err.Error(), "no such key") {
+			return nil
+		}
+		return fmt.Errorf("failed to get consumer groups of %s: %w", stream, err)
+	}
+
+	var minID string
+	for _, group := range groups {
+		if group.Name == q.group {
+			ms, seq := splitStreamID(group.LastDeliveredID)
+			minID = fmt.Sprintf("%d-%d", ms, seq+1)
+			break
+		}
+	}
+	if minID == "" {
+		return nil
+	}
+
+	pending, err := q.rdb.XPending(ctx, stream, q.group).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get pending jobs of %s: %w", stream, err)
+	}
+	if pending.Count > 0 && compareStreamIDs(pending.Lower, minID) < 0 {
+		minID = pending.Lower
+	}
+
+	if err := q.rdb.XTrimMinID(ctx, stream, minID).Err(); err != nil {
+		return fmt.Errorf("failed to trim acknowledged jobs of %s: %w", stream, err)
+	}
+	return nil
+}
+
+// compareStreamIDs compares two stream entry IDs of the form <ms>-<seq>
+func compareStreamIDs(a, b string) int {
+	aMs, aSeq := splitStreamID(a)
+	bMs, bSeq := splitStreamID(b)
+
+	switch {
+	case aMs != bMs:
+		if aMs < bMs {
+			return -1
+		}
+		return 1
+	case aSeq != bSeq:
+		if aSeq < bSeq {
+			return -1
+		}
+		return 1
+	default:
+		return 0
+	}
+}
+
+func splitStreamID(id string) (uint64, uint64) {
+	msPart, seqPart, _ := strings.Cut(id, "-")
+	ms, _ := strconv.ParseUint(msPart, 10, 64)
+	seq, _ := strconv.ParseUint(seqPart, 10, 64)
+	return ms, seq
+}
+
+func queueEntryKey(submissionID int) string {
+	return fmt.Sprintf("submission:%d:queue_entry", submissionID)
+}
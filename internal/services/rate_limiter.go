@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript refills the bucket for the time elapsed since its last
+// use and takes one token if available. It returns whether the request is
+// allowed and, if not, how many milliseconds until the next token.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(bucket[1]) or capacity
+local ts = tonumber(bucket[2]) or now
+
+tokens = math.min(capacity, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local wait = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate))
+
+return {allowed, wait}
+`)
+
+// RateLimiter is a token bucket per key stored in Redis, so that the limit
+// holds across every API instance.
+type RateLimiter struct {
+	rdb      *redis.Client
+	prefix   string
+	capacity int
+	rate     float64 // tokens per millisecond
+}
+
+// NewRateLimiter allows burst requests at once per key, refilled at
+// perMinute requests per minute.
+func NewRateLimiter(rdb *redis.Client, prefix string, perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		perMinute = 1
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rdb:      rdb,
+		prefix:   prefix,
+		capacity: burst,
+		rate:     float64(perMinute) / float64(time.Minute.Milliseconds()),
+	}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it
+// returns false and how long to wait for the next token.
+func (l *RateLimiter) Allow(ctx context.Context, key string) (bool, time.Duration, error) {
+	result, err := tokenBucketScript.Run(ctx, l.rdb,
+		[]string{fmt.Sprintf("ratelimit:%s:%s", l.prefix, key)},
+		l.capacity, l.rate, time.Now().UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit result: %v", result)
+	}
+
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxProgramOutputSize bounds what a sandboxed program may print, so a
+// runaway generator cannot exhaust the server's memory
+const MaxProgramOutputSize = 64 << 20
+
+// Sandbox keeps a program compiled in its container, to run it many times
+// outside of judging, e.g. a test generator or a reference solution
+type Sandbox struct {
+	dir         string
+	containerID string
+	runCommand  []string
+	timeLimit   time.Duration
+	killed      bool
+}
+
+// StartSandbox compiles a program and starts its container. Each run is
+// limited to timeLimit, and the container to memoryLimitMB. The sandbox must
+// be closed.
+func (s *CodeRunnerService) StartSandbox(ctx context.Context, languageName, sourceCode string,
+	timeLimit time.Duration, memoryLimitMB int) (*Sandbox, error) {
+	langConfig, ok := languageConfigs[languageName]
+	if !ok {
+		return nil, fmt.Errorf("unsupported language: %s", languageName)
+	}
+
+	dir, err := os.MkdirTemp(s.workDir, "program_")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create execution directory: %w", err)
+	}
+
+	codeFilePath := filepath.Join(dir, fmt.Sprintf("main.%s", langConfig.FileExtension))
+	if err := os.WriteFile(codeFilePath, []byte(sourceCode), 0644); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to write code file: %w", err)
+	}
+
+	containerID, err := s.startContainer(ctx, codeFilePath, languageName, memoryLimitMB)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	return &Sandbox{
+		dir:         dir,
+		containerID: containerID,
+		runCommand:  langConfig.RunCommand,
+		timeLimit:   timeLimit,
+	}, nil
+}
+
+// Run runs the program with args and stdin, returning what it printed.
+// A run that fails, exceeds a limit or prints too much is an error.
+func (b *Sandbox) Run(ctx context.Context, args []string, stdin string) (string, error) {
+	runCtx, cancel := context.WithTimeout(ctx, b.timeLimit)
+	defer cancel()
+
+	cmdArgs := append([]string{"exec", "-i", b.containerID}, b.runCommand...)
+	cmd := exec.CommandContext(runCtx, "docker", append(cmdArgs, args...)...)
+	cmd.WaitDelay = time.Second
+
+	stdout := &cappedBuffer{limit: MaxProgramOutputSize}
+	var stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if err != nil && ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+		b.killed = true
+		return "", fmt.Errorf("time limit of %v exceeded", b.timeLimit)
+	}
+	if stdout.exceeded {
+		return "", fmt.Errorf("output exceeds %d bytes", MaxProgramOutputSize)
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 137 {
+		b.killed = true
+		return "", fmt.Errorf("memory limit exceeded")
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v, stderr: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.String(), nil
+}
+
+// Close stops the container and removes the program
+func (b *Sandbox) Close() {
+	stopContainer(context.Background(), b.containerID, b.killed)
+	os.RemoveAll(b.dir)
+}
+
+// cappedBuffer keeps up to limit bytes, failing writes beyond it
+type cappedBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (w *cappedBuffer) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		w.exceeded = true
+		return 0, errors.New("output limit exceeded")
+	}
+	return w.Buffer.Write(p)
+}
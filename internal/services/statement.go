@@ -0,0 +1,193 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"bytes"
+	"fmt"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Statements are GitHub-flavoured Markdown with math. Formulas are kept
+// verbatim, delimiters included, in a <span class="math-inline"> or
+// <span class="math-display">, for KaTeX to render in the browser. These
+// delimiters are recognised, as KaTeX's auto-render does:
+//
+//	$...$  \(...\)     inline
+//	$$...$$  \[...\]   display, may span lines
+//
+// A single $ opens a formula only when followed by a non-space, and closes
+// one only when preceded by a non-space and not followed by a digit, so
+// prices like "$5 and $10" stay text. \$ is a literal dollar.
+//
+// Images naming an attachment, like ![graph](graph.png), link to the
+// attachment. Raw HTML is allowed, and the result is sanitized.
+
+var statementMarkdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(
+		parser.WithInlineParsers(util.Prioritized(mathParser{}, 100)),
+		parser.WithASTTransformers(util.Prioritized(attachmentLinker{}, 100)),
+	),
+	goldmark.WithRendererOptions(
+		html.WithUnsafe(), // raw HTML is left to the sanitizer
+		renderer.WithNodeRenderers(util.Prioritized(mathRenderer{}, 100)),
+	),
+)
+
+var statementPolicy = func() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^math-(inline|display)$`)).OnElements("span")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[A-Za-z0-9+#-]+$`)).OnElements("code")
+	return p
+}()
+
+var attachmentBaseKey = parser.NewContextKey()
+
+// AttachmentURL is where an attachment of a problem is served
+func AttachmentURL(problemID int, name string) string {
+	return fmt.Sprintf("/problems/%d/attachments/%s", problemID, name)
+}
+
+// RenderStatement renders the Markdown statement of a problem to sanitized
+// HTML, safe to put in a page as is
+func RenderStatement(problemID int, markdown string) (string, error) {
+	ctx := parser.NewContext()
+	ctx.Set(attachmentBaseKey, AttachmentURL(problemID, ""))
+
+	var buf bytes.Buffer
+	if err := statementMarkdown.Convert([]byte(markdown), &buf, parser.WithContext(ctx)); err != nil {
+		return "", fmt.Errorf("failed to render statement: %w", err)
+	}
+	return statementPolicy.Sanitize(buf.String()), nil
+}
+
+var kindMath = ast.NewNodeKind("Math")
+
+// mathNode is a formula, kept with its delimiters
+type mathNode struct {
+	ast.BaseInline
+	formula []byte
+	display bool
+}
+
+func (n *mathNode) Kind() ast.NodeKind {
+	return kindMath
+}
+
+func (n *mathNode) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Formula": string(n.formula)}, nil)
+}
+
+// mathParser reads formulas before Markdown can take their underscores,
+// asterisks and backslashes for emphasis and escapes. Code spans and
+// blocks come first, so formulas are not looked for inside them.
+type mathParser struct{}
+
+func (mathParser) Trigger() []byte {
+	return []byte{'$', '\\'}
+}
+
+func (mathParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+
+	var opener, closer string
+	display := false
+	switch {
+	case bytes.HasPrefix(line, []byte("$$")):
+		opener, closer, display = "$$", "$$", true
+	case bytes.HasPrefix(line, []byte(`\[`)):
+		opener, closer, display = `\[`, `\]`, true
+	case bytes.HasPrefix(line, []byte(`\(`)):
+		opener, closer = `\(`, `\)`
+	case line[0] == '$':
+		return parseDollarMath(block, line)
+	default:
+		return nil
+	}
+
+	// The parser restores the position when no formula is returned
+	formula := []byte(opener)
+	rest := line[len(opener):]
+	block.Advance(len(opener))
+	for {
+		if end := bytes.Index(rest, []byte(closer)); end >= 0 {
+			formula = append(formula, rest[:end+len(closer)]...)
+			block.Advance(end + len(closer))
+			return &mathNode{formula: formula, display: display}
+		}
+		formula = append(formula, rest...)
+		block.AdvanceLine()
+		if rest, _ = block.PeekLine(); rest == nil {
+			return nil
+		}
+	}
+}
+
+// parseDollarMath reads an inline formula between single dollars, on one line
+func parseDollarMath(block text.Reader, line []byte) ast.Node {
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++
+		case line[i] == '$' && !util.IsSpace(line[i-1]) && (i+1 == len(line) || !isDigit(line[i+1])):
+			block.Advance(i + 1)
+			return &mathNode{formula: append([]byte(nil), line[:i+1]...)}
+		}
+	}
+	return nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+type mathRenderer struct{}
+
+func (mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindMath, renderMath)
+}
+
+func renderMath(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathNode)
+	class := "math-inline"
+	if n.display {
+		class = "math-display"
+	}
+	_, _ = w.WriteString(`<span class="` + class + `">`)
+	_, _ = w.Write(util.EscapeHTML(n.formula))
+	_, _ = w.WriteString("</span>")
+	return ast.WalkSkipChildren, nil
+}
+
+// attachmentLinker points images naming an attachment to its URL
+type attachmentLinker struct{}
+
+func (attachmentLinker) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	base, ok := pc.Get(attachmentBaseKey).(string)
+	if !ok {
+		return
+	}
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := node.(*ast.Image); ok && entering &&
+			models.ValidateAttachmentName(string(image.Destination)) == nil {
+			image.Destination = append([]byte(base), image.Destination...)
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"HAB/internal/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// testGenerationJobTTL is how long the status of a job can be polled
+	testGenerationJobTTL = 24 * time.Hour
+
+	testGenerationStream = "test_generations"
+	testGenerationGroup  = "generators"
+
+	// A running job not saved for this long lost its worker
+	generationOwnerTimeout = 6 * models.GenerationHeartbeat
+)
+
+// TestGenerationTask is a job handed to a worker, with what it was asked to do
+type TestGenerationTask struct {
+	MessageID    string
+	Job          *models.TestGenerationJob
+	Script       string
+	KeepExisting bool
+}
+
+// TestGenerationJobs queues test generation jobs on a Redis stream, for
+// the workers to run like they judge submissions, and keeps their status
+// in Redis so any API instance can report on them.
+type TestGenerationJobs struct {
+	rdb *redis.Client
+}
+
+func NewTestGenerationJobs(rdb *redis.Client) *TestGenerationJobs {
+	return &TestGenerationJobs{rdb: rdb}
+}
+
+// Start queues a new job generating tests for a problem from a script. A
+// problem runs one job at a time, until it finishes or its timeout passes.
+func (j *TestGenerationJobs) Start(ctx context.Context, problemID int, total int, script string, keepExisting bool) (*models.TestGenerationJob, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to create job ID: %w", err)
+	}
+
+	job := &models.TestGenerationJob{
+		ID:        hex.EncodeToString(id),
+		ProblemID: problemID,
+		Status:    models.GenerationQueued,
+		Total:     total,
+		CreatedAt: time.Now(),
+	}
+
+	// The lock also covers the time the job waits in the queue
+	started, err := j.rdb.SetNX(ctx, runningGenerationKey(problemID), job.ID, 2*models.TestGenerationTimeout).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start test generation: %w", err)
+	}
+	if !started {
+		return nil, fmt.Errorf("problem %d already has a test generation running", problemID)
+	}
+
+	err = j.Save(ctx, job)
+	if err == nil {
+		err = j.rdb.XAdd(ctx, &redis.XAddArgs{
+			Stream: testGenerationStream,
+			Values: map[string]interface{}{
+				"job_id":        job.ID,
+				"script":        script,
+				"keep_existing": strconv.FormatBool(keepExisting),
+			},
+		}).Err()
+		if err != nil {
+			err = fmt.Errorf("failed to queue test generation job %s: %w", job.ID, err)
+		}
+	}
+	if err != nil {
+		_ = j.rdb.Del(ctx, runningGenerationKey(problemID)).Err()
+		return nil, err
+	}
+	return job, nil
+}
+
+// CreateGroup creates the consumer group the workers read jobs through
+func (j *TestGenerationJobs) CreateGroup(ctx context.Context) error {
+	// From the start of the stream, so jobs queued before the group existed run
+	err := j.rdb.XGroupCreateMkStream(ctx, testGenerationStream, testGenerationGroup, "0").Err()
+	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+		return fmt.Errorf("failed to create consumer group on %s: %w", testGenerationStream, err)
+	}
+	return nil
+}
+
+// Next waits up to block for a job and marks it running by worker. It
+// returns nil when no job came.
+func (j *TestGenerationJobs) Next(ctx context.Context, worker string, block time.Duration) (*TestGenerationTask, error) {
+	streams, err := j.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    testGenerationGroup,
+		Consumer: worker,
+		Streams:  []string{testGenerationStream, ">"},
+		Count:    1,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read test generation jobs: %w", err)
+	}
+
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			jobID, _ := message.Values["job_id"].(string)
+			job, err := j.load(ctx, jobID)
+			if err != nil {
+				return nil, err
+			}
+			if job == nil {
+				// Expired while queued, there is nobody to report to
+				return nil, j.ack(ctx, message.ID)
+			}
+
+			now := time.Now()
+			job.Status = models.GenerationRunning
+			job.Worker = worker
+			job.StartedAt = &now
+			if err := j.Save(ctx, job); err != nil {
+				return nil, err
+			}
+
+			script, _ := message.Values["script"].(string)
+			keepExisting, _ := message.Values["keep_existing"].(string)
+			return &TestGenerationTask{
+				MessageID:    message.ID,
+				Job:          job,
+				Script:       script,
+				KeepExisting: keepExisting == "true",
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// Save records the progress of a job
+func (j *TestGenerationJobs) Save(ctx context.Context, job *models.TestGenerationJob) error {
+	job.UpdatedAt = time.Now()
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode test generation job: %w", err)
+	}
+	if err := j.rdb.Set(ctx, generationJobKey(job.ID), data, testGenerationJobTTL).Err(); err != nil {
+		return fmt.Errorf("failed to save test generation job %s: %w", job.ID, err)
+	}
+	return nil
+}
+
+// Finish records the outcome of a job, lets the problem run another one
+// and removes the job from the queue
+func (j *TestGenerationJobs) Finish(ctx context.Context, task *TestGenerationTask) error {
+	job := task.Job
+	now := time.Now()
+	job.FinishedAt = &now
+	if err := j.Save(ctx, job); err != nil {
+		return err
+	}
+	if err := j.release(ctx, job); err != nil {
+		return err
+	}
+	return j.ack(ctx, task.MessageID)
+}
+
+// FailOrphaned fails the jobs whose worker is gone, having stopped saving
+// them, and returns how many there were. They are not run again: a
+// generation that killed its worker would likely do it again.
+func (j *TestGenerationJobs) FailOrphaned(ctx context.Context) (int, error) {
+	pending, err := j.rdb.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: testGenerationStream,
+		Group:  testGenerationGroup,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+		Idle:   generationOwnerTimeout,
+	}).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list running test generation jobs: %w", err)
+	}
+
+	failed := 0
+	for _, entry := range pending {
+		messages, err := j.rdb.XRangeN(ctx, testGenerationStream, entry.ID, entry.ID, 1).Result()
+		if err != nil {
+			return failed, fmt.Errorf("failed to read test generation job: %w", err)
+		}
+		if len(messages) == 0 {
+			continue
+		}
+		jobID, _ := messages[0].Values["job_id"].(string)
+		job, err := j.load(ctx, jobID)
+		if err != nil {
+			return failed, err
+		}
+		if job != nil && job.FinishedAt == nil && time.Since(job.UpdatedAt) < generationOwnerTimeout {
+			continue
+		}
+
+		task := &TestGenerationTask{MessageID: entry.ID, Job: job}
+		if job == nil {
+			err = j.ack(ctx, entry.ID)
+		} else if job.FinishedAt != nil {
+			// Finished, but the worker died before removing it from the queue
+			err = j.Finish(ctx, task)
+		} else {
+			job.Status = models.GenerationFailed
+			job.Error = "Test generation was interrupted: the worker running it stopped"
+			err = j.Finish(ctx, task)
+			failed++
+		}
+		if err != nil {
+			return failed, err
+		}
+	}
+	return failed, nil
+}
+
+// Get returns a job of a problem
+func (j *TestGenerationJobs) Get(ctx context.Context, problemID int, id string) (*models.TestGenerationJob, error) {
+	job, err := j.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.ProblemID != problemID {
+		return nil, fmt.Errorf("test generation job not found: %s", id)
+	}
+	return job, nil
+}
+
+// load returns a job, or nil once it expired
+func (j *TestGenerationJobs) load(ctx context.Context, id string) (*models.TestGenerationJob, error) {
+	data, err := j.rdb.Get(ctx, generationJobKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get test generation job %s: %w", id, err)
+	}
+
+	var job models.TestGenerationJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode test generation job %s: %w", id, err)
+	}
+	return &job, nil
+}
+
+// release lets the problem of a job run another one
+func (j *TestGenerationJobs) release(ctx context.Context, job *models.TestGenerationJob) error {
+	running, err := j.rdb.Get(ctx, runningGenerationKey(job.ProblemID)).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to get running test generation: %w", err)
+	}
+	if running == job.ID {
+		if err := j.rdb.Del(ctx, runningGenerationKey(job.ProblemID)).Err(); err != nil {
+			return fmt.Errorf("failed to release test generation of problem %d: %w", job.ProblemID, err)
+		}
+	}
+	return nil
+}
+
+func (j *TestGenerationJobs) ack(ctx context.Context, messageID string) error {
+	pipe := j.rdb.TxPipeline()
+	pipe.XAck(ctx, testGenerationStream, testGenerationGroup, messageID)
+	pipe.XDel(ctx, testGenerationStream, messageID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to acknowledge test generation job: %w", err)
+	}
+	return nil
+}
+
+// runningGenerationKey holds the job a problem runs. It is kept out of the
+// problem:<id>:* keys, which problem writes drop from the cache.
+func runningGenerationKey(problemID int) string {
+	return fmt.Sprintf("test_generation:problem:%d", problemID)
+}
+
+func generationJobKey(id string) string {
+	return fmt.Sprintf("test_generation:job:%s", id)
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// GenerationError is a failure of one of a problem's programs while
+// generating tests, for the problem's author to fix
+type GenerationError struct {
+	Line    int // of the generator script, 0 when not tied to one
+	Program string
+	Err     error
+}
+
+func (e *GenerationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %v", e.Line, e.Program, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Program, e.Err)
+}
+
+func (e *GenerationError) Unwrap() error {
+	return e.Err
+}
+
+// TestGenerator produces tests from a problem's programs, in the sandbox
+type TestGenerator struct {
+	runner *CodeRunnerService
+}
+
+func NewTestGenerator(runner *CodeRunnerService) *TestGenerator {
+	return &TestGenerator{runner: runner}
+}
+
+// Generate runs each command's generator to get an input, checks it with
+// the validator if the problem has one, and runs the reference solution on
+// it for the expected output. The solution runs with the problem's limits,
+// so a solution too slow for its own problem is an error. Each test is
+// handed to emit as soon as it is generated, in order, so it need not be
+// kept in memory; an error from emit stops generation.
+func (g *TestGenerator) Generate(ctx context.Context, programs []models.ProblemProgram,
+	commands []models.GeneratorCommand, settings models.JudgeSettings, emit func(models.TestCaseRequest) error) error {
+	byName := make(map[string]models.ProblemProgram, len(programs))
+	var solution, validator *models.ProblemProgram
+	for i := range programs {
+		byName[programs[i].Name] = programs[i]
+		switch programs[i].Kind {
+		case models.ProgramSolution:
+			solution = &programs[i]
+		case models.ProgramValidator:
+			validator = &programs[i]
+		}
+	}
+	if solution == nil {
+		return &GenerationError{Program: models.ProgramSolution, Err: fmt.Errorf("the problem has no reference solution")}
+	}
+
+	generatorLimit := models.GeneratorTimeLimitMs * time.Millisecond
+	solutionLimit := time.Duration(settings.TimeLimitMs) * time.Millisecond
+	if solutionLimit <= 0 {
+		solutionLimit = models.DefaultTimeLimitMs * time.Millisecond
+	}
+
+	sandboxes := make(map[string]*Sandbox)
+	defer func() {
+		for _, sandbox := range sandboxes {
+			sandbox.Close()
+		}
+	}()
+
+	start := func(program models.ProblemProgram, line int, timeLimit time.Duration) (*Sandbox, error) {
+		if sandbox, ok := sandboxes[program.Name]; ok {
+			return sandbox, nil
+		}
+
+		languageName, _, err := GetLanguageConfig(program.LanguageID)
+		if err != nil {
+			return nil, &GenerationError{Line: line, Program: program.Name, Err: err}
+		}
+		sandbox, err := g.runner.StartSandbox(ctx, languageName, program.SourceCode, timeLimit, settings.MemoryLimitMB)
+		if err != nil {
+			if strings.HasPrefix(err.Error(), "compilation error") {
+				return nil, &GenerationError{Line: line, Program: program.Name, Err: err}
+			}
+			return nil, err
+		}
+
+		sandboxes[program.Name] = sandbox
+		return sandbox, nil
+	}
+
+	solutionBox, err := start(*solution, 0, solutionLimit)
+	if err != nil {
+		return err
+	}
+	var validatorBox *Sandbox
+	if validator != nil {
+		if validatorBox, err = start(*validator, 0, generatorLimit); err != nil {
+			return err
+		}
+	}
+
+	for _, command := range commands {
+		generator, ok := byName[command.Generator]
+		if !ok || generator.Kind != models.ProgramGenerator {
+			return &GenerationError{Line: command.Line, Program: command.Generator, Err: fmt.Errorf("no such generator")}
+		}
+
+		generatorBox, err := start(generator, command.Line, generatorLimit)
+		if err != nil {
+			return err
+		}
+
+		input, err := generatorBox.Run(ctx, command.Args, "")
+		if err != nil {
+			return g.runError(ctx, command.Line, generator.Name, err)
+		}
+
+		if validatorBox != nil {
+			if _, err := validatorBox.Run(ctx, nil, input); err != nil {
+				return g.runError(ctx, command.Line, validator.Name, fmt.Errorf("input rejected: %w", err))
+			}
+		}
+
+		output, err := solutionBox.Run(ctx, nil, input)
+		if err != nil {
+			return g.runError(ctx, command.Line, solution.Name, err)
+		}
+
+		if err := emit(models.TestCaseRequest{Input: input, ExpectedOutput: output}); err != nil {
+			return err
+		}
+
+		logger.Log.Debug("Generated test case",
+			zap.Int("line", command.Line),
+			zap.String("generator", generator.Name),
+			zap.Int("input_size", len(input)))
+	}
+
+	return nil
+}
+
+// runError reports a failed run as the program's fault, unless generation
+// was cancelled
+func (g *TestGenerator) runError(ctx context.Context, line int, program string, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("test generation cancelled: %w", ctx.Err())
+	}
+	return &GenerationError{Line: line, Program: program, Err: err}
+}
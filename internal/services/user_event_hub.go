@@ -0,0 +1,165 @@
+package services
+
+import (
+	"HAB/internal/logger"
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// userEventBuffer is how many events a live connection may fall behind
+// before its subscription is dropped
+const userEventBuffer = 64
+
+var streamIDPattern = regexp.MustCompile(`^[0-9]{1,20}(-[0-9]{1,20})?$`)
+
+// ValidStreamID reports whether id is a Redis stream ID, such as a
+// last_event_id sent by a client
+func ValidStreamID(id string) bool {
+	return streamIDPattern.MatchString(id)
+}
+
+// StreamIDAfter reports whether the stream ID id comes after lastID
+func StreamIDAfter(id, lastID string) bool {
+	return compareStreamIDs(id, lastID) > 0
+}
+
+// UserEventHub fans the live events of users out to the connections of
+// this instance. It holds a single pub/sub connection however many
+// connections follow events, so live clients never take connections from
+// the shared Redis pool.
+type UserEventHub struct {
+	rdb *redis.Client
+
+	mu          sync.Mutex
+	subscribers map[int]map[*UserEventSubscription]struct{}
+	stopped     bool
+}
+
+// UserEventSubscription delivers the live events of one user. Events is
+// closed when the subscriber falls too far behind, or the hub stops; the
+// subscriber then catches up from the user's stream.
+type UserEventSubscription struct {
+	Events <-chan UserEvent
+	events chan UserEvent
+	userID int
+	hub    *UserEventHub
+}
+
+func NewUserEventHub(rdb *redis.Client) *UserEventHub {
+	return &UserEventHub{
+		rdb:         rdb,
+		subscribers: make(map[int]map[*UserEventSubscription]struct{}),
+	}
+}
+
+// Start subscribes to the live channels of every user, and delivers their
+// events until ctx is done. The subscription is active once Start returns.
+func (h *UserEventHub) Start(ctx context.Context) error {
+	pubsub := h.rdb.PSubscribe(ctx, userLiveChannelPattern)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return err
+	}
+
+	go func() {
+		defer pubsub.Close()
+		defer h.closeAll()
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				h.deliver(msg)
+			}
+		}
+	}()
+	return nil
+}
+
+// Subscribe follows the live events of a user. The subscription must be closed.
+func (h *UserEventHub) Subscribe(userID int) *UserEventSubscription {
+	events := make(chan UserEvent, userEventBuffer)
+	sub := &UserEventSubscription{Events: events, events: events, userID: userID, hub: h}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		// Nothing is delivered any more; the caller stops with the server
+		return sub
+	}
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[*UserEventSubscription]struct{})
+	}
+	h.subscribers[userID][sub] = struct{}{}
+	return sub
+}
+
+// Close stops the subscription
+func (s *UserEventSubscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+func (h *UserEventHub) deliver(msg *redis.Message) {
+	userIDStr := strings.TrimSuffix(strings.TrimPrefix(msg.Channel, "user:"), ":live")
+	userID, err := strconv.Atoi(userIDStr)
+	if err != nil {
+		return
+	}
+	var event UserEvent
+	if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+		logger.Log.Warn("Dropping malformed user event",
+			zap.String("channel", msg.Channel),
+			zap.Error(err))
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subscribers[userID] {
+		select {
+		case sub.events <- event:
+		default:
+			// A slow connection catches up from the stream instead of
+			// holding up everyone else's events
+			h.remove(sub)
+		}
+	}
+}
+
+// remove drops a subscription, with h.mu held
+func (h *UserEventHub) remove(sub *UserEventSubscription) {
+	subs := h.subscribers[sub.userID]
+	if _, ok := subs[sub]; !ok {
+		return
+	}
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(h.subscribers, sub.userID)
+	}
+	close(sub.events)
+}
+
+func (h *UserEventHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.stopped = true
+	for _, subs := range h.subscribers {
+		for sub := range subs {
+			h.remove(sub)
+		}
+	}
+}
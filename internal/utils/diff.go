@@ -0,0 +1,258 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DiffOp int
+
+const (
+	DiffEqual DiffOp = iota
+	DiffDelete
+	DiffInsert
+)
+
+// DiffLine is one line of a line diff. OldLine and NewLine are 1-based line
+// numbers in each text, 0 when the line is not part of that text.
+type DiffLine struct {
+	Op      DiffOp
+	Text    string
+	OldLine int
+	NewLine int
+}
+
+// maxDiffEdits bounds the work of the diff; texts differing by more edits
+// are diffed as a whole replacement instead of a minimal diff.
+const maxDiffEdits = 1000
+
+// SplitLines splits a text into lines, ignoring the final newline
+func SplitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// DiffLines computes a minimal line diff of a and b with Myers' algorithm
+func DiffLines(a, b []string) []DiffLine {
+	// Common prefix and suffix are kept out of the search, which keeps the
+	// usual case of a few edited lines cheap.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix &&
+		a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, DiffEqual)
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for i := 0; i < suffix; i++ {
+		ops = append(ops, DiffEqual)
+	}
+
+	lines := make([]DiffLine, 0, len(ops))
+	x, y := 0, 0
+	for _, op := range ops {
+		switch op {
+		case DiffEqual:
+			lines = append(lines, DiffLine{Op: op, Text: a[x], OldLine: x + 1, NewLine: y + 1})
+			x++
+			y++
+		case DiffDelete:
+			lines = append(lines, DiffLine{Op: op, Text: a[x], OldLine: x + 1})
+			x++
+		case DiffInsert:
+			lines = append(lines, DiffLine{Op: op, Text: b[y], NewLine: y + 1})
+			y++
+		}
+	}
+
+	return lines
+}
+
+// myersDiff returns the edit script turning a into b
+func myersDiff(a, b []string) []DiffOp {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return replaceAll(n, m)
+	}
+
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+
+	offset := maxD + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] holds the furthest x reached on diagonals -d..d after d edits
+	var trace [][]int
+
+	for d := 0; d <= maxD; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+				return backtrack(trace, n, m)
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+
+	return replaceAll(n, m)
+}
+
+func backtrack(trace [][]int, n, m int) []DiffOp {
+	var reversed []DiffOp
+	x, y := n, m
+
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // diagonals -(d-1)..d-1
+		at := func(k int) int { return prev[k+d-1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffEqual)
+			x--
+			y--
+		}
+		if x == prevX {
+			reversed = append(reversed, DiffInsert)
+			y--
+		} else {
+			reversed = append(reversed, DiffDelete)
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		reversed = append(reversed, DiffEqual)
+		x--
+		y--
+	}
+
+	ops := make([]DiffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(reversed)-1-i] = op
+	}
+	return ops
+}
+
+func replaceAll(n, m int) []DiffOp {
+	ops := make([]DiffOp, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, DiffDelete)
+	}
+	for i := 0; i < m; i++ {
+		ops = append(ops, DiffInsert)
+	}
+	return ops
+}
+
+// FormatUnifiedDiff renders a line diff in unified format with the given
+// number of context lines around each change. It returns an empty string
+// when nothing changed.
+func FormatUnifiedDiff(oldName, newName string, lines []DiffLine, context int) string {
+	var changes []int
+	for i, line := range lines {
+		if line.Op != DiffEqual {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+
+	for i := 0; i < len(changes); {
+		// Merge changes whose context would overlap into one hunk
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*context {
+			j++
+		}
+		start := max(changes[i]-context, 0)
+		end := min(changes[j]+context+1, len(lines))
+		writeHunk(&sb, lines, start, end)
+		i = j + 1
+	}
+
+	return sb.String()
+}
+
+func writeHunk(sb *strings.Builder, lines []DiffLine, start, end int) {
+	// Lines before the hunk in each text
+	oldBefore, newBefore := 0, 0
+	for _, line := range lines[:start] {
+		if line.Op != DiffInsert {
+			oldBefore++
+		}
+		if line.Op != DiffDelete {
+			newBefore++
+		}
+	}
+
+	oldCount, newCount := 0, 0
+	for _, line := range lines[start:end] {
+		if line.Op != DiffInsert {
+			oldCount++
+		}
+		if line.Op != DiffDelete {
+			newCount++
+		}
+	}
+
+	fmt.Fprintf(sb, "@@ -%s +%s @@\n", hunkRange(oldBefore, oldCount), hunkRange(newBefore, newCount))
+	for _, line := range lines[start:end] {
+		switch line.Op {
+		case DiffEqual:
+			sb.WriteString(" ")
+		case DiffDelete:
+			sb.WriteString("-")
+		case DiffInsert:
+			sb.WriteString("+")
+		}
+		sb.WriteString(line.Text)
+		sb.WriteString("\n")
+	}
+}
+
+// hunkRange formats the start,count of a hunk; an empty range starts at the line before it
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
@@ -0,0 +1,54 @@
+package workerpool
+
+import (
+	"HAB/internal/logger"
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// runningJobs tracks the submissions currently executing in this pool so a
+// cancellation can stop the worker handling it.
+type runningJobs struct {
+	mu      sync.Mutex
+	cancels map[int]context.CancelFunc
+}
+
+func newRunningJobs() *runningJobs {
+	return &runningJobs{cancels: make(map[int]context.CancelFunc)}
+}
+
+func (r *runningJobs) add(submissionID int, cancel context.CancelFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cancels[submissionID] = cancel
+}
+
+func (r *runningJobs) remove(submissionID int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.cancels, submissionID)
+}
+
+// cancel stops the submission if it runs in this pool and reports whether it did
+func (r *runningJobs) cancel(submissionID int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cancel, ok := r.cancels[submissionID]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// listenForCancellations cancels running submissions as cancellations are published
+func (p *CodeWorkerPool) listenForCancellations(ctx context.Context) {
+	for submissionID := range p.queue.SubscribeCancellations(ctx) {
+		if p.running.cancel(submissionID) {
+			logger.Log.Info("Cancelling running submission",
+				zap.Int("submission_id", submissionID))
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package workerpool
+
+import (
+	"HAB/internal/logger"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const dispatcherConsumer = "CodeDispatcher"
+
+// dispatch reads jobs from the queue into the scheduler. It keeps about one
+// dispatchable job per worker buffered so the scheduler can pick fairly
+// between users, and keeps reading past jobs of users already at their cap.
+func (p *CodeWorkerPool) dispatch(ctx context.Context) {
+	if err := p.recoverPending(ctx); err != nil {
+		logger.Log.Error("Failed to recover pending jobs",
+			zap.String("consumer", dispatcherConsumer),
+			zap.Error(err))
+	}
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		default:
+		}
+
+		wanted := p.scheduler.Wanted(p.numWorkers, p.maxBuffered)
+		if wanted <= 0 {
+			select {
+			case <-p.quit:
+				return
+			case <-p.scheduler.Changed():
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		entries, err := p.readNext(ctx, int64(wanted))
+		if err != nil {
+			if err != redis.Nil {
+				logger.Log.Error("Redis operation failed",
+					zap.String("consumer", dispatcherConsumer),
+					zap.Error(err))
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, stream := range entries {
+			for _, msg := range stream.Messages {
+				p.schedule(ctx, stream.Stream, msg)
+			}
+		}
+	}
+}
+
+// recoverPending hands the scheduler the jobs read before the process last
+// stopped but never started by a worker. They stay pending in their stream
+// until a worker acknowledges them, and reading with ">" only returns new
+// entries, so without this they would never be judged. Another host sharing
+// the consumer may be holding some of them too; workers skip submissions
+// that are no longer pending, so a job is judged once either way.
+func (p *CodeWorkerPool) recoverPending(ctx context.Context) error {
+	for _, stream := range p.queue.Streams() {
+		after := "0"
+		for {
+			entries, err := p.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+				Group:    p.group,
+				Consumer: dispatcherConsumer,
+				Streams:  []string{stream, after},
+				Count:    100,
+				Block:    -1,
+			}).Result()
+			if err == redis.Nil {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read pending jobs of %s: %w", stream, err)
+			}
+			if len(entries) == 0 || len(entries[0].Messages) == 0 {
+				break
+			}
+
+			for _, msg := range entries[0].Messages {
+				p.schedule(ctx, stream, msg)
+				after = msg.ID
+			}
+			logger.Log.Info("Recovered pending jobs",
+				zap.String("stream", stream),
+				zap.Int("count", len(entries[0].Messages)))
+		}
+	}
+	return nil
+}
+
+// schedule turns a stream entry into a job for the scheduler. Malformed
+// entries, and those trimmed from the stream while pending, are dropped.
+func (p *CodeWorkerPool) schedule(ctx context.Context, stream string, msg redis.XMessage) {
+	job, err := p.newJob(stream, msg)
+	if err != nil {
+		logger.Log.Error("Dropping malformed job",
+			zap.String("stream", stream),
+			zap.String("job_id", msg.ID),
+			zap.Any("values", msg.Values),
+			zap.Error(err))
+		_ = p.queue.Ack(ctx, stream, msg.ID)
+		return
+	}
+	p.scheduler.Push(job)
+}
+
+// readNext fetches up to count jobs, preferring higher-priority lanes. Each
+// lane is polled without blocking in priority order; only when all of them
+// are empty does the dispatcher block on every lane at once.
+func (p *CodeWorkerPool) readNext(ctx context.Context, count int64) ([]redis.XStream, error) {
+	streams := p.queue.Streams()
+
+	for _, stream := range streams {
+		entries, err := p.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    p.group,
+			Consumer: dispatcherConsumer,
+			Streams:  []string{stream, ">"},
+			Count:    count,
+			Block:    -1, // Don't block
+		}).Result()
+
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 && len(entries[0].Messages) > 0 {
+			return entries, nil
+		}
+	}
+
+	args := make([]string, 0, len(streams)*2)
+	args = append(args, streams...)
+	for range streams {
+		args = append(args, ">")
+	}
+
+	return p.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    p.group,
+		Consumer: dispatcherConsumer,
+		Streams:  args,
+		Count:    count,
+		Block:    5 * time.Second,
+	}).Result()
+}
+
+func (p *CodeWorkerPool) newJob(stream string, msg redis.XMessage) (codeJob, error) {
+	submissionIDStr, ok := msg.Values["submission_id"].(string)
+	if !ok {
+		return codeJob{}, fmt.Errorf("missing submission ID")
+	}
+
+	submissionID, err := strconv.Atoi(submissionIDStr)
+	if err != nil {
+		return codeJob{}, fmt.Errorf("failed to parse submission ID: %w", err)
+	}
+
+	// Jobs queued before fair scheduling carry no user ID; they share user 0
+	userID := 0
+	if userIDStr, ok := msg.Values["user_id"].(string); ok {
+		userID, _ = strconv.Atoi(userIDStr)
+	}
+
+	rejudgeID := 0
+	if rejudgeIDStr, ok := msg.Values["rejudge_id"].(string); ok {
+		rejudgeID, _ = strconv.Atoi(rejudgeIDStr)
+	}
+
+	return codeJob{
+		stream:       stream,
+		msg:          msg,
+		lane:         p.queue.LaneOf(stream),
+		submissionID: submissionID,
+		userID:       userID,
+		rejudgeID:    rejudgeID,
+	}, nil
+}
@@ -0,0 +1,226 @@
+package workerpool
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"HAB/internal/services"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const generationReadBlock = 5 * time.Second
+
+// TestGenerationWorker runs the test generation jobs queued by the API, one
+// at a time, in the judging sandbox. It also fails the jobs of workers that
+// died, so their problems can generate tests again.
+type TestGenerationWorker struct {
+	id          string
+	problemRepo repositories.ProblemRepository
+	jobs        *services.TestGenerationJobs
+	generator   *services.TestGenerator
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func NewTestGenerationWorker(problemRepo repositories.ProblemRepository, jobs *services.TestGenerationJobs,
+	blobs *services.DiskBlobCache) (*TestGenerationWorker, error) {
+	codeRunner, err := services.NewCodeRunnerService("/tmp/code-execution", blobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create code runner service: %w", err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return &TestGenerationWorker{
+		id:          fmt.Sprintf("TestGenerator@%s", hostname),
+		problemRepo: problemRepo,
+		jobs:        jobs,
+		generator:   services.NewTestGenerator(codeRunner),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+func (w *TestGenerationWorker) Start(ctx context.Context) error {
+	if err := w.jobs.CreateGroup(ctx); err != nil {
+		return err
+	}
+
+	ctx, w.cancel = context.WithCancel(ctx)
+	go w.run(ctx)
+	return nil
+}
+
+// Stop interrupts the running job, which is marked failed, and waits for it
+func (w *TestGenerationWorker) Stop() {
+	if w.cancel == nil {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+func (w *TestGenerationWorker) run(ctx context.Context) {
+	defer close(w.done)
+
+	var lastSweep time.Time
+	for ctx.Err() == nil {
+		// Starting up is also when the jobs lost in a restart are noticed
+		if time.Since(lastSweep) >= sweepInterval {
+			lastSweep = time.Now()
+			w.failOrphaned(ctx)
+		}
+
+		task, err := w.jobs.Next(ctx, w.id, generationReadBlock)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Log.Error("Failed to get test generation job", zap.Error(err))
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		if task != nil {
+			w.generate(ctx, task)
+		}
+	}
+}
+
+func (w *TestGenerationWorker) failOrphaned(ctx context.Context) {
+	failed, err := w.jobs.FailOrphaned(ctx)
+	if err != nil {
+		logger.Log.Error("Failed to clean up interrupted test generation jobs", zap.Error(err))
+	}
+	if failed > 0 {
+		logger.Log.Warn("Failed test generation jobs whose worker stopped", zap.Int("count", failed))
+	}
+}
+
+// generate runs a job to the end. Each test goes to storage as soon as it
+// is generated, and the tests are published once all of them are; if any
+// program fails, nothing is published.
+func (w *TestGenerationWorker) generate(ctx context.Context, task *services.TestGenerationTask) {
+	job := task.Job
+	ctx, cancel := context.WithTimeout(ctx, models.TestGenerationTimeout)
+	defer cancel()
+
+	// The job is saved on every test and every heartbeat, from two goroutines
+	var mu sync.Mutex
+	save := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := w.jobs.Save(ctx, job); err != nil && ctx.Err() == nil {
+			logger.Log.Warn("Failed to save test generation progress",
+				zap.String("job_id", job.ID),
+				zap.Error(err))
+		}
+	}
+
+	heartbeatDone := make(chan struct{})
+	var heartbeat sync.WaitGroup
+	heartbeat.Add(1)
+	go func() {
+		defer heartbeat.Done()
+		ticker := time.NewTicker(models.GenerationHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-heartbeatDone:
+				return
+			case <-ticker.C:
+				save()
+			}
+		}
+	}()
+
+	generated, version, err := w.generateTests(ctx, task, func(generated int) {
+		mu.Lock()
+		job.Generated = generated
+		mu.Unlock()
+		save()
+	})
+	// No save may follow, and overwrite, the outcome
+	close(heartbeatDone)
+	heartbeat.Wait()
+
+	var generationErr *services.GenerationError
+	switch {
+	case err == nil:
+		job.Status = models.GenerationSucceeded
+		job.Version = version
+		logger.Log.Info("Generated test set published",
+			zap.Int("problem_id", job.ProblemID),
+			zap.Int("version", version),
+			zap.Int("generated", generated))
+	case errors.As(err, &generationErr):
+		job.Status = models.GenerationFailed
+		job.Error = "Test generation failed: " + generationErr.Error()
+		job.Line = generationErr.Line
+		job.Program = generationErr.Program
+	case errors.Is(ctx.Err(), context.Canceled):
+		job.Status = models.GenerationFailed
+		job.Error = "Test generation was interrupted: the worker running it stopped"
+	default:
+		job.Status = models.GenerationFailed
+		job.Error = "Failed to generate tests"
+		logger.Log.Error("Failed to generate tests",
+			zap.String("job_id", job.ID),
+			zap.Int("problem_id", job.ProblemID),
+			zap.Error(err))
+	}
+
+	// Recorded even when the worker is stopping, so the problem is released
+	if err := w.jobs.Finish(context.Background(), task); err != nil {
+		logger.Log.Error("Failed to record the end of test generation",
+			zap.String("job_id", job.ID),
+			zap.Error(err))
+	}
+}
+
+// generateTests runs the programs of the job's problem, calling progress with
+// the number of tests stored so far, and publishes the tests. It returns how
+// many were generated and the published version.
+func (w *TestGenerationWorker) generateTests(ctx context.Context, task *services.TestGenerationTask,
+	progress func(generated int)) (int, int, error) {
+	req := models.GenerateTestsRequest{Script: task.Script, KeepExisting: task.KeepExisting}
+	commands, err := req.Commands()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Read now rather than when queued, to run the latest programs and limits
+	problem, err := w.problemRepo.GetProblemByID(ctx, task.Job.ProblemID)
+	if err != nil {
+		return 0, 0, err
+	}
+	programs, err := w.problemRepo.ListPrograms(ctx, task.Job.ProblemID)
+	if err != nil {
+		return 0, 0, err
+	}
+	settings := models.JudgeSettings{TimeLimitMs: problem.TimeLimitMs, MemoryLimitMB: problem.MemoryLimitMB}
+
+	testCases := make([]models.TestCase, 0, len(commands))
+	err = w.generator.Generate(ctx, programs, commands, settings, func(tc models.TestCaseRequest) error {
+		stored, err := w.problemRepo.StoreTestCase(ctx, &tc)
+		if err != nil {
+			return err
+		}
+		testCases = append(testCases, *stored)
+		progress(len(testCases))
+		return nil
+	})
+	if err != nil {
+		return len(testCases), 0, err
+	}
+
+	version, err := w.problemRepo.PublishGeneratedTests(ctx, task.Job.ProblemID, req.Script, testCases, req.KeepExisting)
+	return len(testCases), version, err
+}
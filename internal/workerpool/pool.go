@@ -7,7 +7,7 @@ import (
 	"HAB/internal/services"
 	"context"
 	"fmt"
-	"strconv"
+	"os"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -16,60 +16,49 @@ import (
 
 // CodeWorker is a specialized worker that processes code submissions
 type CodeWorker struct {
-	id         string
-	quit       chan bool
-	rdb        *redis.Client
-	stream     string
-	group      string
-	codeRepo   repositories.CodeRepository
-	codeRunner *services.CodeRunnerService
+	id          string
+	quit        chan bool
+	rdb         *redis.Client
+	group       string
+	scheduler   *fairScheduler
+	running     *runningJobs
+	codeRepo    repositories.CodeRepository
+	rejudgeRepo repositories.RejudgeRepository
+	codeRunner  *services.CodeRunnerService
+	events      *services.SubmissionEvents
+	queue       *services.SubmissionQueue
 }
 
 // NewCodeWorker creates a new code worker
-func NewCodeWorker(id string, rdb *redis.Client, stream, group string,
-	codeRepo repositories.CodeRepository, codeRunner *services.CodeRunnerService) *CodeWorker {
+func NewCodeWorker(id string, rdb *redis.Client, queue *services.SubmissionQueue, scheduler *fairScheduler, running *runningJobs,
+	codeRepo repositories.CodeRepository, rejudgeRepo repositories.RejudgeRepository,
+	codeRunner *services.CodeRunnerService, events *services.SubmissionEvents) *CodeWorker {
 	return &CodeWorker{
-		id:         id,
-		quit:       make(chan bool),
-		rdb:        rdb,
-		stream:     stream,
-		group:      group,
-		codeRepo:   codeRepo,
-		codeRunner: codeRunner,
+		id:          id,
+		quit:        make(chan bool),
+		rdb:         rdb,
+		group:       queue.Group(),
+		queue:       queue,
+		scheduler:   scheduler,
+		running:     running,
+		codeRepo:    codeRepo,
+		rejudgeRepo: rejudgeRepo,
+		codeRunner:  codeRunner,
+		events:      events,
 	}
 }
 
-// Start begins processing jobs from the stream
+// Start begins processing jobs handed out by the scheduler
 func (w *CodeWorker) Start(ctx context.Context) {
 	go func() {
 		for {
-			select {
-			case <-w.quit:
+			job, ok := w.scheduler.Next(w.quit)
+			if !ok {
 				return
-			default:
-				entries, err := w.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
-					Group:    w.group,
-					Consumer: w.id,
-					Streams:  []string{w.stream, ">"},
-					Count:    1,
-					Block:    5 * time.Second,
-				}).Result()
-
-				if err != nil {
-					if err != redis.Nil {
-						logger.Log.Error("Redis operation failed",
-							zap.String("worker_id", w.id),
-							zap.Error(err))
-					}
-					continue
-				}
-
-				for _, stream := range entries {
-					for _, msg := range stream.Messages {
-						w.processCodeJob(ctx, msg)
-					}
-				}
 			}
+
+			w.processCodeJob(ctx, job)
+			w.scheduler.Done(job)
 		}
 	}()
 }
@@ -81,44 +70,73 @@ func (w *CodeWorker) Stop() {
 	close(w.quit)
 }
 
-func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
+func (w *CodeWorker) processCodeJob(ctx context.Context, job codeJob) {
 	logger.Log.Info("Processing code submission job",
 		zap.String("worker_id", w.id),
-		zap.String("job_id", msg.ID))
+		zap.String("stream", job.stream),
+		zap.String("job_id", job.msg.ID),
+		zap.Int("user_id", job.userID))
 
-	if err := w.rdb.XAck(ctx, w.stream, w.group, msg.ID).Err(); err != nil {
+	if err := w.queue.Ack(ctx, job.stream, job.msg.ID); err != nil {
 		logger.Log.Error("Failed to acknowledge job",
 			zap.String("worker_id", w.id),
 			zap.Error(err))
 	}
 
-	submissionIDStr, ok := msg.Values["submission_id"].(string)
-	if !ok {
-		logger.Log.Error("Invalid submission ID in message",
+	submissionID := job.submissionID
+
+	// Register before reading the submission: a cancellation published from
+	// now on cancels jobCtx, an earlier one is visible in the stored status.
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w.running.add(submissionID, cancel)
+	defer w.running.remove(submissionID)
+
+	submission, err := w.codeRepo.GetSubmission(ctx, submissionID)
+	if err != nil {
+		logger.Log.Error("Failed to get submission",
 			zap.String("worker_id", w.id),
-			zap.Any("values", msg.Values))
+			zap.Int("submission_id", submissionID),
+			zap.Error(err))
 		return
 	}
 
-	submissionID, err := strconv.Atoi(submissionIDStr)
-	if err != nil {
-		logger.Log.Error("Failed to parse submission ID",
+	// Only pending submissions are judged: a cancelled or finished one needs
+	// no work, and a processing one is a duplicate message from the outbox
+	// relay for a submission another worker is already judging.
+	if submission.Status != models.StatusPending {
+		logger.Log.Info("Skipping submission that is not pending",
 			zap.String("worker_id", w.id),
-			zap.String("submission_id", submissionIDStr),
-			zap.Error(err))
+			zap.Int("submission_id", submissionID),
+			zap.String("status", submission.Status))
 		return
 	}
+	// Jobs queued without a user ID still publish events to the right user
+	job.userID = submission.UserID
 
-	submission, err := w.codeRepo.GetSubmission(ctx, submissionID)
+	marked, err := w.codeRepo.MarkProcessing(ctx, submissionID, submission.RequeueCount)
 	if err != nil {
-		logger.Log.Error("Failed to get submission",
+		logger.Log.Error("Failed to mark submission as processing",
 			zap.String("worker_id", w.id),
 			zap.Int("submission_id", submissionID),
 			zap.Error(err))
 		return
 	}
+	if !marked {
+		logger.Log.Info("Submission left the pending state, skipping",
+			zap.String("worker_id", w.id),
+			zap.Int("submission_id", submissionID))
+		return
+	}
 
-	languageName, _, err := services.GetLanguageConfig(submission.LanguageID)
+	judgement := &models.Judgement{
+		SubmissionID: submissionID,
+		WorkerID:     w.id,
+		StartedAt:    time.Now(),
+		Attempt:      submission.RequeueCount,
+	}
+
+	languageName, langConfig, err := services.GetLanguageConfig(submission.LanguageID)
 	if err != nil {
 		logger.Log.Error("Failed to get language config",
 			zap.String("worker_id", w.id),
@@ -128,14 +146,15 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 
 		// Update submission with error
 		errorMsg := fmt.Sprintf("Unsupported language ID: %d", submission.LanguageID)
-		err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, models.StatusCompilationError, nil, &errorMsg)
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
 		if err != nil {
 			logger.Log.Error("Failed to update submission status", zap.Error(err))
 		}
 		return
 	}
+	judgement.Toolchain = langConfig.Toolchain
 
-	testCases, err := w.codeRepo.GetTestCases(ctx, submission.ProblemID)
+	testSet, err := w.codeRepo.GetTestSet(ctx, submission.ProblemID)
 	if err != nil {
 		logger.Log.Error("Failed to get test cases",
 			zap.String("worker_id", w.id),
@@ -144,12 +163,13 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 			zap.Error(err))
 
 		errorMsg := "Failed to retrieve test cases"
-		err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, models.StatusCompilationError, nil, &errorMsg)
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
 		if err != nil {
 			logger.Log.Error("Failed to update submission status", zap.Error(err))
 		}
 		return
 	}
+	judgement.TestSetVersion = &testSet.Version
 
 	systemCode, err := w.codeRepo.GetSystemCode(ctx, submission.ProblemID, submission.LanguageID)
 	if err != nil {
@@ -161,7 +181,7 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 			zap.Error(err))
 
 		errorMsg := "Failed to retrieve system code"
-		err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, models.StatusCompilationError, nil, &errorMsg)
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
 		if err != nil {
 			logger.Log.Error("Failed to update submission status", zap.Error(err))
 		}
@@ -178,7 +198,23 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 			zap.Error(err))
 
 		errorMsg := "Failed to retrieve language imports"
-		err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, models.StatusCompilationError, nil, &errorMsg)
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
+		if err != nil {
+			logger.Log.Error("Failed to update submission status", zap.Error(err))
+		}
+		return
+	}
+
+	settings, err := w.codeRepo.GetJudgeSettings(ctx, submission.ProblemID)
+	if err != nil {
+		logger.Log.Error("Failed to get judge settings",
+			zap.String("worker_id", w.id),
+			zap.Int("submission_id", submissionID),
+			zap.Int("problem_id", submission.ProblemID),
+			zap.Error(err))
+
+		errorMsg := "Failed to retrieve problem limits"
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
 		if err != nil {
 			logger.Log.Error("Failed to update submission status", zap.Error(err))
 		}
@@ -187,14 +223,31 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 
 	request := services.CodeRunnerRequest{
 		Submission:   *submission,
-		TestCases:    testCases,
+		TestCases:    testSet.TestCases,
 		SystemCode:   systemCode,
 		ImportCode:   importCode,
 		LanguageName: languageName,
+		Settings:     *settings,
+		OnProgress: func(stage string, test, total int) {
+			w.publishEvent(ctx, services.SubmissionEvent{
+				SubmissionID: submissionID,
+				UserID:       submission.UserID,
+				Stage:        stage,
+				Status:       models.StatusProcessing,
+				Test:         test,
+				Total:        total,
+			})
+		},
 	}
 
 	// Execute code
-	result, err := w.codeRunner.Execute(ctx, request)
+	result, err := w.codeRunner.Execute(jobCtx, request)
+	if err != nil && jobCtx.Err() != nil {
+		logger.Log.Info("Code execution cancelled",
+			zap.String("worker_id", w.id),
+			zap.Int("submission_id", submissionID))
+		return
+	}
 	if err != nil {
 		logger.Log.Error("Code execution failed",
 			zap.String("worker_id", w.id),
@@ -203,14 +256,30 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 
 		// Update submission with error
 		errorMsg := fmt.Sprintf("Execution error: %v", err)
-		err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, models.StatusCompilationError, nil, &errorMsg)
+		err = w.updateStatus(ctx, job, judgement, models.StatusCompilationError, nil, &errorMsg)
 		if err != nil {
 			logger.Log.Error("Failed to update submission status", zap.Error(err))
 		}
 		return
 	}
 
-	err = w.codeRepo.UpdateSubmissionStatus(ctx, submissionID, result.Status, result.FailedTestID, result.FailedOutput)
+	if err := w.queue.RecordJudgeDuration(ctx, time.Since(judgement.StartedAt)); err != nil {
+		logger.Log.Warn("Failed to record judge duration",
+			zap.String("worker_id", w.id),
+			zap.Error(err))
+	}
+
+	judgement.ExecutionMs = result.ExecutionTime.Milliseconds()
+	judgement.TestResults = make([]models.JudgementTestResult, len(result.Results))
+	for i, tr := range result.Results {
+		judgement.TestResults[i] = models.JudgementTestResult{
+			TestCaseID: tr.TestCaseID,
+			Passed:     tr.Passed,
+			DurationMs: tr.Duration.Milliseconds(),
+		}
+	}
+
+	err = w.updateStatus(ctx, job, judgement, result.Status, result.FailedTestID, result.FailedOutput)
 	if err != nil {
 		logger.Log.Error("Failed to update submission status",
 			zap.String("worker_id", w.id),
@@ -221,55 +290,142 @@ func (w *CodeWorker) processCodeJob(ctx context.Context, msg redis.XMessage) {
 
 	logger.Log.Info("Finished processing code submission job",
 		zap.String("worker_id", w.id),
-		zap.String("job_id", msg.ID),
+		zap.String("job_id", job.msg.ID),
 		zap.String("status", result.Status),
 		zap.Duration("execution_time", result.ExecutionTime))
 }
 
+// updateStatus records the verdict of a job as a new judgement that becomes
+// the current one of the submission and, for rejudges, records it against
+// the rejudge batch.
+func (w *CodeWorker) updateStatus(ctx context.Context, job codeJob, judgement *models.Judgement,
+	status string, wrongTestcase *int, wrongOutput *string) error {
+	judgement.Status = status
+	judgement.WrongTestcase = wrongTestcase
+	judgement.ProgramOutput = wrongOutput
+	judgement.FinishedAt = time.Now()
+
+	if err := w.codeRepo.RecordJudgement(ctx, judgement); err != nil {
+		return err
+	}
+
+	if !judgement.IsCurrent {
+		logger.Log.Info("Dropped verdict of a submission cancelled or requeued while judged",
+			zap.String("worker_id", w.id),
+			zap.Int("submission_id", job.submissionID),
+			zap.Int("attempt", judgement.Attempt))
+		return nil
+	}
+
+	w.publishEvent(ctx, services.SubmissionEvent{
+		SubmissionID: job.submissionID,
+		UserID:       job.userID,
+		Stage:        services.StageFinished,
+		Status:       status,
+	})
+
+	if job.rejudgeID != 0 {
+		if err := w.rejudgeRepo.RecordRejudgeResult(ctx, job.rejudgeID, job.submissionID, judgement.ID, status); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// publishEvent reports the progress of a submission to clients. Clients can
+// always fall back to reading the stored status, so failures are only logged.
+func (w *CodeWorker) publishEvent(ctx context.Context, event services.SubmissionEvent) {
+	if err := w.events.Publish(ctx, event); err != nil {
+		logger.Log.Warn("Failed to publish submission event",
+			zap.String("worker_id", w.id),
+			zap.Int("submission_id", event.SubmissionID),
+			zap.Error(err))
+	}
+}
+
 type CodeWorkerPool struct {
-	workers    []*CodeWorker
-	numWorkers int
-	rdb        *redis.Client
-	stream     string
-	group      string
-	codeRepo   repositories.CodeRepository
-	codeRunner *services.CodeRunnerService
+	workers     []*CodeWorker
+	numWorkers  int
+	maxBuffered int
+	rdb         *redis.Client
+	queue       *services.SubmissionQueue
+	group       string
+	scheduler   *fairScheduler
+	running     *runningJobs
+	quit        chan bool
+	cancel      context.CancelFunc
+	codeRepo    repositories.CodeRepository
+	rejudgeRepo repositories.RejudgeRepository
+	codeRunner  *services.CodeRunnerService
+	events      *services.SubmissionEvents
 }
 
-func NewCodeWorkerPool(numWorkers int, rdb *redis.Client, stream, group string,
-	codeRepo repositories.CodeRepository) (*CodeWorkerPool, error) {
-	codeRunner, err := services.NewCodeRunnerService("/tmp/code-execution")
+// NewCodeWorkerPool creates a pool of numWorkers workers. A single user never
+// has more than maxPerUser submissions running at once, and about
+// maxBuffered jobs are read ahead from the queue to schedule fairly; more
+// only while the buffered ones are all held back by the per-user cap.
+func NewCodeWorkerPool(numWorkers, maxPerUser, maxBuffered int, rdb *redis.Client, queue *services.SubmissionQueue,
+	codeRepo repositories.CodeRepository, rejudgeRepo repositories.RejudgeRepository, events *services.SubmissionEvents,
+	blobs *services.DiskBlobCache) (*CodeWorkerPool, error) {
+	codeRunner, err := services.NewCodeRunnerService("/tmp/code-execution", blobs)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create code runner service: %w", err)
 	}
 
+	if maxBuffered < numWorkers {
+		maxBuffered = numWorkers
+	}
+
 	return &CodeWorkerPool{
-		workers:    make([]*CodeWorker, numWorkers),
-		numWorkers: numWorkers,
-		rdb:        rdb,
-		stream:     stream,
-		group:      group,
-		codeRepo:   codeRepo,
-		codeRunner: codeRunner,
+		workers:     make([]*CodeWorker, numWorkers),
+		numWorkers:  numWorkers,
+		maxBuffered: maxBuffered,
+		rdb:         rdb,
+		queue:       queue,
+		group:       queue.Group(),
+		scheduler:   newFairScheduler(maxPerUser),
+		running:     newRunningJobs(),
+		quit:        make(chan bool),
+		codeRepo:    codeRepo,
+		rejudgeRepo: rejudgeRepo,
+		codeRunner:  codeRunner,
+		events:      events,
 	}, nil
 }
 
 func (p *CodeWorkerPool) Start(ctx context.Context) error {
-	// Create consumer group if it doesn't exist
-	_, err := p.rdb.XGroupCreateMkStream(ctx, p.stream, p.group, "$").Result()
-	if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
-		return fmt.Errorf("failed to create consumer group: %w", err)
+	// Create the consumer group on every lane if it doesn't exist
+	for _, stream := range p.queue.Streams() {
+		_, err := p.rdb.XGroupCreateMkStream(ctx, stream, p.group, "$").Result()
+		if err != nil && err.Error() != "BUSYGROUP Consumer Group name already exists" {
+			return fmt.Errorf("failed to create consumer group on %s: %w", stream, err)
+		}
+		if err := p.queue.TrimAcked(ctx, stream); err != nil {
+			logger.Log.Warn("Failed to trim acknowledged jobs",
+				zap.String("stream", stream),
+				zap.Error(err))
+		}
+	}
+
+	// Worker IDs end up in judgements, so make them unique across hosts
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
 	}
 
 	// Start workers
 	for i := 0; i < p.numWorkers; i++ {
 		worker := NewCodeWorker(
-			fmt.Sprintf("CodeWorker-%d", i+1),
+			fmt.Sprintf("CodeWorker-%d@%s", i+1, hostname),
 			p.rdb,
-			p.stream,
-			p.group,
+			p.queue,
+			p.scheduler,
+			p.running,
 			p.codeRepo,
+			p.rejudgeRepo,
 			p.codeRunner,
+			p.events,
 		)
 
 		worker.Start(ctx)
@@ -279,14 +435,24 @@ func (p *CodeWorkerPool) Start(ctx context.Context) error {
 			zap.String("worker_id", worker.id))
 	}
 
+	listenCtx, cancel := context.WithCancel(ctx)
+	p.cancel = cancel
+	go p.listenForCancellations(listenCtx)
+	go p.dispatch(ctx)
+
 	logger.Log.Info("Code worker pool started",
-		zap.Int("num_workers", p.numWorkers))
+		zap.Int("num_workers", p.numWorkers),
+		zap.Int("max_per_user", p.scheduler.maxPerUser))
 
 	return nil
 }
 
 // Stop terminates all workers in the pool
 func (p *CodeWorkerPool) Stop() {
+	close(p.quit)
+	if p.cancel != nil {
+		p.cancel()
+	}
 	for _, worker := range p.workers {
 		worker.Stop()
 	}
@@ -0,0 +1,99 @@
+package workerpool
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"HAB/internal/services"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	relayInterval  = 500 * time.Millisecond
+	relayBatchSize = 100
+	// Published outbox entries are kept this long for troubleshooting
+	outboxRetention = 24 * time.Hour
+)
+
+// OutboxRelay publishes the queue messages written to the outbox together
+// with submissions. Several relays can run at once; each entry is published
+// by one of them, at least once.
+type OutboxRelay struct {
+	outboxRepo repositories.OutboxRepository
+	queue      *services.SubmissionQueue
+	quit       chan bool
+}
+
+func NewOutboxRelay(outboxRepo repositories.OutboxRepository, queue *services.SubmissionQueue) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepo: outboxRepo,
+		queue:      queue,
+		quit:       make(chan bool),
+	}
+}
+
+func (r *OutboxRelay) Start(ctx context.Context) {
+	go r.run(ctx)
+}
+
+func (r *OutboxRelay) Stop() {
+	close(r.quit)
+}
+
+func (r *OutboxRelay) run(ctx context.Context) {
+	ticker := time.NewTicker(relayInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Now()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+		}
+
+		// Keep going while full batches come back, to drain a backlog quickly
+		for {
+			published, err := r.outboxRepo.RelayPending(ctx, relayBatchSize, r.publish)
+			if err != nil {
+				logger.Log.Error("Failed to relay outbox entries",
+					zap.Int("published", published),
+					zap.Error(err))
+			}
+			if err != nil || published < relayBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) >= time.Hour {
+			lastCleanup = time.Now()
+			deleted, err := r.outboxRepo.DeletePublished(ctx, outboxRetention)
+			if err != nil {
+				logger.Log.Error("Failed to clean up outbox", zap.Error(err))
+			} else if deleted > 0 {
+				logger.Log.Info("Cleaned up outbox", zap.Int64("deleted", deleted))
+			}
+		}
+	}
+}
+
+func (r *OutboxRelay) publish(ctx context.Context, entry models.OutboxEntry) error {
+	if entry.RejudgeID != nil {
+		_, err := r.queue.EnqueueRejudge(ctx, entry.SubmissionID, entry.UserID, *entry.RejudgeID)
+		return err
+	}
+
+	lane, err := services.ParseLane(entry.Lane)
+	if err != nil {
+		logger.Log.Warn("Unknown lane in outbox entry, using the normal lane",
+			zap.Int64("outbox_id", entry.ID),
+			zap.String("lane", entry.Lane))
+		lane = services.LaneNormal
+	}
+
+	_, err = r.queue.Enqueue(ctx, entry.SubmissionID, entry.UserID, lane)
+	return err
+}
@@ -0,0 +1,212 @@
+package workerpool
+
+import (
+	"HAB/internal/services"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// codeJob is a stream entry that has been read from Redis but not yet handed to a worker
+type codeJob struct {
+	stream       string
+	msg          redis.XMessage
+	lane         services.Lane
+	submissionID int
+	userID       int
+	rejudgeID    int // 0 unless the job belongs to a rejudge batch
+}
+
+type userQueue struct {
+	userID int
+	jobs   []codeJob
+}
+
+// laneQueue holds the buffered jobs of one lane, grouped per user. Users are
+// served round-robin starting from next.
+type laneQueue struct {
+	users []*userQueue
+	next  int
+}
+
+// fairScheduler buffers jobs read from the queue and hands them out to
+// workers. Lanes are served strictly by priority; inside a lane, users are
+// served round-robin and no user may have more than maxPerUser jobs running
+// at once.
+type fairScheduler struct {
+	mu         sync.Mutex
+	maxPerUser int
+	lanes      map[services.Lane]*laneQueue
+	inFlight   map[int]int
+	buffered   int
+	wake       chan struct{} // closed and replaced whenever the state changes
+}
+
+func newFairScheduler(maxPerUser int) *fairScheduler {
+	if maxPerUser <= 0 {
+		maxPerUser = 1
+	}
+
+	lanes := make(map[services.Lane]*laneQueue, len(services.Lanes))
+	for _, lane := range services.Lanes {
+		lanes[lane] = &laneQueue{}
+	}
+
+	return &fairScheduler{
+		maxPerUser: maxPerUser,
+		lanes:      lanes,
+		inFlight:   make(map[int]int),
+		wake:       make(chan struct{}),
+	}
+}
+
+// Push buffers a job read from the stream
+func (s *fairScheduler) Push(job codeJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lq, ok := s.lanes[job.lane]
+	if !ok {
+		lq = s.lanes[services.LaneNormal]
+	}
+
+	var uq *userQueue
+	for _, candidate := range lq.users {
+		if candidate.userID == job.userID {
+			uq = candidate
+			break
+		}
+	}
+	if uq == nil {
+		uq = &userQueue{userID: job.userID}
+		lq.users = append(lq.users, uq)
+	}
+
+	uq.jobs = append(uq.jobs, job)
+	s.buffered++
+	s.broadcastLocked()
+}
+
+// Next blocks until a job can be dispatched or quit fires. The returned job
+// counts as in flight until Done is called.
+func (s *fairScheduler) Next(quit <-chan bool) (codeJob, bool) {
+	for {
+		s.mu.Lock()
+		job, ok := s.popLocked()
+		wake := s.wake
+		s.mu.Unlock()
+
+		if ok {
+			return job, true
+		}
+
+		select {
+		case <-quit:
+			return codeJob{}, false
+		case <-wake:
+		}
+	}
+}
+
+// Done releases the in-flight slot held by a job
+func (s *fairScheduler) Done(job codeJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.inFlight[job.userID]--
+	if s.inFlight[job.userID] <= 0 {
+		delete(s.inFlight, job.userID)
+	}
+	s.broadcastLocked()
+}
+
+// Wanted returns how many more jobs should be read from the stream so that
+// at least lookahead jobs are ready to dispatch, without buffering more than
+// maxBuffered jobs in total. A full buffer still lets jobs be read while
+// workers sit idle with nothing dispatchable: when it is full of jobs of
+// users at their cap, such as a rejudge batch or one user's flood, reading
+// past them is the only way to reach other users and higher lanes.
+func (s *fairScheduler) Wanted(lookahead, maxBuffered int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dispatchable := s.dispatchableLocked()
+	wanted := lookahead - dispatchable
+	if room := maxBuffered - s.buffered; room < wanted {
+		running := 0
+		for _, count := range s.inFlight {
+			running += count
+		}
+		idle := lookahead - running - dispatchable
+		wanted = max(room, idle)
+	}
+	return wanted
+}
+
+// Changed returns a channel that is closed on the next state change
+func (s *fairScheduler) Changed() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wake
+}
+
+func (s *fairScheduler) popLocked() (codeJob, bool) {
+	for _, lane := range services.Lanes {
+		lq := s.lanes[lane]
+		for i := 0; i < len(lq.users); i++ {
+			idx := (lq.next + i) % len(lq.users)
+			uq := lq.users[idx]
+			if s.inFlight[uq.userID] >= s.maxPerUser {
+				continue
+			}
+
+			job := uq.jobs[0]
+			uq.jobs = uq.jobs[1:]
+			if len(uq.jobs) == 0 {
+				lq.users = append(lq.users[:idx], lq.users[idx+1:]...)
+			} else {
+				idx++
+			}
+			if len(lq.users) > 0 {
+				lq.next = idx % len(lq.users)
+			} else {
+				lq.next = 0
+			}
+
+			s.buffered--
+			s.inFlight[job.userID]++
+			return job, true
+		}
+	}
+
+	return codeJob{}, false
+}
+
+// dispatchableLocked counts buffered jobs that could start right now given
+// the per-user cap.
+func (s *fairScheduler) dispatchableLocked() int {
+	pending := make(map[int]int)
+	for _, lq := range s.lanes {
+		for _, uq := range lq.users {
+			pending[uq.userID] += len(uq.jobs)
+		}
+	}
+
+	total := 0
+	for userID, count := range pending {
+		free := s.maxPerUser - s.inFlight[userID]
+		if free <= 0 {
+			continue
+		}
+		if count < free {
+			free = count
+		}
+		total += free
+	}
+	return total
+}
+
+func (s *fairScheduler) broadcastLocked() {
+	close(s.wake)
+	s.wake = make(chan struct{})
+}
@@ -0,0 +1,101 @@
+package workerpool
+
+import (
+	"HAB/internal/services"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func testJob(lane services.Lane, submissionID, userID int) codeJob {
+	return codeJob{
+		stream:       string(lane),
+		msg:          redis.XMessage{ID: "0-1"},
+		lane:         lane,
+		submissionID: submissionID,
+		userID:       userID,
+	}
+}
+
+func TestSchedulerRoundRobinsUsers(t *testing.T) {
+	s := newFairScheduler(2)
+	s.Push(testJob(services.LaneNormal, 1, 1))
+	s.Push(testJob(services.LaneNormal, 2, 1))
+	s.Push(testJob(services.LaneNormal, 3, 2))
+
+	var got []int
+	for i := 0; i < 3; i++ {
+		job, ok := s.Next(nil)
+		if !ok {
+			t.Fatal("Next returned no job")
+		}
+		got = append(got, job.submissionID)
+	}
+
+	want := []int{1, 3, 2}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("dispatched %v, want %v", got, want)
+		}
+	}
+}
+
+func TestSchedulerServesHigherLanesFirst(t *testing.T) {
+	s := newFairScheduler(2)
+	s.Push(testJob(services.LaneRejudge, 1, 1))
+	s.Push(testJob(services.LaneNormal, 2, 2))
+	s.Push(testJob(services.LaneContest, 3, 3))
+
+	for _, want := range []int{3, 2, 1} {
+		job, _ := s.Next(nil)
+		if job.submissionID != want {
+			t.Fatalf("dispatched submission %d, want %d", job.submissionID, want)
+		}
+	}
+}
+
+// A buffer full of jobs from one user at their cap must not stop the
+// dispatcher from reading the jobs of other users behind them.
+func TestSchedulerReadsPastCappedUsers(t *testing.T) {
+	const (
+		workers     = 4
+		maxBuffered = 10
+	)
+	s := newFairScheduler(1)
+
+	// A rejudge batch of one user fills the buffer, and one of its jobs runs
+	for i := 1; i <= maxBuffered+1; i++ {
+		s.Push(testJob(services.LaneRejudge, i, 1))
+	}
+	running, _ := s.Next(nil)
+	if s.buffered != maxBuffered {
+		t.Fatalf("buffered %d jobs, want %d", s.buffered, maxBuffered)
+	}
+
+	// Three workers are idle and nothing buffered can go to them
+	if wanted := s.Wanted(workers, maxBuffered); wanted != workers-1 {
+		t.Fatalf("Wanted = %d, want %d", wanted, workers-1)
+	}
+
+	// Reading on reaches a contest job of another user, dispatched right away
+	s.Push(testJob(services.LaneContest, 100, 2))
+	job, _ := s.Next(nil)
+	if job.submissionID != 100 {
+		t.Fatalf("dispatched submission %d, want the contest job", job.submissionID)
+	}
+
+	// With every worker busy, a full buffer is not read further
+	s.Push(testJob(services.LaneNormal, 101, 3))
+	s.Push(testJob(services.LaneNormal, 102, 4))
+	s.Next(nil)
+	s.Next(nil)
+	if wanted := s.Wanted(workers, maxBuffered); wanted > 0 {
+		t.Fatalf("Wanted = %d with every worker busy and the buffer full", wanted)
+	}
+
+	// Once the capped user's job finishes, its next one can run
+	s.Done(running)
+	if job, _ := s.Next(nil); job.userID != 1 {
+		t.Fatalf("dispatched a job of user %d, want user 1", job.userID)
+	}
+}
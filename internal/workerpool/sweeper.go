@@ -0,0 +1,133 @@
+package workerpool
+
+import (
+	"HAB/internal/logger"
+	"HAB/internal/models"
+	"HAB/internal/repositories"
+	"HAB/internal/services"
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	sweepInterval  = time.Minute
+	sweepBatchSize = 100
+)
+
+// StuckSubmissionSweeper finds submissions left in PROCESSING by a worker
+// that died while judging them, and submissions left PENDING whose job is
+// gone from the queue, e.g. after Redis lost its data. They are queued again
+// a few times, then marked INTERNAL_ERROR so the user is not left waiting
+// forever.
+type StuckSubmissionSweeper struct {
+	codeRepo    repositories.CodeRepository
+	queue       *services.SubmissionQueue
+	events      *services.SubmissionEvents
+	timeout     time.Duration
+	maxRequeues int
+	quit        chan bool
+}
+
+func NewStuckSubmissionSweeper(codeRepo repositories.CodeRepository, queue *services.SubmissionQueue, events *services.SubmissionEvents, timeout time.Duration, maxRequeues int) *StuckSubmissionSweeper {
+	return &StuckSubmissionSweeper{
+		codeRepo:    codeRepo,
+		queue:       queue,
+		events:      events,
+		timeout:     timeout,
+		maxRequeues: maxRequeues,
+		quit:        make(chan bool),
+	}
+}
+
+func (s *StuckSubmissionSweeper) Start(ctx context.Context) {
+	go s.run(ctx)
+}
+
+func (s *StuckSubmissionSweeper) Stop() {
+	close(s.quit)
+}
+
+func (s *StuckSubmissionSweeper) run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+			s.sweep(ctx)
+		}
+	}
+}
+
+func (s *StuckSubmissionSweeper) sweep(ctx context.Context) {
+	submissions, err := s.codeRepo.GetStuckSubmissions(ctx, s.timeout, sweepBatchSize)
+	if err != nil {
+		logger.Log.Error("Failed to get stuck submissions", zap.Error(err))
+		return
+	}
+
+	for _, submission := range submissions {
+		if submission.Status == models.StatusPending {
+			// A pending job may just be waiting behind a long queue
+			queued, err := s.queue.Queued(ctx, submission.ID)
+			if err != nil {
+				logger.Log.Error("Failed to check whether pending submission is queued",
+					zap.Int("submission_id", submission.ID),
+					zap.Error(err))
+				continue
+			}
+			if queued {
+				continue
+			}
+		}
+
+		if submission.RequeueCount < s.maxRequeues {
+			requeued, err := s.codeRepo.RequeueSubmission(ctx, &submission)
+			if err != nil {
+				logger.Log.Error("Failed to requeue stuck submission",
+					zap.Int("submission_id", submission.ID),
+					zap.Error(err))
+				continue
+			}
+			if requeued {
+				logger.Log.Warn("Requeued stuck submission",
+					zap.Int("submission_id", submission.ID),
+					zap.String("status", submission.Status),
+					zap.String("lane", submission.QueueLane),
+					zap.Int("requeue_count", submission.RequeueCount+1))
+			}
+			continue
+		}
+
+		failed, err := s.codeRepo.FailSubmission(ctx, submission.ID, submission.Status)
+		if err != nil {
+			logger.Log.Error("Failed to mark stuck submission as internal error",
+				zap.Int("submission_id", submission.ID),
+				zap.Error(err))
+			continue
+		}
+		if !failed {
+			continue
+		}
+
+		logger.Log.Warn("Gave up on stuck submission",
+			zap.Int("submission_id", submission.ID),
+			zap.Int("requeue_count", submission.RequeueCount))
+
+		err = s.events.Publish(ctx, services.SubmissionEvent{
+			SubmissionID: submission.ID,
+			UserID:       submission.UserID,
+			Stage:        services.StageFinished,
+			Status:       models.StatusInternalError,
+		})
+		if err != nil {
+			logger.Log.Warn("Failed to publish submission event",
+				zap.Int("submission_id", submission.ID),
+				zap.Error(err))
+		}
+	}
+}
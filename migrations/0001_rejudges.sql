@@ -0,0 +1,27 @@
+-- Rejudge batches and the verdict each submission had before being rejudged
+CREATE TABLE IF NOT EXISTS rejudges (
+    id            INT AUTO_INCREMENT PRIMARY KEY,
+    requested_by  INT NOT NULL,
+    scope         VARCHAR(20) NOT NULL,
+    submission_id INT NULL,
+    problem_id    INT NULL,
+    from_time     DATETIME NULL,
+    to_time       DATETIME NULL,
+    total         INT NOT NULL DEFAULT 0,
+    created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (requested_by) REFERENCES users(id)
+);
+
+CREATE TABLE IF NOT EXISTS rejudge_items (
+    rejudge_id              INT NOT NULL,
+    submission_id           INT NOT NULL,
+    previous_status         VARCHAR(32) NOT NULL,
+    previous_wrong_testcase INT NULL,
+    previous_program_output MEDIUMTEXT NULL,
+    new_status              VARCHAR(32) NULL,
+    judged_at               DATETIME NULL,
+    PRIMARY KEY (rejudge_id, submission_id),
+    INDEX idx_rejudge_items_submission (submission_id),
+    FOREIGN KEY (rejudge_id) REFERENCES rejudges(id) ON DELETE CASCADE,
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE CASCADE
+);
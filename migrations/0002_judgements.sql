@@ -0,0 +1,40 @@
+-- Every judging attempt of a submission; submissions point at the current one
+CREATE TABLE IF NOT EXISTS judgements (
+    id             INT AUTO_INCREMENT PRIMARY KEY,
+    submission_id  INT NOT NULL,
+    worker_id      VARCHAR(255) NOT NULL,
+    toolchain      VARCHAR(100) NOT NULL,
+    status         VARCHAR(32) NOT NULL,
+    wrong_testcase INT NULL,
+    program_output MEDIUMTEXT NULL,
+    test_results   JSON NULL,
+    started_at     DATETIME(3) NOT NULL,
+    finished_at    DATETIME(3) NOT NULL,
+    execution_ms   INT NOT NULL DEFAULT 0,
+    INDEX idx_judgements_submission (submission_id),
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE CASCADE
+);
+
+ALTER TABLE submissions ADD COLUMN current_judgement_id INT NULL;
+
+-- Keep the verdicts judged before this table existed
+INSERT INTO judgements (submission_id, worker_id, toolchain, status, wrong_testcase, program_output, test_results, started_at, finished_at)
+SELECT id, 'legacy', 'unknown', status, wrong_testcase, program_output, '[]', submitted_at, submitted_at
+FROM submissions
+WHERE status NOT IN ('PENDING', 'PROCESSING', 'CANCELLED');
+
+UPDATE submissions s
+JOIN judgements j ON j.submission_id = s.id
+SET s.current_judgement_id = j.id;
+
+ALTER TABLE submissions
+    ADD CONSTRAINT fk_submissions_current_judgement FOREIGN KEY (current_judgement_id) REFERENCES judgements(id) ON DELETE SET NULL,
+    DROP COLUMN wrong_testcase,
+    DROP COLUMN program_output;
+
+-- Rejudges now point at judgements instead of copying the verdict details
+ALTER TABLE rejudge_items
+    ADD COLUMN previous_judgement_id INT NULL AFTER previous_status,
+    ADD COLUMN new_judgement_id INT NULL AFTER new_status,
+    DROP COLUMN previous_wrong_testcase,
+    DROP COLUMN previous_program_output;
@@ -0,0 +1,21 @@
+-- Queue messages written in the same transaction as the submission, published
+-- to the Redis streams by the outbox relay
+CREATE TABLE IF NOT EXISTS submission_outbox (
+    id            BIGINT AUTO_INCREMENT PRIMARY KEY,
+    submission_id INT NOT NULL,
+    user_id       INT NOT NULL,
+    lane          VARCHAR(20) NOT NULL,
+    rejudge_id    INT NULL,
+    attempts      INT NOT NULL DEFAULT 0,
+    last_error    VARCHAR(1024) NULL,
+    created_at    DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    published_at  DATETIME(3) NULL,
+    INDEX idx_submission_outbox_unpublished (published_at, id),
+    FOREIGN KEY (submission_id) REFERENCES submissions(id) ON DELETE CASCADE
+);
+
+-- Lets the sweeper find submissions whose worker died while judging them
+ALTER TABLE submissions
+    ADD COLUMN processing_started_at DATETIME(3) NULL,
+    ADD COLUMN requeue_count INT NOT NULL DEFAULT 0,
+    ADD INDEX idx_submissions_status_processing (status, processing_started_at);
@@ -0,0 +1,4 @@
+-- Cursor pagination walks submissions by descending ID within these filters
+ALTER TABLE submissions
+    ADD INDEX idx_submissions_user_id (user_id, id),
+    ADD INDEX idx_submissions_problem_id (problem_id, id);
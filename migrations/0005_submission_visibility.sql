@@ -0,0 +1,3 @@
+-- Owners can make the source code of a submission public on the status page
+ALTER TABLE submissions
+    ADD COLUMN visibility VARCHAR(16) NOT NULL DEFAULT 'private';
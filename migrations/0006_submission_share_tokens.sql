@@ -0,0 +1,4 @@
+-- Unguessable token of submissions shared by link; NULL while private
+ALTER TABLE submissions
+    ADD COLUMN share_token VARCHAR(64) NULL,
+    ADD UNIQUE INDEX idx_submissions_share_token (share_token);
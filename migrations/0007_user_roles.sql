@@ -0,0 +1,3 @@
+-- Role of each user: user, problem_setter or admin
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
@@ -0,0 +1,5 @@
+-- Time and memory limit of each test run, and how outputs are compared
+ALTER TABLE problems
+    ADD COLUMN time_limit_ms INT NOT NULL DEFAULT 2000,
+    ADD COLUMN memory_limit_mb INT NOT NULL DEFAULT 256,
+    ADD COLUMN checker VARCHAR(64) NOT NULL DEFAULT 'exact';
@@ -0,0 +1,18 @@
+-- Problem tags, and full-text search on problem titles and descriptions
+CREATE TABLE IF NOT EXISTS tags (
+    id   INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(32) NOT NULL,
+    UNIQUE INDEX uq_tags_name (name)
+);
+
+CREATE TABLE IF NOT EXISTS problem_tags (
+    problem_id INT NOT NULL,
+    tag_id     INT NOT NULL,
+    PRIMARY KEY (problem_id, tag_id),
+    INDEX idx_problem_tags_tag (tag_id),
+    FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE,
+    FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+ALTER TABLE problems
+    ADD FULLTEXT INDEX ft_problems_search (title, description);
@@ -0,0 +1,35 @@
+-- Versioned test sets. Published versions never change, so each verdict
+-- keeps meaning what it meant; edits go to a per-problem draft (version NULL)
+-- until it is published as the next version.
+CREATE TABLE IF NOT EXISTS test_sets (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    problem_id   INT NOT NULL,
+    version      INT NULL,
+    created_at   DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3),
+    published_at DATETIME(3) NULL,
+    UNIQUE INDEX uq_test_sets_version (problem_id, version),
+    FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+);
+
+-- Test cases are shared by the versions containing them, and copied when
+-- a draft edits one that is published
+CREATE TABLE IF NOT EXISTS test_set_cases (
+    test_set_id  INT NOT NULL,
+    test_case_id INT NOT NULL,
+    position     INT NOT NULL,
+    PRIMARY KEY (test_set_id, test_case_id),
+    INDEX idx_test_set_cases_case (test_case_id),
+    FOREIGN KEY (test_set_id) REFERENCES test_sets(id) ON DELETE CASCADE,
+    FOREIGN KEY (test_case_id) REFERENCES test_cases(id) ON DELETE CASCADE
+);
+
+-- The existing tests become version 1 of each problem
+INSERT INTO test_sets (problem_id, version, published_at)
+SELECT DISTINCT problem_id, 1, CURRENT_TIMESTAMP(3) FROM test_cases;
+
+INSERT INTO test_set_cases (test_set_id, test_case_id, position)
+SELECT ts.id, tc.id, tc.id
+FROM test_cases tc
+JOIN test_sets ts ON ts.problem_id = tc.problem_id;
+
+ALTER TABLE judgements ADD COLUMN test_set_version INT NULL AFTER toolchain;
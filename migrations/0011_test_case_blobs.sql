@@ -0,0 +1,11 @@
+-- Test files larger than BLOB_INLINE_LIMIT live in the blob store, keyed by
+-- the SHA-256 of their content; their inline column is NULL then
+ALTER TABLE test_cases
+    MODIFY input MEDIUMTEXT NULL,
+    MODIFY expected_output MEDIUMTEXT NULL,
+    ADD COLUMN input_blob CHAR(64) NULL AFTER input,
+    ADD COLUMN input_size INT NOT NULL DEFAULT 0 AFTER input_blob,
+    ADD COLUMN expected_output_blob CHAR(64) NULL AFTER expected_output,
+    ADD COLUMN expected_output_size INT NOT NULL DEFAULT 0 AFTER expected_output_blob;
+
+UPDATE test_cases SET input_size = LENGTH(input), expected_output_size = LENGTH(expected_output);
@@ -0,0 +1,16 @@
+-- Generators, reference solution and validator of a problem, run in the
+-- sandbox to produce its tests
+CREATE TABLE IF NOT EXISTS problem_programs (
+    id          INT AUTO_INCREMENT PRIMARY KEY,
+    problem_id  INT NOT NULL,
+    name        VARCHAR(64) NOT NULL,
+    kind        VARCHAR(16) NOT NULL,
+    language_id INT NOT NULL,
+    source_code MEDIUMTEXT NOT NULL,
+    updated_at  DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    UNIQUE INDEX uq_problem_programs_name (problem_id, name),
+    FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+);
+
+-- The script a generated test set was produced with
+ALTER TABLE test_sets ADD COLUMN generator_script TEXT NULL;
@@ -0,0 +1,10 @@
+-- Only visible tests have their data shown with a verdict; the input,
+-- expected output and program output of hidden ones are kept from users
+ALTER TABLE test_cases
+    ADD COLUMN visible BOOLEAN NOT NULL DEFAULT FALSE AFTER expected_output_size;
+
+-- Tests repeating the statement's sample were never a secret
+UPDATE test_cases tc
+JOIN problems p ON p.id = tc.problem_id
+SET tc.visible = TRUE
+WHERE tc.input = p.sample_input AND tc.expected_output = p.sample_output;
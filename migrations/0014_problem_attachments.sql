@@ -0,0 +1,12 @@
+-- Images of problem statements, kept in the blob store
+CREATE TABLE IF NOT EXISTS problem_attachments (
+    id           INT AUTO_INCREMENT PRIMARY KEY,
+    problem_id   INT NOT NULL,
+    name         VARCHAR(128) NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    blob_key     CHAR(64) NOT NULL,
+    size         INT NOT NULL,
+    updated_at   DATETIME(3) NOT NULL DEFAULT CURRENT_TIMESTAMP(3) ON UPDATE CURRENT_TIMESTAMP(3),
+    UNIQUE INDEX uq_problem_attachments_name (problem_id, name),
+    FOREIGN KEY (problem_id) REFERENCES problems(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+-- Where a submission was queued, so the sweeper can queue it again on the
+-- same lane and as part of the same rejudge, and since when it has been
+-- PENDING, so one whose job got lost can be found
+ALTER TABLE submissions
+    ADD COLUMN queue_lane VARCHAR(20) NOT NULL DEFAULT 'normal',
+    ADD COLUMN rejudge_id INT NULL,
+    ADD COLUMN queued_at DATETIME(3) NULL,
+    ADD INDEX idx_submissions_status_queued (status, queued_at),
+    ADD FOREIGN KEY (rejudge_id) REFERENCES rejudges(id) ON DELETE SET NULL;
@@ -0,0 +1,16 @@
+-- Submission counts kept on each problem, so the problem list can be sorted
+-- by acceptance and paged in SQL without counting submissions every time
+ALTER TABLE problems
+    ADD COLUMN total_submissions INT NOT NULL DEFAULT 0,
+    ADD COLUMN accepted_submissions INT NOT NULL DEFAULT 0;
+
+UPDATE problems p
+JOIN (
+    SELECT problem_id, COUNT(*) AS total, SUM(status = 'ACCEPTED') AS accepted
+    FROM submissions GROUP BY problem_id
+) stats ON stats.problem_id = p.id
+SET p.total_submissions = stats.total, p.accepted_submissions = stats.accepted;
+
+-- Lets the solved filter find a user's accepted submissions of a problem
+ALTER TABLE submissions
+    ADD INDEX idx_submissions_user_problem_status (user_id, problem_id, status);